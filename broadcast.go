@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"openchamp/server/internal/config"
+	"os"
+	"strings"
+	"time"
+)
+
+const broadcastUsage = `Usage: openchamp broadcast [-url URL] [-key KEY] "message"
+
+Sends an announcement to every client of a running instance through its
+admin API. The API key needs the server.broadcast scope and is read from
+OPENCHAMP_API_KEY when -key is not given.`
+
+// runBroadcast handles the broadcast subcommand and returns the process exit code
+func runBroadcast(args []string) int {
+	cfg := config.Load()
+	flags := flag.NewFlagSet("broadcast", flag.ContinueOnError)
+	baseURL := flags.String("url", cfg.PublicURL, "address of the running web server")
+	key := flags.String("key", os.Getenv("OPENCHAMP_API_KEY"), "API key with the server.broadcast scope")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	message := strings.TrimSpace(strings.Join(flags.Args(), " "))
+	if message == "" || *key == "" {
+		fmt.Fprintln(os.Stderr, broadcastUsage)
+		return 2
+	}
+
+	var result struct {
+		Recipients int `json:"recipients"`
+	}
+	if err := callAdminAPI(*baseURL, *key, "/admin/broadcast", map[string]string{"message": message}, &result); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Sent to %d clients\n", result.Recipients)
+	return 0
+}
+
+// errUnreachable is returned by callAdminAPI when no running instance answered
+var errUnreachable = errors.New("the server could not be reached")
+
+// callAdminAPI posts body to an admin endpoint of a running instance and decodes the answer into result
+func callAdminAPI(baseURL, key, path string, body, result interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(baseURL, "/")+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-API-Key", key)
+
+	client := http.Client{Timeout: 10 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errUnreachable, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		var apiError struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.NewDecoder(response.Body).Decode(&apiError) == nil && apiError.Error.Message != "" {
+			return fmt.Errorf("the server refused: %s", apiError.Error.Message)
+		}
+		return fmt.Errorf("the server answered %s", response.Status)
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"openchamp/server/internal/account"
+	"openchamp/server/internal/config"
+	"openchamp/server/internal/database"
+	"openchamp/server/internal/store"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	log "github.com/sirupsen/logrus"
+)
+
+// cliSource is recorded as the address of audit events caused by offline commands
+const cliSource = "cli"
+
+// commandTimeout bounds the database work of a single offline command
+const commandTimeout = 30 * time.Second
+
+// openDatabase connects to the configured database, logging why it failed
+func openDatabase(cfg config.Config) (*pgxpool.Pool, bool) {
+	dbPool, err := database.InitDBPool(cfg.DatabaseURL)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Failed to connect to the database")
+		return nil, false
+	}
+	return dbPool, true
+}
+
+// openAccounts connects to the database and builds the account service offline commands share
+func openAccounts() (*pgxpool.Pool, *account.Service, bool) {
+	dbPool, ok := openDatabase(config.Load())
+	if !ok {
+		return nil, nil, false
+	}
+	users := store.NewPostgres(dbPool)
+	return dbPool, account.NewService(dbPool, users, users, users, users), true
+}
+
+// readPassword reads one line from stdin, prompting on stderr when a person is typing
+func readPassword(prompt string) (string, error) {
+	if isTerminal(os.Stdin) {
+		fmt.Fprint(os.Stderr, prompt)
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("no password given on stdin: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// reportError prints an account service error the way an operator expects to read it
+func reportError(err error) int {
+	var validationErr *account.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		fmt.Fprintln(os.Stderr, validationErr.Message)
+		return 2
+	case errors.Is(err, account.ErrUserNotFound):
+		fmt.Fprintln(os.Stderr, "Unknown user")
+	case errors.Is(err, account.ErrUsernameTaken):
+		fmt.Fprintln(os.Stderr, "Username already exists")
+	case errors.Is(err, account.ErrEmailTaken):
+		fmt.Fprintln(os.Stderr, "Email already registered")
+	case errors.Is(err, context.DeadlineExceeded):
+		fmt.Fprintln(os.Stderr, "The database did not answer in time")
+	default:
+		log.Error(err)
+	}
+	return 1
+}
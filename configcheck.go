@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"openchamp/server/internal/config"
+	"openchamp/server/internal/database"
+	"os"
+	"time"
+)
+
+const configUsage = `Usage: openchamp config check [-offline]
+
+Prints the configuration with secrets masked and reports settings that
+would keep the server from working. Unless -offline is given the database
+is contacted as well and pending migrations are reported.`
+
+// runConfig handles the config subcommand and returns the process exit code
+func runConfig(args []string) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+	flags := flag.NewFlagSet("config check", flag.ContinueOnError)
+	offline := flags.Bool("offline", false, "do not contact the database")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	cfg := config.Load()
+	shown := cfg.Redacted()
+	fmt.Println("Database:          " + shown.DatabaseURL)
+	fmt.Printf("Web port:          %d\n", shown.WebPort)
+	fmt.Printf("WebSocket port:    %d\n", shown.WebSocketPort)
+	fmt.Println("Public URL:        " + shown.PublicURL)
+	fmt.Printf("Shutdown timeout:  %s\n", shown.ShutdownTimeout)
+	fmt.Printf("Reconnect delay:   %s\n", shown.ReconnectDelay)
+	fmt.Printf("Headless:          %t\n", shown.Headless)
+	fmt.Printf("Log:               level %s, json %t, stdout %t, files %t in %s\n",
+		shown.Log.Level, shown.Log.JSON, shown.Log.Stdout, shown.Log.Files, shown.Log.Dir)
+	wordList := shown.Chat.WordList
+	if wordList == "" {
+		wordList = "built in"
+	}
+	fmt.Printf("Chat filter:       word list %s, policies %v, restrict after %d in %s for %s\n",
+		wordList, shown.Chat.Policies, shown.Chat.RestrictAfter, shown.Chat.RestrictWindow, shown.Chat.RestrictFor)
+	fmt.Printf("Discord login:     %t\n", shown.OAuth.Discord.ClientID != "")
+	fmt.Printf("Steam login:       %t\n", shown.OAuth.Steam.Enabled)
+	fmt.Printf("OIDC login:        %t\n", shown.OAuth.OIDC.ClientID != "")
+
+	problems := cfg.Problems()
+	if !*offline {
+		problems = append(problems, checkDatabase(cfg)...)
+	}
+
+	fmt.Println()
+	if len(problems) == 0 {
+		fmt.Println("Configuration OK")
+		return 0
+	}
+	for _, problem := range problems {
+		fmt.Println("Problem: " + problem)
+	}
+	return 1
+}
+
+// checkDatabase connects to the database and reports migrations that have not been applied
+func checkDatabase(cfg config.Config) []string {
+	dbPool, err := database.InitDBPool(cfg.DatabaseURL)
+	if err != nil {
+		return []string{"the database is unreachable: " + err.Error()}
+	}
+	defer dbPool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	statuses, err := database.MigrationStatuses(ctx, dbPool)
+	if err != nil {
+		return []string{"migration status could not be read: " + err.Error()}
+	}
+	var problems []string
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			problems = append(problems, fmt.Sprintf("migration %04d %s is pending, run openchamp migrate up", status.Version, status.Name))
+		}
+	}
+	return problems
+}
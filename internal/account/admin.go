@@ -0,0 +1,128 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"openchamp/server/internal/audit"
+	"openchamp/server/internal/store"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CreateAccount creates an account on behalf of an operator without logging it in
+func (s *Service) CreateAccount(ctx context.Context, username, password, email string, adminID *int, ip string) (*store.User, error) {
+	if err := validateUsername(username); err != nil {
+		return nil, err
+	}
+	if err := validatePassword(password); err != nil {
+		return nil, err
+	}
+	if err := validateEmail(email); err != nil {
+		return nil, err
+	}
+
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing password: %w", err)
+	}
+	user, err := s.users.CreateUser(ctx, username, string(passwordHash), email)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrUsernameTaken):
+			return nil, ErrUsernameTaken
+		case errors.Is(err, store.ErrEmailTaken):
+			return nil, ErrEmailTaken
+		}
+		return nil, fmt.Errorf("error inserting new user: %w", err)
+	}
+
+	s.record(audit.Event{
+		Type:     audit.EventRegister,
+		ActorID:  adminID,
+		TargetID: &user.ID,
+		IP:       ip,
+		Details: map[string]interface{}{
+			"username":    username,
+			"by_operator": true,
+		},
+	})
+	log.WithFields(log.Fields{
+		"user_id":  user.ID,
+		"username": username,
+	}).Info("User created by an operator")
+	return user, nil
+}
+
+// ResetPassword sets a new password for a user and revokes all of their tokens
+func (s *Service) ResetPassword(ctx context.Context, username, newPassword string, adminID *int, ip string) error {
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+	user, err := s.users.UserByUsername(ctx, username)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	passwordHash, err := hashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %w", err)
+	}
+	if err := s.users.UpdatePassword(ctx, user.ID, string(passwordHash), ""); err != nil {
+		return err
+	}
+
+	s.record(audit.Event{
+		Type:     audit.EventPasswordChange,
+		ActorID:  adminID,
+		TargetID: &user.ID,
+		IP:       ip,
+		Details: map[string]interface{}{
+			"reset": true,
+		},
+	})
+	log.WithFields(log.Fields{
+		"user_id":  user.ID,
+		"username": user.Username,
+	}).Info("Password reset")
+	return nil
+}
+
+// RevokeTokens logs a user out everywhere and returns how many tokens were revoked
+func (s *Service) RevokeTokens(ctx context.Context, username string, adminID *int, ip string) (int, error) {
+	user, err := s.users.UserByUsername(ctx, username)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return 0, ErrUserNotFound
+		}
+		return 0, err
+	}
+
+	revoked, err := s.tokens.RevokeUserTokens(ctx, user.ID, "")
+	if err != nil {
+		return 0, err
+	}
+
+	s.record(audit.Event{
+		Type:     audit.EventTokensRevoke,
+		ActorID:  adminID,
+		TargetID: &user.ID,
+		IP:       ip,
+		Details: map[string]interface{}{
+			"count": revoked,
+		},
+	})
+	return revoked, nil
+}
+
+// UserByUsername looks up an account for operator tools
+func (s *Service) UserByUsername(ctx context.Context, username string) (*store.User, error) {
+	user, err := s.users.UserByUsername(ctx, username)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
@@ -0,0 +1,116 @@
+package account
+
+import (
+	"context"
+	"fmt"
+	"openchamp/server/internal/auth"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	challengeTTL         = 5 * time.Minute
+	challengeMaxAttempts = 5
+)
+
+// Challenge is a login that passed the first factor and is waiting for a TOTP or recovery code
+type Challenge struct {
+	ID        string    `json:"challenge"`
+	Username  string    `json:"username"`
+	Methods   []string  `json:"methods"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type challenge struct {
+	Challenge
+	userID   int
+	method   string // First factor used, recorded in the audit log
+	attempts int
+}
+
+func (s *Service) startChallenge(userID int, username, method string) *Challenge {
+	pending := &challenge{
+		Challenge: Challenge{
+			ID:        uuid.New().String(),
+			Username:  username,
+			Methods:   []string{"totp", "recovery_code"},
+			ExpiresAt: time.Now().Add(challengeTTL),
+		},
+		userID: userID,
+		method: method,
+	}
+
+	s.challengesMutex.Lock()
+	defer s.challengesMutex.Unlock()
+
+	// Drop abandoned challenges so the map does not grow forever
+	for id, existing := range s.challenges {
+		if time.Now().After(existing.ExpiresAt) {
+			delete(s.challenges, id)
+		}
+	}
+	s.challenges[pending.ID] = pending
+
+	result := pending.Challenge
+	return &result
+}
+
+// VerifyChallenge completes a login with a TOTP code or a recovery code.
+// Each call claims an attempt before the code is checked, so concurrent
+// guesses against one challenge still stop at challengeMaxAttempts.
+func (s *Service) VerifyChallenge(ctx context.Context, challengeID, code, recoveryCode, ip string) (*Session, error) {
+	s.challengesMutex.Lock()
+	pending, ok := s.challenges[challengeID]
+	if !ok || time.Now().After(pending.ExpiresAt) {
+		s.challengesMutex.Unlock()
+		return nil, ErrInvalidChallenge
+	}
+	if pending.attempts >= challengeMaxAttempts {
+		delete(s.challenges, challengeID)
+		s.challengesMutex.Unlock()
+		return nil, ErrTooManyAttempts
+	}
+	pending.attempts++
+	attempt := pending.attempts
+	s.challengesMutex.Unlock()
+
+	var (
+		valid  bool
+		err    error
+		method = pending.method + "+totp"
+	)
+	if recoveryCode != "" {
+		method = pending.method + "+recovery_code"
+		valid, err = s.twoFactor.UseRecoveryCode(ctx, pending.userID, auth.HashRecoveryCode(recoveryCode))
+	} else {
+		valid, err = s.checkTOTP(ctx, pending.userID, code, true)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error during two-factor verification: %w", err)
+	}
+
+	s.challengesMutex.Lock()
+	if !valid {
+		tooMany := attempt >= challengeMaxAttempts
+		if tooMany {
+			delete(s.challenges, challengeID)
+		}
+		s.challengesMutex.Unlock()
+
+		s.recordLoginFailure(pending.userID, pending.Username, ip, "invalid_2fa_code")
+		if tooMany {
+			return nil, ErrTooManyAttempts
+		}
+		return nil, ErrInvalidCode
+	}
+	// A concurrent verification may have completed the challenge already
+	_, ok = s.challenges[challengeID]
+	delete(s.challenges, challengeID)
+	s.challengesMutex.Unlock()
+	if !ok {
+		return nil, ErrInvalidChallenge
+	}
+
+	return s.issueSession(ctx, pending.userID, pending.Username, ip, method)
+}
@@ -0,0 +1,42 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"openchamp/server/internal/store"
+	"testing"
+	"time"
+)
+
+func TestVerifyChallengeStopsAtMaxAttempts(t *testing.T) {
+	memory := store.NewMemory()
+	service := NewService(nil, memory, memory, memory, memory)
+	pending := service.startChallenge(1, "player", "password")
+
+	// Attempts are claimed before the code is checked, once every attempt is
+	// taken further guesses are rejected without reaching the second factor
+	service.challengesMutex.Lock()
+	service.challenges[pending.ID].attempts = challengeMaxAttempts
+	service.challengesMutex.Unlock()
+
+	if _, err := service.VerifyChallenge(context.Background(), pending.ID, "123456", "", "10.0.0.1"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("VerifyChallenge() error = %v, want ErrTooManyAttempts", err)
+	}
+	if _, err := service.VerifyChallenge(context.Background(), pending.ID, "123456", "", "10.0.0.1"); !errors.Is(err, ErrInvalidChallenge) {
+		t.Errorf("VerifyChallenge() after too many attempts = %v, want ErrInvalidChallenge", err)
+	}
+}
+
+func TestVerifyChallengeExpired(t *testing.T) {
+	memory := store.NewMemory()
+	service := NewService(nil, memory, memory, memory, memory)
+	pending := service.startChallenge(1, "player", "password")
+
+	service.challengesMutex.Lock()
+	service.challenges[pending.ID].ExpiresAt = time.Now().Add(-time.Second)
+	service.challengesMutex.Unlock()
+
+	if _, err := service.VerifyChallenge(context.Background(), pending.ID, "123456", "", "10.0.0.1"); !errors.Is(err, ErrInvalidChallenge) {
+		t.Errorf("VerifyChallenge() error = %v, want ErrInvalidChallenge", err)
+	}
+}
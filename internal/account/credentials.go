@@ -0,0 +1,90 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"openchamp/server/internal/audit"
+	"openchamp/server/internal/store"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func (s *Service) validateCredentials(ctx context.Context, username, password string) (*store.User, bool, error) {
+	user, err := s.users.UserByUsername(ctx, username)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, false, nil // Unknown username
+		}
+		return nil, false, err // Database error
+	}
+
+	// Accounts created through an external provider have no password until
+	// the user sets one, no password logs in to them
+	if user.PasswordHash == "" {
+		return user, false, nil
+	}
+	if err := comparePassword(user.PasswordHash, password); err != nil {
+		return user, false, nil // Wrong password, the user is kept for auditing
+	}
+
+	return user, true, nil
+}
+
+func (s *Service) validateToken(ctx context.Context, token, clientIP string) (*store.User, bool, error) {
+	stored, err := s.tokens.ActiveToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, false, nil // Token not found, expired or revoked
+		}
+		return nil, false, err // Database error
+	}
+
+	user, err := s.users.UserByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, false, nil // The user was deleted
+		}
+		return nil, false, err
+	}
+
+	// Check IP restrictions if a previous IP is stored
+	if stored.IPAddress != "" {
+		// If this is a different IP than previously used with this token,
+		// we can either reject it or implement additional security checks
+		if stored.IPAddress != clientIP {
+			log.WithFields(log.Fields{
+				"user_id":     stored.UserID,
+				"previous_ip": stored.IPAddress,
+				"ip":          clientIP,
+			}).Warn("Token used from a new IP")
+			s.record(audit.Event{
+				Type:     audit.EventTokenNewIP,
+				ActorID:  &user.ID,
+				TargetID: &user.ID,
+				IP:       clientIP,
+				Details: map[string]interface{}{
+					"token_id":    stored.ID,
+					"previous_ip": stored.IPAddress,
+				},
+			})
+
+			// Depending on security requirements, you might want to:
+			// 1. Reject the attempt (uncomment the next line)
+			// return nil, false, nil
+
+			// 2. Allow it but track the new IP
+			// 3. Require additional verification
+			// 4. Rate limit new IP logins
+		}
+	}
+
+	// Update the token's last_used_at timestamp and IP
+	if err := s.tokens.MarkTokenUsed(ctx, stored.ID, clientIP); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Error updating token usage")
+		// Non-critical error, we can continue
+	}
+
+	return user, true, nil
+}
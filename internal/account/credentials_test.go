@@ -0,0 +1,213 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"openchamp/server/internal/audit"
+	"openchamp/server/internal/store"
+	"testing"
+	"time"
+)
+
+var errStoreDown = errors.New("store unavailable")
+
+// failingStore is a memory store whose lookups fail like an unreachable database
+type failingStore struct {
+	*store.Memory
+	failTokens bool
+	failUsers  bool
+}
+
+func (f *failingStore) ActiveToken(ctx context.Context, token string) (*store.Token, error) {
+	if f.failTokens {
+		return nil, errStoreDown
+	}
+	return f.Memory.ActiveToken(ctx, token)
+}
+
+func (f *failingStore) UserByUsername(ctx context.Context, username string) (*store.User, error) {
+	if f.failUsers {
+		return nil, errStoreDown
+	}
+	return f.Memory.UserByUsername(ctx, username)
+}
+
+func (f *failingStore) UserByID(ctx context.Context, id int) (*store.User, error) {
+	if f.failUsers {
+		return nil, errStoreDown
+	}
+	return f.Memory.UserByID(ctx, id)
+}
+
+func TestValidateToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, memory *store.Memory, userID int)
+		token      string
+		ip         string
+		failTokens bool
+		failUsers  bool
+		wantValid  bool
+		wantErr    error
+		wantAudit  []audit.EventType
+	}{
+		{
+			name:  "not found",
+			token: "unknown",
+			ip:    "10.0.0.1",
+		},
+		{
+			name: "expired",
+			setup: func(t *testing.T, memory *store.Memory, userID int) {
+				mustCreateToken(t, memory, userID, "expired", "10.0.0.1", -time.Minute)
+			},
+			token: "expired",
+			ip:    "10.0.0.1",
+		},
+		{
+			name: "revoked",
+			setup: func(t *testing.T, memory *store.Memory, userID int) {
+				mustCreateToken(t, memory, userID, "revoked", "10.0.0.1", time.Hour)
+				if err := memory.RevokeToken(context.Background(), "revoked"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			token: "revoked",
+			ip:    "10.0.0.1",
+		},
+		{
+			name: "deleted user",
+			setup: func(t *testing.T, memory *store.Memory, userID int) {
+				mustCreateToken(t, memory, userID, "orphan", "10.0.0.1", time.Hour)
+				if err := memory.DeleteUser(context.Background(), userID); err != nil {
+					t.Fatal(err)
+				}
+			},
+			token: "orphan",
+			ip:    "10.0.0.1",
+		},
+		{
+			name: "same ip",
+			setup: func(t *testing.T, memory *store.Memory, userID int) {
+				mustCreateToken(t, memory, userID, "valid", "10.0.0.1", time.Hour)
+			},
+			token:     "valid",
+			ip:        "10.0.0.1",
+			wantValid: true,
+		},
+		{
+			name: "new ip is audited",
+			setup: func(t *testing.T, memory *store.Memory, userID int) {
+				mustCreateToken(t, memory, userID, "valid", "10.0.0.1", time.Hour)
+			},
+			token:     "valid",
+			ip:        "10.0.0.2",
+			wantValid: true,
+			wantAudit: []audit.EventType{audit.EventTokenNewIP},
+		},
+		{
+			name:       "token store failure",
+			token:      "valid",
+			ip:         "10.0.0.1",
+			failTokens: true,
+			wantErr:    errStoreDown,
+		},
+		{
+			name: "user store failure",
+			setup: func(t *testing.T, memory *store.Memory, userID int) {
+				mustCreateToken(t, memory, userID, "valid", "10.0.0.1", time.Hour)
+			},
+			token:     "valid",
+			ip:        "10.0.0.1",
+			failUsers: true,
+			wantErr:   errStoreDown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := store.NewMemory()
+			user, err := memory.CreateUser(context.Background(), "player", "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.setup != nil {
+				tt.setup(t, memory, user.ID)
+			}
+
+			backend := &failingStore{Memory: memory, failTokens: tt.failTokens, failUsers: tt.failUsers}
+			service := NewService(nil, backend, backend, backend, backend)
+			var recorded []audit.Event
+			service.record = func(event audit.Event) {
+				recorded = append(recorded, event)
+			}
+
+			got, valid, err := service.validateToken(context.Background(), tt.token, tt.ip)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if valid != tt.wantValid {
+				t.Fatalf("valid = %v, want %v", valid, tt.wantValid)
+			}
+			if valid && got.ID != user.ID {
+				t.Errorf("user = %d, want %d", got.ID, user.ID)
+			}
+			if len(recorded) != len(tt.wantAudit) {
+				t.Fatalf("recorded %d audit events, want %d", len(recorded), len(tt.wantAudit))
+			}
+			for i, event := range recorded {
+				if event.Type != tt.wantAudit[i] {
+					t.Errorf("audit event %d = %s, want %s", i, event.Type, tt.wantAudit[i])
+				}
+			}
+
+			if valid {
+				stored, err := memory.ActiveToken(context.Background(), tt.token)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stored.IPAddress != tt.ip || stored.LastUsedAt == nil {
+					t.Errorf("token used from %q at %v, want %q and a time", stored.IPAddress, stored.LastUsedAt, tt.ip)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateTokenNewIPDetails(t *testing.T) {
+	memory := store.NewMemory()
+	user, err := memory.CreateUser(context.Background(), "player", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := mustCreateToken(t, memory, user.ID, "valid", "10.0.0.1", time.Hour)
+
+	service := NewService(nil, memory, memory, memory, memory)
+	var recorded []audit.Event
+	service.record = func(event audit.Event) {
+		recorded = append(recorded, event)
+	}
+	if _, valid, err := service.validateToken(context.Background(), "valid", "10.0.0.2"); err != nil || !valid {
+		t.Fatalf("validateToken = %v, %v, want a valid token", valid, err)
+	}
+
+	if len(recorded) != 1 {
+		t.Fatalf("recorded %d audit events, want 1", len(recorded))
+	}
+	event := recorded[0]
+	if event.ActorID == nil || *event.ActorID != user.ID || event.IP != "10.0.0.2" {
+		t.Errorf("event actor %v from %q, want user %d from 10.0.0.2", event.ActorID, event.IP, user.ID)
+	}
+	if event.Details["previous_ip"] != "10.0.0.1" || event.Details["token_id"] != token.ID {
+		t.Errorf("event details = %v", event.Details)
+	}
+}
+
+func mustCreateToken(t *testing.T, memory *store.Memory, userID int, token, ip string, ttl time.Duration) *store.Token {
+	t.Helper()
+	stored, err := memory.CreateToken(context.Background(), userID, token, ip, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stored
+}
@@ -0,0 +1,512 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"openchamp/server/internal/audit"
+	"openchamp/server/internal/auth"
+	"openchamp/server/internal/metrics"
+	"openchamp/server/internal/moderation"
+	"openchamp/server/internal/store"
+	"openchamp/server/internal/util"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// bcryptCost is the work factor used for password hashes
+	bcryptCost = 12
+	// tokenLifetime is how long a login token stays valid
+	tokenLifetime = 7 * 24 * time.Hour
+)
+
+// hashPassword hashes a new password, timing the work for metrics
+func hashPassword(password string) ([]byte, error) {
+	timer := prometheus.NewTimer(metrics.BcryptDuration.WithLabelValues("hash"))
+	defer timer.ObserveDuration()
+	return bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+}
+
+// comparePassword checks a password against its hash, timing the work for metrics
+func comparePassword(passwordHash, password string) error {
+	timer := prometheus.NewTimer(metrics.BcryptDuration.WithLabelValues("compare"))
+	defer timer.ObserveDuration()
+	return bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password))
+}
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+	ErrUsernameTaken      = errors.New("username already exists")
+	ErrEmailTaken         = errors.New("email already registered")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidChallenge   = errors.New("no pending two-factor challenge, please log in again")
+	ErrInvalidCode        = errors.New("invalid two-factor code")
+	ErrTooManyAttempts    = errors.New("too many invalid codes, please log in again")
+	ErrTwoFactorEnabled   = errors.New("two-factor authentication is already enabled")
+)
+
+// ValidationError is returned when user input is rejected, Message is safe to show to the user
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// BannedError is returned when a banned user tries to log in or use a token
+type BannedError struct {
+	Sanction *moderation.Sanction
+}
+
+func (e *BannedError) Error() string {
+	return "account banned: " + e.Sanction.Reason
+}
+
+// Service implements the account and authentication operations shared by
+// the WebSocket handlers and the REST API
+type Service struct {
+	users     store.UserStore
+	tokens    store.TokenStore
+	sanctions store.SanctionStore
+	twoFactor store.TwoFactorStore
+
+	challenges      map[string]*challenge
+	challengesMutex sync.Mutex
+
+	record func(audit.Event) // Writes audit events, tests replace it to inspect them
+}
+
+// NewService creates the account service. Accounts are read through the
+// stores, the pool is only used to write audit events.
+func NewService(dbPool *pgxpool.Pool, users store.UserStore, tokens store.TokenStore,
+	sanctions store.SanctionStore, twoFactor store.TwoFactorStore) *Service {
+	return &Service{
+		users:      users,
+		tokens:     tokens,
+		sanctions:  sanctions,
+		twoFactor:  twoFactor,
+		challenges: make(map[string]*challenge),
+		record: func(event audit.Event) {
+			audit.Record(dbPool, event)
+		},
+	}
+}
+
+// Session is an authenticated user and their token
+type Session struct {
+	UserID   int
+	Username string
+	Token    string
+}
+
+// LoginResult holds either a session, or a challenge when the account needs a second factor
+type LoginResult struct {
+	Session   *Session
+	Challenge *Challenge
+}
+
+// Profile is the account information a user can see about themselves
+type Profile struct {
+	ID               int        `json:"id"`
+	Username         string     `json:"username"`
+	Email            string     `json:"email,omitempty"`
+	Role             auth.Role  `json:"role"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	LastLogin        *time.Time `json:"lastLogin,omitempty"`
+	TwoFactorEnabled bool       `json:"twoFactorEnabled"`
+	HasPassword      bool       `json:"hasPassword"`
+	LinkedProviders  []string   `json:"linkedProviders"`
+}
+
+func validateUsername(username string) error {
+	if len(username) < 3 {
+		return &ValidationError{"Username must be at least 3 characters"}
+	}
+	return nil
+}
+
+func validatePassword(password string) error {
+	if len(password) < 6 {
+		return &ValidationError{"Password must be at least 6 characters"}
+	}
+	return nil
+}
+
+func validateEmail(email string) error {
+	if email != "" && !util.IsValidEmail(email) {
+		return &ValidationError{"Invalid email format"}
+	}
+	return nil
+}
+
+// Register creates a new account and logs it in. The account and its token
+// are created together, conflicts are reported as ErrUsernameTaken or ErrEmailTaken.
+func (s *Service) Register(ctx context.Context, username, password, email, ip string) (*Session, error) {
+	// Validate input
+	if err := validateUsername(username); err != nil {
+		return nil, err
+	}
+	if err := validatePassword(password); err != nil {
+		return nil, err
+	}
+	if err := validateEmail(email); err != nil {
+		return nil, err
+	}
+
+	// Hash the password using bcrypt
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing password: %w", err)
+	}
+
+	// Insert the user and the token for automatic login, the unique constraints catch taken names
+	user, token, err := s.users.Register(ctx, store.Registration{
+		Username:      username,
+		PasswordHash:  string(passwordHash),
+		Email:         email,
+		Token:         uuid.New().String(),
+		IPAddress:     ip,
+		TokenLifetime: tokenLifetime,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrUsernameTaken):
+			return nil, ErrUsernameTaken
+		case errors.Is(err, store.ErrEmailTaken):
+			return nil, ErrEmailTaken
+		}
+		return nil, fmt.Errorf("error inserting new user: %w", err)
+	}
+	session := &Session{UserID: user.ID, Username: user.Username, Token: token.Token}
+
+	s.record(audit.Event{
+		Type:     audit.EventRegister,
+		ActorID:  &session.UserID,
+		TargetID: &session.UserID,
+		IP:       ip,
+		Details: map[string]interface{}{
+			"username": username,
+		},
+	})
+
+	log.WithFields(log.Fields{
+		"username": username,
+	}).Info("New user registered")
+	return session, nil
+}
+
+// Login checks a username and password. Accounts with two-factor enabled get a challenge instead of a session.
+func (s *Service) Login(ctx context.Context, username, password, ip string) (*LoginResult, error) {
+	user, authenticated, err := s.validateCredentials(ctx, username, password)
+	if err != nil {
+		// An outage is not the user's fault, it must not count towards lockouts
+		return nil, fmt.Errorf("error checking credentials: %w", err)
+	}
+	if !authenticated {
+		userID := 0
+		if user != nil {
+			userID = user.ID
+		}
+		s.recordLoginFailure(userID, username, ip, "invalid_credentials")
+		return nil, ErrInvalidCredentials
+	}
+
+	return s.completeLogin(ctx, user, ip, "password")
+}
+
+// CompleteExternalLogin finishes a login for a user who proved their identity with an external provider
+func (s *Service) CompleteExternalLogin(ctx context.Context, userID int, provider, ip string) (*LoginResult, error) {
+	user, err := s.users.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return s.completeLogin(ctx, user, ip, "oauth:"+provider)
+}
+
+// completeLogin runs the checks shared by every first factor: bans, then two-factor, then the token
+func (s *Service) completeLogin(ctx context.Context, user *store.User, ip, method string) (*LoginResult, error) {
+	// Banned accounts cannot log in
+	if err := s.checkBan(ctx, user.ID, user.Username, ip); err != nil {
+		return nil, err
+	}
+
+	// Accounts with two-factor enabled must pass a challenge before a token is issued
+	if user.TwoFactorEnabled {
+		return &LoginResult{Challenge: s.startChallenge(user.ID, user.Username, method)}, nil
+	}
+
+	session, err := s.issueSession(ctx, user.ID, user.Username, ip, method)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Session: session}, nil
+}
+
+// issueToken creates a new login token for the user bound to the given IP
+func (s *Service) issueToken(ctx context.Context, userID int, ip string) (string, error) {
+	token, err := s.tokens.CreateToken(ctx, userID, uuid.New().String(), ip, tokenLifetime)
+	if err != nil {
+		return "", err
+	}
+
+	// Tracking the last login is best effort, the token is valid either way
+	if err := s.users.TouchLastLogin(ctx, userID); err != nil {
+		log.WithFields(log.Fields{
+			"user_id": userID,
+			"error":   err,
+		}).Error("Error updating last login")
+	}
+	return token.Token, nil
+}
+
+// issueSession creates a token and records the login
+func (s *Service) issueSession(ctx context.Context, userID int, username, ip, method string) (*Session, error) {
+	token, err := s.issueToken(ctx, userID, ip)
+	if err != nil {
+		return nil, fmt.Errorf("error creating token for user %s: %w", username, err)
+	}
+
+	metrics.AuthSuccesses.WithLabelValues(method).Inc()
+	s.record(audit.Event{
+		Type:     audit.EventLogin,
+		ActorID:  &userID,
+		TargetID: &userID,
+		IP:       ip,
+		Details: map[string]interface{}{
+			"method": method,
+		},
+	})
+	return &Session{UserID: userID, Username: username, Token: token}, nil
+}
+
+// checkBan returns a BannedError if the user has an active ban
+func (s *Service) checkBan(ctx context.Context, userID int, username, ip string) error {
+	ban, err := s.sanctions.ActiveSanction(ctx, userID, moderation.SanctionBan)
+	if err != nil {
+		return fmt.Errorf("error checking bans: %w", err)
+	}
+	if ban != nil {
+		s.recordLoginFailure(userID, username, ip, "banned")
+		return &BannedError{Sanction: ban}
+	}
+	return nil
+}
+
+// recordLoginFailure audits a failed login, userID is 0 when the account is unknown
+func (s *Service) recordLoginFailure(userID int, username, ip, reason string) {
+	metrics.AuthFailures.WithLabelValues(reason).Inc()
+	event := audit.Event{
+		Type: audit.EventLoginFailed,
+		IP:   ip,
+		Details: map[string]interface{}{
+			"username": username,
+			"reason":   reason,
+		},
+	}
+	if userID != 0 {
+		event.TargetID = &userID
+	}
+	s.record(event)
+}
+
+// Authenticate resumes a session from a previously issued token and records the login
+func (s *Service) Authenticate(ctx context.Context, token, ip string) (*Session, error) {
+	session, err := s.ValidateToken(ctx, token, ip)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			metrics.AuthFailures.WithLabelValues("invalid_token").Inc()
+		}
+		return nil, err
+	}
+
+	metrics.AuthSuccesses.WithLabelValues("token").Inc()
+	s.record(audit.Event{
+		Type:     audit.EventLogin,
+		ActorID:  &session.UserID,
+		TargetID: &session.UserID,
+		IP:       ip,
+		Details: map[string]interface{}{
+			"method": "token",
+		},
+	})
+	return session, nil
+}
+
+// ValidateToken checks a token for an API request without recording a login
+func (s *Service) ValidateToken(ctx context.Context, token, ip string) (*Session, error) {
+	user, valid, err := s.validateToken(ctx, token, ip)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, ErrInvalidToken
+	}
+
+	// Banned accounts cannot resume their session
+	if err := s.checkBan(ctx, user.ID, user.Username, ip); err != nil {
+		return nil, err
+	}
+	return &Session{UserID: user.ID, Username: user.Username, Token: token}, nil
+}
+
+// Refresh swaps a valid token for a new one and revokes the old token
+func (s *Service) Refresh(ctx context.Context, token, ip string) (*Session, error) {
+	session, err := s.ValidateToken(ctx, token, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	// The old token is revoked first, if issuing the new one fails the user
+	// logs in again rather than being left with two valid tokens
+	if err := s.Logout(ctx, token); err != nil {
+		return nil, err
+	}
+	newToken, err := s.issueToken(ctx, session.UserID, ip)
+	if err != nil {
+		return nil, fmt.Errorf("error creating token for user %s: %w", session.Username, err)
+	}
+
+	session.Token = newToken
+	return session, nil
+}
+
+// Logout revokes a token
+func (s *Service) Logout(ctx context.Context, token string) error {
+	return s.tokens.RevokeToken(ctx, token)
+}
+
+// Profile returns the account details of a user
+func (s *Service) Profile(ctx context.Context, userID int) (*Profile, error) {
+	user, err := s.users.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	profile := Profile{
+		ID:               user.ID,
+		Username:         user.Username,
+		Email:            user.Email,
+		Role:             user.Role,
+		CreatedAt:        user.CreatedAt,
+		LastLogin:        user.LastLogin,
+		TwoFactorEnabled: user.TwoFactorEnabled,
+		HasPassword:      user.PasswordHash != "",
+	}
+
+	profile.LinkedProviders, err = s.users.LinkedProviders(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// UpdateEmail changes the user's email address, an empty email removes it
+func (s *Service) UpdateEmail(ctx context.Context, userID int, email, ip string) (*Profile, error) {
+	if err := validateEmail(email); err != nil {
+		return nil, err
+	}
+
+	if err := s.users.UpdateEmail(ctx, userID, email); err != nil {
+		switch {
+		case errors.Is(err, store.ErrEmailTaken):
+			return nil, ErrEmailTaken
+		case errors.Is(err, store.ErrNotFound):
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	s.record(audit.Event{
+		Type:     audit.EventEmailChange,
+		ActorID:  &userID,
+		TargetID: &userID,
+		IP:       ip,
+	})
+	return s.Profile(ctx, userID)
+}
+
+// ChangePassword sets a new password and revokes every other token of the user.
+// Accounts created through an external provider can set a first password without a current one.
+func (s *Service) ChangePassword(ctx context.Context, userID int, currentPassword, newPassword, keepToken, ip string) error {
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+	if err := s.checkPassword(ctx, userID, currentPassword); err != nil {
+		return err
+	}
+
+	passwordHash, err := hashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %w", err)
+	}
+
+	if err := s.users.UpdatePassword(ctx, userID, string(passwordHash), keepToken); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	s.record(audit.Event{
+		Type:     audit.EventPasswordChange,
+		ActorID:  &userID,
+		TargetID: &userID,
+		IP:       ip,
+	})
+	return nil
+}
+
+// DeleteAccount removes the user and everything that belongs to them
+func (s *Service) DeleteAccount(ctx context.Context, userID int, password, ip string) error {
+	if err := s.checkPassword(ctx, userID, password); err != nil {
+		return err
+	}
+
+	if err := s.users.DeleteUser(ctx, userID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	s.record(audit.Event{
+		Type:     audit.EventAccountDelete,
+		ActorID:  &userID,
+		TargetID: &userID,
+		IP:       ip,
+	})
+	return nil
+}
+
+// checkPassword verifies the user's current password. Accounts without a
+// password, created through an external provider, always pass.
+func (s *Service) checkPassword(ctx context.Context, userID int, password string) error {
+	user, err := s.users.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if user.PasswordHash == "" {
+		return nil
+	}
+	if comparePassword(user.PasswordHash, password) != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"openchamp/server/internal/audit"
+	"openchamp/server/internal/moderation"
+	"openchamp/server/internal/store"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoginFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		username  string
+		password  string
+		failUsers bool
+		wantErr   error
+		wantAudit bool // Whether a failed login is recorded, which counts towards lockouts
+	}{
+		{"unknown user", "nobody", "secret", false, ErrInvalidCredentials, true},
+		{"wrong password", "player", "wrong", false, ErrInvalidCredentials, true},
+		{"store failure", "player", "secret", true, errStoreDown, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := store.NewMemory()
+			hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := memory.CreateUser(context.Background(), "player", string(hash), ""); err != nil {
+				t.Fatal(err)
+			}
+
+			backend := &failingStore{Memory: memory, failUsers: tt.failUsers}
+			service := NewService(nil, backend, backend, backend, backend)
+			var recorded []audit.Event
+			service.record = func(event audit.Event) {
+				recorded = append(recorded, event)
+			}
+
+			_, err = service.Login(context.Background(), tt.username, tt.password, "10.0.0.1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Login() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.failUsers && errors.Is(err, ErrInvalidCredentials) {
+				t.Error("a store failure was reported as invalid credentials")
+			}
+			if audited := len(recorded) == 1 && recorded[0].Type == audit.EventLoginFailed; audited != tt.wantAudit || len(recorded) > 1 {
+				t.Errorf("recorded %v, want a failed login recorded: %v", recorded, tt.wantAudit)
+			}
+		})
+	}
+}
+
+// newLoginService returns a service on a memory store holding "player" with password "secret"
+func newLoginService(t *testing.T) (*Service, *store.Memory, *store.User, *[]audit.Event) {
+	t.Helper()
+	memory := store.NewMemory()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := memory.CreateUser(context.Background(), "player", string(hash), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewService(nil, memory, memory, memory, memory)
+	recorded := &[]audit.Event{}
+	service.record = func(event audit.Event) {
+		*recorded = append(*recorded, event)
+	}
+	return service, memory, user, recorded
+}
+
+func TestLoginSucceeds(t *testing.T) {
+	service, memory, user, recorded := newLoginService(t)
+
+	result, err := service.Login(context.Background(), "player", "secret", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if result.Challenge != nil || result.Session == nil || result.Session.UserID != user.ID {
+		t.Fatalf("Login() = %+v, want a session for user %d", result, user.ID)
+	}
+	if _, err := memory.ActiveToken(context.Background(), result.Session.Token); err != nil {
+		t.Errorf("issued token is not active: %v", err)
+	}
+	if len(*recorded) != 1 || (*recorded)[0].Type != audit.EventLogin {
+		t.Errorf("recorded %v, want one login", *recorded)
+	}
+
+	session, err := service.Authenticate(context.Background(), result.Session.Token, "10.0.0.1")
+	if err != nil || session.UserID != user.ID {
+		t.Errorf("Authenticate() = %+v, %v, want the logged in user", session, err)
+	}
+}
+
+func TestLoginBanned(t *testing.T) {
+	service, memory, user, recorded := newLoginService(t)
+	ctx := context.Background()
+
+	// An expired ban does not stop a login
+	expired := time.Now().Add(-time.Hour)
+	memory.AddSanction(moderation.Sanction{
+		UserID:    user.ID,
+		Type:      moderation.SanctionBan,
+		Reason:    "old",
+		StartsAt:  time.Now().Add(-2 * time.Hour),
+		ExpiresAt: &expired,
+	})
+	result, err := service.Login(ctx, "player", "secret", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Login() with an expired ban error = %v", err)
+	}
+	token := result.Session.Token
+
+	memory.AddSanction(moderation.Sanction{
+		UserID:   user.ID,
+		Type:     moderation.SanctionBan,
+		Reason:   "cheating",
+		StartsAt: time.Now().Add(-time.Minute),
+	})
+	*recorded = nil
+	var banned *BannedError
+	if _, err := service.Login(ctx, "player", "secret", "10.0.0.1"); !errors.As(err, &banned) || banned.Sanction.Reason != "cheating" {
+		t.Fatalf("Login() error = %v, want the active ban", err)
+	}
+	if len(*recorded) != 1 || (*recorded)[0].Details["reason"] != "banned" {
+		t.Errorf("recorded %v, want a failed login for the ban", *recorded)
+	}
+
+	// A session from before the ban can not be resumed either
+	if _, err := service.Authenticate(ctx, token, "10.0.0.1"); !errors.As(err, &banned) {
+		t.Errorf("Authenticate() error = %v, want the active ban", err)
+	}
+}
+
+func TestLoginTwoFactorChallenge(t *testing.T) {
+	service, memory, user, _ := newLoginService(t)
+	ctx := context.Background()
+
+	enrolment, err := service.EnrollTwoFactor(ctx, user.ID, user.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Confirming needs a code from an authenticator app, enable it directly
+	if err := memory.EnableTwoFactor(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := service.Login(ctx, "player", "secret", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if result.Session != nil || result.Challenge == nil {
+		t.Fatalf("Login() = %+v, want only a challenge", result)
+	}
+
+	if _, err := service.VerifyChallenge(ctx, result.Challenge.ID, "", "not-a-code", "10.0.0.1"); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("VerifyChallenge() with a wrong recovery code = %v, want ErrInvalidCode", err)
+	}
+	session, err := service.VerifyChallenge(ctx, result.Challenge.ID, "", enrolment.RecoveryCodes[0], "10.0.0.1")
+	if err != nil || session.UserID != user.ID {
+		t.Fatalf("VerifyChallenge() = %+v, %v, want a session", session, err)
+	}
+
+	// Recovery codes only work once
+	result, err = service.Login(ctx, "player", "secret", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.VerifyChallenge(ctx, result.Challenge.ID, "", enrolment.RecoveryCodes[0], "10.0.0.1"); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("VerifyChallenge() with a used recovery code = %v, want ErrInvalidCode", err)
+	}
+}
+
+func TestLoginWithoutPassword(t *testing.T) {
+	memory := store.NewMemory()
+	// Accounts created through an external provider store an empty hash
+	if _, err := memory.CreateUser(context.Background(), "player", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	service := NewService(nil, memory, memory, memory, memory)
+	var recorded []audit.Event
+	service.record = func(event audit.Event) {
+		recorded = append(recorded, event)
+	}
+
+	for _, password := range []string{"", "secret"} {
+		if _, err := service.Login(context.Background(), "player", password, "10.0.0.1"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Login() with password %q = %v, want ErrInvalidCredentials", password, err)
+		}
+	}
+	if len(recorded) != 2 || recorded[0].Details["reason"] != "invalid_credentials" {
+		t.Errorf("recorded %v, want two failed logins", recorded)
+	}
+}
@@ -0,0 +1,154 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"openchamp/server/internal/audit"
+	"openchamp/server/internal/auth"
+	"openchamp/server/internal/store"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Enrolment is returned once when a user starts two-factor enrolment
+type Enrolment struct {
+	Secret          string   `json:"secret"`
+	ProvisioningURI string   `json:"provisioningUri"`
+	RecoveryCodes   []string `json:"recoveryCodes"`
+}
+
+// EnrollTwoFactor generates a new secret and recovery codes for the user.
+// 2FA is not active until the user confirms a code from their authenticator app.
+func (s *Service) EnrollTwoFactor(ctx context.Context, userID int, username string) (*Enrolment, error) {
+	user, err := s.users.UserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error checking two-factor status: %w", err)
+	}
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	recoveryCodes, err := auth.GenerateRecoveryCodes(auth.RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodeHashes := make([]string, len(recoveryCodes))
+	for i, code := range recoveryCodes {
+		recoveryCodeHashes[i] = auth.HashRecoveryCode(code)
+	}
+	if err := s.twoFactor.SaveTwoFactorEnrolment(ctx, userID, secret, recoveryCodeHashes); err != nil {
+		return nil, fmt.Errorf("error storing two-factor enrolment: %w", err)
+	}
+
+	return &Enrolment{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(secret, username),
+		RecoveryCodes:   recoveryCodes,
+	}, nil
+}
+
+// checkTOTP validates a code for the user. When requireEnabled is set the
+// code is only accepted for accounts that completed enrolment.
+func (s *Service) checkTOTP(ctx context.Context, userID int, code string, requireEnabled bool) (bool, error) {
+	secret, enabled, err := s.twoFactor.TwoFactorSecret(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if secret == "" || (requireEnabled && !enabled) {
+		return false, nil
+	}
+
+	step, ok := auth.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	// Each code can only be used once
+	return s.twoFactor.ClaimTOTPStep(ctx, userID, step)
+}
+
+// ConfirmTwoFactor activates two-factor once the user proves their app generates valid codes
+func (s *Service) ConfirmTwoFactor(ctx context.Context, userID int, code, ip string) error {
+	valid, err := s.checkTOTP(ctx, userID, code, false)
+	if err != nil {
+		return fmt.Errorf("error during two-factor confirmation: %w", err)
+	}
+	if !valid {
+		return ErrInvalidCode
+	}
+
+	if err := s.twoFactor.EnableTwoFactor(ctx, userID); err != nil {
+		return fmt.Errorf("error enabling two-factor: %w", err)
+	}
+
+	s.record(audit.Event{
+		Type:     audit.EventTwoFactorEnable,
+		ActorID:  &userID,
+		TargetID: &userID,
+		IP:       ip,
+	})
+	log.WithFields(log.Fields{
+		"user_id": userID,
+	}).Info("Two-factor authentication enabled")
+	return nil
+}
+
+// DisableTwoFactor turns off two-factor after checking a current code
+func (s *Service) DisableTwoFactor(ctx context.Context, userID int, code, ip string) error {
+	valid, err := s.checkTOTP(ctx, userID, code, true)
+	if err != nil {
+		return fmt.Errorf("error during two-factor disable: %w", err)
+	}
+	if !valid {
+		return ErrInvalidCode
+	}
+
+	if err := s.twoFactor.ClearTwoFactor(ctx, userID); err != nil {
+		return fmt.Errorf("error disabling two-factor: %w", err)
+	}
+
+	s.record(audit.Event{
+		Type:     audit.EventTwoFactorDisable,
+		ActorID:  &userID,
+		TargetID: &userID,
+		IP:       ip,
+	})
+	return nil
+}
+
+// ResetTwoFactor disables two-factor authentication for a user and removes
+// their secret and recovery codes. Used by admins for locked-out players.
+func (s *Service) ResetTwoFactor(ctx context.Context, username string, adminID *int, ip string) error {
+	user, err := s.users.UserByUsername(ctx, username)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	userID := user.ID
+
+	if err := s.twoFactor.ClearTwoFactor(ctx, userID); err != nil {
+		return fmt.Errorf("failed to reset two-factor for %s: %w", username, err)
+	}
+
+	s.record(audit.Event{
+		Type:     audit.EventTwoFactorReset,
+		ActorID:  adminID,
+		TargetID: &userID,
+		IP:       ip,
+		Details: map[string]interface{}{
+			"username": username,
+		},
+	})
+	log.WithFields(log.Fields{
+		"username": username,
+	}).Info("Two-factor authentication reset")
+	return nil
+}
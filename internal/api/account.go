@@ -0,0 +1,369 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"openchamp/server/internal/account"
+	"openchamp/server/internal/moderation"
+	"openchamp/server/internal/websocket"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// accounts is the account service shared with the WebSocket server
+var accounts *account.Service
+
+func setupAccountRoutes() {
+	handle("POST /auth/register", handleRegister)
+	handle("POST /auth/login", handleLogin)
+	handle("POST /auth/2fa/verify", handleLoginChallengeVerify)
+	handle("POST /auth/refresh", handleRefresh)
+	handle("POST /auth/logout", requireUser(handleLogout))
+
+	handle("GET /account", requireUser(handleGetAccount))
+	handle("PATCH /account", requireUser(handleUpdateAccount))
+	handle("DELETE /account", requireUser(handleDeleteAccount))
+	handle("POST /account/password", requireUser(handleChangePassword))
+	handle("POST /account/2fa/enroll", requireUser(handleTwoFactorEnroll))
+	handle("POST /account/2fa/confirm", requireUser(handleTwoFactorConfirm))
+	handle("POST /account/2fa/disable", requireUser(handleTwoFactorDisable))
+}
+
+// bearerToken returns the token from a bearer Authorization header
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	return strings.TrimPrefix(header, "Bearer ")
+}
+
+// requireUser only runs next for requests with a valid user token in the Authorization header
+func requireUser(next func(http.ResponseWriter, *http.Request, *account.Session)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			writeError(w, http.StatusUnauthorized, "unauthenticated", "A login token is required")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		session, err := accounts.ValidateToken(ctx, token, remoteIP(r))
+		if err != nil {
+			writeServiceError(w, r, err, "Authentication failed due to a server error")
+			return
+		}
+		next(w, withLogField(r, "user_id", session.UserID), session)
+	}
+}
+
+// decodeJSON reads the request body into v, writing a 400 response if it is not valid JSON
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "The request body is not valid JSON")
+		return false
+	}
+	return true
+}
+
+func handleRegister(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Email    string `json:"email"`
+	}
+	if !decodeJSON(w, r, &request) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	session, err := accounts.Register(ctx, request.Username, request.Password, request.Email, remoteIP(r))
+	if err != nil {
+		writeServiceError(w, r, err, "Registration failed due to a server error")
+		return
+	}
+
+	writeSession(w, http.StatusCreated, session)
+}
+
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if !decodeJSON(w, r, &request) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	result, err := accounts.Login(ctx, request.Username, request.Password, remoteIP(r))
+	if err != nil {
+		writeServiceError(w, r, err, "Login failed due to a server error")
+		return
+	}
+	writeLoginResult(w, http.StatusOK, result)
+}
+
+func handleLoginChallengeVerify(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Challenge    string `json:"challenge"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if !decodeJSON(w, r, &request) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	session, err := accounts.VerifyChallenge(ctx, request.Challenge, request.Code, request.RecoveryCode, remoteIP(r))
+	if err != nil {
+		writeServiceError(w, r, err, "Verification failed due to a server error")
+		return
+	}
+	writeSession(w, http.StatusOK, session)
+}
+
+func handleRefresh(w http.ResponseWriter, r *http.Request) {
+	token := bearerToken(r)
+	if token == "" {
+		writeError(w, http.StatusUnauthorized, "unauthenticated", "A login token is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	session, err := accounts.Refresh(ctx, token, remoteIP(r))
+	if err != nil {
+		writeServiceError(w, r, err, "Refreshing the token failed due to a server error")
+		return
+	}
+	writeSession(w, http.StatusOK, session)
+}
+
+func handleLogout(w http.ResponseWriter, r *http.Request, session *account.Session) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := accounts.Logout(ctx, session.Token); err != nil {
+		writeServiceError(w, r, err, "Logout failed due to a server error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleGetAccount(w http.ResponseWriter, r *http.Request, session *account.Session) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	profile, err := accounts.Profile(ctx, session.UserID)
+	if err != nil {
+		writeServiceError(w, r, err, "Loading the account failed due to a server error")
+		return
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
+
+func handleUpdateAccount(w http.ResponseWriter, r *http.Request, session *account.Session) {
+	var request struct {
+		Email *string `json:"email"`
+	}
+	if !decodeJSON(w, r, &request) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Email is the only editable field for now, so an empty patch just returns the profile
+	if request.Email == nil {
+		handleGetAccount(w, r, session)
+		return
+	}
+
+	profile, err := accounts.UpdateEmail(ctx, session.UserID, *request.Email, remoteIP(r))
+	if err != nil {
+		writeServiceError(w, r, err, "Updating the account failed due to a server error")
+		return
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
+
+func handleChangePassword(w http.ResponseWriter, r *http.Request, session *account.Session) {
+	var request struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if !decodeJSON(w, r, &request) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := accounts.ChangePassword(ctx, session.UserID, request.CurrentPassword, request.NewPassword,
+		session.Token, remoteIP(r))
+	if err != nil {
+		writeServiceError(w, r, err, "Changing the password failed due to a server error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleDeleteAccount(w http.ResponseWriter, r *http.Request, session *account.Session) {
+	var request struct {
+		Password string `json:"password"`
+	}
+	if !decodeJSON(w, r, &request) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := accounts.DeleteAccount(ctx, session.UserID, request.Password, remoteIP(r)); err != nil {
+		writeServiceError(w, r, err, "Deleting the account failed due to a server error")
+		return
+	}
+
+	websocket.DisconnectUser(session.UserID, "account_deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleTwoFactorEnroll(w http.ResponseWriter, r *http.Request, session *account.Session) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	enrolment, err := accounts.EnrollTwoFactor(ctx, session.UserID, session.Username)
+	if err != nil {
+		writeServiceError(w, r, err, "Enrolment failed due to a server error")
+		return
+	}
+	writeJSON(w, http.StatusOK, enrolment)
+}
+
+func handleTwoFactorConfirm(w http.ResponseWriter, r *http.Request, session *account.Session) {
+	var request struct {
+		Code string `json:"code"`
+	}
+	if !decodeJSON(w, r, &request) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := accounts.ConfirmTwoFactor(ctx, session.UserID, request.Code, remoteIP(r)); err != nil {
+		writeServiceError(w, r, err, "Confirmation failed due to a server error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleTwoFactorDisable(w http.ResponseWriter, r *http.Request, session *account.Session) {
+	var request struct {
+		Code string `json:"code"`
+	}
+	if !decodeJSON(w, r, &request) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := accounts.DisableTwoFactor(ctx, session.UserID, request.Code, remoteIP(r)); err != nil {
+		writeServiceError(w, r, err, "Disabling two-factor failed due to a server error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeSession(w http.ResponseWriter, status int, session *account.Session) {
+	writeJSON(w, status, map[string]interface{}{
+		"status":   "ok",
+		"username": session.Username,
+		"token":    session.Token,
+	})
+}
+
+// writeLoginResult writes the session, or the two-factor challenge the client has to answer next
+func writeLoginResult(w http.ResponseWriter, status int, result *account.LoginResult) {
+	if result.Challenge == nil {
+		writeSession(w, status, result.Session)
+		return
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"status":    "2fa_required",
+		"challenge": result.Challenge.ID,
+		"username":  result.Challenge.Username,
+		"methods":   result.Challenge.Methods,
+		"expiresAt": result.Challenge.ExpiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// writeServiceError maps an account service error onto a status code and error body.
+// Unknown errors are logged and replaced by the fallback message.
+func writeServiceError(w http.ResponseWriter, r *http.Request, err error, fallback string) {
+	var (
+		validationErr *account.ValidationError
+		bannedErr     *account.BannedError
+	)
+	switch {
+	case errors.As(err, &validationErr):
+		writeError(w, http.StatusBadRequest, "invalid_request", validationErr.Message)
+	case errors.As(err, &bannedErr):
+		writeBanned(w, bannedErr.Sanction)
+	case errors.Is(err, account.ErrInvalidCredentials):
+		writeError(w, http.StatusUnauthorized, "invalid_credentials", "Invalid username or password")
+	case errors.Is(err, account.ErrInvalidToken):
+		writeError(w, http.StatusUnauthorized, "unauthenticated", "Invalid or expired token")
+	case errors.Is(err, account.ErrUsernameTaken):
+		writeError(w, http.StatusConflict, "username_taken", "Username already exists")
+	case errors.Is(err, account.ErrEmailTaken):
+		writeError(w, http.StatusConflict, "email_taken", "Email already registered")
+	case errors.Is(err, account.ErrUserNotFound):
+		writeError(w, http.StatusNotFound, "user_not_found", "Unknown user")
+	case errors.Is(err, account.ErrInvalidChallenge):
+		writeError(w, http.StatusUnauthorized, "invalid_challenge", "No pending two-factor challenge, please log in again")
+	case errors.Is(err, account.ErrInvalidCode):
+		writeError(w, http.StatusUnauthorized, "invalid_code", "Invalid two-factor code")
+	case errors.Is(err, account.ErrTooManyAttempts):
+		writeError(w, http.StatusTooManyRequests, "too_many_attempts", "Too many invalid codes, please log in again")
+	case errors.Is(err, account.ErrTwoFactorEnabled):
+		writeError(w, http.StatusConflict, "2fa_already_enabled", "Two-factor authentication is already enabled")
+	case errors.Is(err, moderation.ErrOutranked):
+		writeError(w, http.StatusForbidden, "outranked", "You cannot sanction a user whose role is equal to or above yours")
+	default:
+		requestLog(r).WithFields(log.Fields{
+			"error": err,
+		}).Error(fallback)
+		writeError(w, http.StatusInternalServerError, "server_error", fallback)
+	}
+}
+
+func writeBanned(w http.ResponseWriter, ban *moderation.Sanction) {
+	body := map[string]interface{}{
+		"code":      "account_banned",
+		"message":   "Your account has been banned: " + ban.Reason,
+		"reason":    ban.Reason,
+		"permanent": ban.ExpiresAt == nil,
+	}
+	if ban.ExpiresAt != nil {
+		body["expiresAt"] = ban.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	writeJSON(w, http.StatusForbidden, map[string]interface{}{
+		"error": body,
+	})
+}
@@ -0,0 +1,472 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"openchamp/server/internal/audit"
+	"openchamp/server/internal/auth"
+	"openchamp/server/internal/logging"
+	"openchamp/server/internal/moderation"
+	"openchamp/server/internal/websocket"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// adminActor is whoever called an admin endpoint, either a staff member or a service account
+type adminActor struct {
+	UserID           *int
+	ServiceAccountID int
+	Name             string
+}
+
+// details adds the service account to audit details, user actors are recorded as the event actor
+func (a *adminActor) details(details map[string]interface{}) map[string]interface{} {
+	if a.ServiceAccountID != 0 {
+		details["service_account_id"] = a.ServiceAccountID
+	}
+	return details
+}
+
+func setupAdminRoutes() {
+	handle("GET /admin/clients", requireAdmin(auth.PermUsersManage, handleAdminListClients))
+	handle("POST /admin/kick", requireAdmin(auth.PermUsersManage, handleAdminKick))
+	handle("POST /admin/broadcast", requireAdmin(auth.PermServerBroadcast, handleAdminBroadcast))
+	handle("POST /admin/sanctions", requireAdmin(auth.PermSanctionsIssue, handleAdminIssueSanction))
+	handle("DELETE /admin/sanctions/{id}", requireAdmin(auth.PermSanctionsIssue, handleAdminRevokeSanction))
+	handle("PUT /admin/log-level", requireAdmin(auth.PermServerManage, handleAdminSetLogLevel))
+	handle("GET /admin/chat/flags", requireAdmin(auth.PermSanctionsIssue, handleAdminListChatFlags))
+	handle("POST /admin/chat/flags/{id}/review", requireAdmin(auth.PermSanctionsIssue, handleAdminReviewChatFlag))
+	handle("GET /admin/reports", requireAdmin(auth.PermSanctionsIssue, handleAdminListReports))
+	handle("POST /admin/reports/{id}/resolve", requireAdmin(auth.PermSanctionsIssue, handleAdminResolveReport))
+}
+
+// requireAdmin only runs next for a user token whose role grants the permission,
+// or an API key with the permission as a scope
+func requireAdmin(permission auth.Permission, next func(http.ResponseWriter, *http.Request, *adminActor)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		credential := apiKeyFromRequest(r)
+		if credential == "" {
+			writeError(w, http.StatusUnauthorized, "unauthenticated", "A login token or API key is required")
+			return
+		}
+		if _, isKey := auth.ParseAPIKey(credential); isKey {
+			requirePermission(permission, func(w http.ResponseWriter, r *http.Request) {
+				principal := principalFromRequest(r)
+				next(w, r, &adminActor{ServiceAccountID: principal.ServiceAccountID, Name: principal.Name})
+			})(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		session, err := accounts.ValidateToken(ctx, credential, remoteIP(r))
+		if err != nil {
+			writeServiceError(w, r, err, "Authentication failed due to a server error")
+			return
+		}
+		_, permissions, err := auth.LoadUserPermissions(ctx, dbPool, session.UserID)
+		if err != nil {
+			requestLog(r).WithFields(log.Fields{
+				"error": err,
+			}).Error("Error loading permissions")
+			writeError(w, http.StatusInternalServerError, "server_error", "Authentication failed due to a server error")
+			return
+		}
+		if !permissions.Has(permission) {
+			writeError(w, http.StatusForbidden, "permission_denied", "You do not have permission to do that")
+			return
+		}
+		userID := session.UserID
+		next(w, withLogField(r, "user_id", userID), &adminActor{UserID: &userID, Name: session.Username})
+	}
+}
+
+func handleAdminListClients(w http.ResponseWriter, r *http.Request, actor *adminActor) {
+	clients := websocket.ConnectedClients()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"clients": clients,
+		"count":   len(clients),
+	})
+}
+
+func handleAdminKick(w http.ResponseWriter, r *http.Request, actor *adminActor) {
+	var request struct {
+		ClientID string `json:"client_id"`
+		UserID   int    `json:"user_id"`
+		Reason   string `json:"reason"`
+	}
+	if !decodeJSON(w, r, &request) {
+		return
+	}
+	if (request.ClientID == "") == (request.UserID == 0) {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Exactly one of client_id and user_id is required")
+		return
+	}
+	if request.Reason == "" {
+		request.Reason = "kicked"
+	}
+
+	// Staff can only be kicked by someone who outranks them
+	targetID := request.UserID
+	for _, client := range websocket.ConnectedClients() {
+		if request.ClientID != "" && client.ID == request.ClientID {
+			targetID = client.UserID
+		}
+	}
+	if targetID != 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		if err := moderation.CheckRank(ctx, dbPool, actor.UserID, targetID); err != nil {
+			writeServiceError(w, r, err, "Kicking failed due to a server error")
+			return
+		}
+	}
+
+	var disconnected int
+	if request.ClientID != "" {
+		if websocket.DisconnectClient(request.ClientID, request.Reason) {
+			disconnected = 1
+		}
+	} else {
+		disconnected = websocket.DisconnectUser(request.UserID, request.Reason)
+	}
+	if disconnected == 0 {
+		writeError(w, http.StatusNotFound, "not_connected", "No matching client is connected")
+		return
+	}
+
+	// A kick by client ID is recorded against the user it was connected as
+	var target *int
+	if targetID != 0 {
+		target = &targetID
+	}
+	audit.Record(dbPool, audit.Event{
+		Type:     audit.EventClientKick,
+		ActorID:  actor.UserID,
+		TargetID: target,
+		IP:       remoteIP(r),
+		Details: actor.details(map[string]interface{}{
+			"client_id": request.ClientID,
+			"reason":    request.Reason,
+		}),
+	})
+	requestLog(r).WithFields(log.Fields{
+		"actor":        actor.Name,
+		"disconnected": disconnected,
+		"reason":       request.Reason,
+	}).Info("Clients kicked")
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"disconnected": disconnected,
+	})
+}
+
+func handleAdminBroadcast(w http.ResponseWriter, r *http.Request, actor *adminActor) {
+	var request struct {
+		Message string `json:"message"`
+	}
+	if !decodeJSON(w, r, &request) {
+		return
+	}
+	message := strings.TrimSpace(request.Message)
+	if message == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "message is required")
+		return
+	}
+
+	websocket.Announce(message)
+
+	audit.Record(dbPool, audit.Event{
+		Type:    audit.EventBroadcast,
+		ActorID: actor.UserID,
+		IP:      remoteIP(r),
+		Details: actor.details(map[string]interface{}{
+			"message": message,
+		}),
+	})
+	requestLog(r).WithFields(log.Fields{
+		"actor":   actor.Name,
+		"message": message,
+	}).Info("Broadcast sent")
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"recipients": websocket.GetConnectedClientsCount(),
+	})
+}
+
+func handleAdminIssueSanction(w http.ResponseWriter, r *http.Request, actor *adminActor) {
+	var request struct {
+		Username        string `json:"username"`
+		Type            string `json:"type"`
+		Reason          string `json:"reason"`
+		DurationMinutes int    `json:"duration_minutes"` // 0 for permanent
+	}
+	if !decodeJSON(w, r, &request) {
+		return
+	}
+	sanctionType := moderation.SanctionType(request.Type)
+	switch {
+	case request.Username == "":
+		writeError(w, http.StatusBadRequest, "invalid_request", "username is required")
+		return
+	case !sanctionType.IsValid():
+		writeError(w, http.StatusBadRequest, "invalid_request", "Unknown sanction type: "+request.Type)
+		return
+	case request.Reason == "":
+		writeError(w, http.StatusBadRequest, "invalid_request", "A reason is required")
+		return
+	case request.DurationMinutes < 0:
+		writeError(w, http.StatusBadRequest, "invalid_request", "Duration cannot be negative")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := accounts.UserByUsername(ctx, request.Username)
+	if err != nil {
+		writeServiceError(w, r, err, "Issuing sanction failed due to a server error")
+		return
+	}
+
+	// Banned players are disconnected right away
+	sanction, err := websocket.IssueSanction(dbPool, user.ID, sanctionType, request.Reason, actor.UserID,
+		time.Duration(request.DurationMinutes)*time.Minute)
+	if err != nil {
+		writeServiceError(w, r, err, "Issuing sanction failed due to a server error")
+		return
+	}
+
+	payload := sanction.Payload()
+	payload["username"] = user.Username
+	writeJSON(w, http.StatusCreated, payload)
+}
+
+func handleAdminRevokeSanction(w http.ResponseWriter, r *http.Request, actor *adminActor) {
+	sanctionID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || sanctionID <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request", "The sanction id must be a positive number")
+		return
+	}
+
+	revoked, err := websocket.RevokeSanction(dbPool, sanctionID, actor.UserID)
+	if err != nil {
+		writeServiceError(w, r, err, "Revoking sanction failed due to a server error")
+		return
+	}
+	if !revoked {
+		writeError(w, http.StatusNotFound, "sanction_not_found", "Sanction not found or already revoked")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleAdminSetLogLevel(w http.ResponseWriter, r *http.Request, actor *adminActor) {
+	var request struct {
+		Level string `json:"level"`
+	}
+	if !decodeJSON(w, r, &request) {
+		return
+	}
+	if err := logging.SetLevel(request.Level); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "level must be one of debug, info, warn or error")
+		return
+	}
+
+	audit.Record(dbPool, audit.Event{
+		Type:    audit.EventLogLevelChange,
+		ActorID: actor.UserID,
+		IP:      remoteIP(r),
+		Details: actor.details(map[string]interface{}{
+			"level": request.Level,
+		}),
+	})
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"level": request.Level,
+	})
+}
+
+func handleAdminListChatFlags(w http.ResponseWriter, r *http.Request, actor *adminActor) {
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			writeError(w, http.StatusBadRequest, "invalid_request", "limit must be between 1 and 500")
+			return
+		}
+		limit = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	flags, err := moderation.PendingChatFlags(ctx, dbPool, limit)
+	if err != nil {
+		writeServiceError(w, r, err, "Loading flagged messages failed due to a server error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"flags": flags,
+		"count": len(flags),
+	})
+}
+
+func handleAdminReviewChatFlag(w http.ResponseWriter, r *http.Request, actor *adminActor) {
+	violationID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || violationID <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request", "The flag id must be a positive number")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID, reviewed, err := moderation.ReviewChatFlag(ctx, dbPool, violationID, actor.UserID)
+	if err != nil {
+		writeServiceError(w, r, err, "Reviewing the flagged message failed due to a server error")
+		return
+	}
+	if !reviewed {
+		writeError(w, http.StatusNotFound, "flag_not_found", "Flagged message not found or already reviewed")
+		return
+	}
+
+	audit.Record(dbPool, audit.Event{
+		Type:     audit.EventChatFlagReview,
+		ActorID:  actor.UserID,
+		TargetID: &userID,
+		IP:       remoteIP(r),
+		Details: actor.details(map[string]interface{}{
+			"violation_id": violationID,
+		}),
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleAdminListReports(w http.ResponseWriter, r *http.Request, actor *adminActor) {
+	status := moderation.ReportOpen
+	if value := r.URL.Query().Get("status"); value != "" {
+		status = moderation.ReportStatus(value)
+	}
+	switch status {
+	case moderation.ReportOpen, moderation.ReportDismissed, moderation.ReportActioned:
+	default:
+		writeError(w, http.StatusBadRequest, "invalid_request", "status must be one of open, dismissed or actioned")
+		return
+	}
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 500 {
+			writeError(w, http.StatusBadRequest, "invalid_request", "limit must be between 1 and 500")
+			return
+		}
+		limit = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	reports, err := moderation.Reports(ctx, dbPool, status, limit)
+	if err != nil {
+		writeServiceError(w, r, err, "Loading reports failed due to a server error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"reports": reports,
+		"count":   len(reports),
+	})
+}
+
+func handleAdminResolveReport(w http.ResponseWriter, r *http.Request, actor *adminActor) {
+	reportID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || reportID <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid_request", "The report id must be a positive number")
+		return
+	}
+	var request struct {
+		Note     string `json:"note"`
+		Sanction *struct {
+			Type            string `json:"type"`
+			Reason          string `json:"reason"`
+			DurationMinutes int    `json:"duration_minutes"` // 0 for permanent
+		} `json:"sanction"` // Omitted to dismiss the report
+	}
+	if !decodeJSON(w, r, &request) {
+		return
+	}
+	if request.Sanction != nil {
+		switch {
+		case !moderation.SanctionType(request.Sanction.Type).IsValid():
+			writeError(w, http.StatusBadRequest, "invalid_request", "Unknown sanction type: "+request.Sanction.Type)
+			return
+		case request.Sanction.Reason == "":
+			writeError(w, http.StatusBadRequest, "invalid_request", "A sanction reason is required")
+			return
+		case request.Sanction.DurationMinutes < 0:
+			writeError(w, http.StatusBadRequest, "invalid_request", "Duration cannot be negative")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	report, err := moderation.OpenReport(ctx, dbPool, reportID)
+	if errors.Is(err, moderation.ErrReportNotFound) {
+		writeError(w, http.StatusNotFound, "report_not_found", "Report not found or already resolved")
+		return
+	}
+	if err != nil {
+		writeServiceError(w, r, err, "Resolving the report failed due to a server error")
+		return
+	}
+
+	var sanctionID *int
+	if request.Sanction != nil {
+		sanction, err := websocket.IssueSanction(dbPool, report.ReportedID, moderation.SanctionType(request.Sanction.Type),
+			request.Sanction.Reason, actor.UserID, time.Duration(request.Sanction.DurationMinutes)*time.Minute)
+		if err != nil {
+			writeServiceError(w, r, err, "Issuing sanction failed due to a server error")
+			return
+		}
+		sanctionID = &sanction.ID
+	}
+
+	status, err := moderation.ResolveReport(ctx, dbPool, reportID, actor.UserID, request.Note, sanctionID)
+	if errors.Is(err, moderation.ErrReportNotFound) {
+		// Another moderator resolved it first, the sanction stands on its own
+		writeError(w, http.StatusNotFound, "report_not_found", "Report not found or already resolved")
+		return
+	}
+	if err != nil {
+		writeServiceError(w, r, err, "Resolving the report failed due to a server error")
+		return
+	}
+
+	audit.Record(dbPool, audit.Event{
+		Type:     audit.EventReportResolve,
+		ActorID:  actor.UserID,
+		TargetID: &report.ReportedID,
+		IP:       remoteIP(r),
+		Details: actor.details(map[string]interface{}{
+			"report_id":   reportID,
+			"status":      status,
+			"sanction_id": sanctionID,
+		}),
+	})
+	if status == moderation.ReportActioned && report.ReporterID != nil {
+		websocket.NotifyReportActioned(dbPool, *report.ReporterID, reportID)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":          reportID,
+		"status":      status,
+		"sanction_id": sanctionID,
+	})
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"openchamp/server/internal/audit"
+	"openchamp/server/internal/auth"
+	"openchamp/server/internal/metrics"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type contextKey string
+
+const principalKey contextKey = "principal"
+
+// apiKeyFromRequest reads the key from the X-API-Key header or a bearer Authorization header
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return ""
+}
+
+// requirePermission only runs next for requests with a valid API key that has the permission.
+// An empty permission accepts any valid key.
+func requirePermission(permission auth.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := apiKeyFromRequest(r)
+		if key == "" {
+			writeError(w, http.StatusUnauthorized, "unauthenticated", "An API key is required")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		principal, err := auth.AuthenticateAPIKey(ctx, dbPool, key)
+		if err != nil {
+			if !errors.Is(err, auth.ErrInvalidAPIKey) {
+				requestLog(r).WithFields(log.Fields{
+					"error": err,
+				}).Error("Database error during API key auth")
+				writeError(w, http.StatusInternalServerError, "server_error", "Authentication failed due to a server error")
+				return
+			}
+			metrics.AuthFailures.WithLabelValues("invalid_api_key").Inc()
+			audit.Record(dbPool, audit.Event{
+				Type: audit.EventLoginFailed,
+				IP:   remoteIP(r),
+				Details: map[string]interface{}{
+					"reason": "invalid_api_key",
+					"path":   r.URL.Path,
+				},
+			})
+			writeError(w, http.StatusUnauthorized, "unauthenticated", "Invalid or revoked API key")
+			return
+		}
+
+		if permission != "" && !principal.Permissions.Has(permission) {
+			writeError(w, http.StatusForbidden, "permission_denied", "This API key does not have the "+string(permission)+" scope")
+			return
+		}
+
+		r = withLogField(r, "service_account_id", principal.ServiceAccountID)
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey, principal)))
+	}
+}
+
+// principalFromRequest returns the service principal set by requirePermission
+func principalFromRequest(r *http.Request) *auth.ServicePrincipal {
+	principal, _ := r.Context().Value(principalKey).(*auth.ServicePrincipal)
+	return principal
+}
+
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+		},
+	})
+}
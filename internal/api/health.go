@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"openchamp/server/internal/database"
+	"openchamp/server/internal/version"
+	"openchamp/server/internal/websocket"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// readinessTimeout bounds how long a single readiness check may take
+const readinessTimeout = 2 * time.Second
+
+// ReadinessCheck reports an error when a subsystem can not serve traffic
+type ReadinessCheck func(ctx context.Context) error
+
+var (
+	startedAt = time.Now()
+
+	readinessChecks      = make(map[string]ReadinessCheck)
+	readinessChecksMutex sync.RWMutex
+)
+
+// AddReadinessCheck registers a subsystem that must be healthy for /readyz to pass
+func AddReadinessCheck(name string, check ReadinessCheck) {
+	readinessChecksMutex.Lock()
+	defer readinessChecksMutex.Unlock()
+	readinessChecks[name] = check
+}
+
+func setupHealthRoutes() {
+	AddReadinessCheck("database", func(ctx context.Context) error {
+		return dbPool.Ping(ctx)
+	})
+	AddReadinessCheck("websocket_hub", func(ctx context.Context) error {
+		if websocket.Draining() {
+			return errors.New("server is shutting down")
+		}
+		if !websocket.HubRunning() {
+			return errors.New("client manager is not running")
+		}
+		return nil
+	})
+	AddReadinessCheck("migrations", func(ctx context.Context) error {
+		pending, err := database.PendingMigrations(ctx, dbPool)
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return fmt.Errorf("%d migrations have not been applied", pending)
+		}
+		return nil
+	})
+
+	handle("GET /healthz", handleLiveness)
+	handle("GET /readyz", handleReadiness)
+	handle("GET /status", handleStatus)
+	handle("GET /metrics", promhttp.Handler().ServeHTTP)
+}
+
+// checkResult is the outcome of one readiness check
+type checkResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// runReadinessChecks runs every check concurrently and reports whether all of them passed
+func runReadinessChecks(ctx context.Context) (map[string]checkResult, bool) {
+	readinessChecksMutex.RLock()
+	checks := make(map[string]ReadinessCheck, len(readinessChecks))
+	for name, check := range readinessChecks {
+		checks[name] = check
+	}
+	readinessChecksMutex.RUnlock()
+
+	var (
+		results = make(map[string]checkResult, len(checks))
+		mutex   sync.Mutex
+		wg      sync.WaitGroup
+		ready   = true
+	)
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, readinessTimeout)
+			defer cancel()
+
+			result := checkResult{OK: true}
+			if err := check(checkCtx); err != nil {
+				result = checkResult{Error: err.Error()}
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			results[name] = result
+			ready = ready && result.OK
+		}()
+	}
+	wg.Wait()
+	return results, ready
+}
+
+// handleLiveness only reports that the process is serving HTTP, dependencies are checked by /readyz
+func handleLiveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status": "ok",
+	})
+}
+
+func handleReadiness(w http.ResponseWriter, r *http.Request) {
+	checks, ready := runReadinessChecks(r.Context())
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]interface{}{
+		"status": status,
+		"checks": checks,
+	})
+}
+
+// handleStatus reports detailed server state. It always answers 200, problems are reported in the body.
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	checks, ready := runReadinessChecks(r.Context())
+	status := "ok"
+	if !ready {
+		status = "degraded"
+	}
+
+	stat := dbPool.Stat()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status": status,
+		"build": map[string]interface{}{
+			"version":   version.Version,
+			"commit":    version.Revision(),
+			"goVersion": runtime.Version(),
+		},
+		"startedAt":     startedAt.UTC().Format(time.RFC3339),
+		"uptimeSeconds": int64(time.Since(startedAt).Seconds()),
+		"checks":        checks,
+		"websocket": map[string]interface{}{
+			"hubRunning":       websocket.HubRunning(),
+			"connectedClients": websocket.GetConnectedClientsCount(),
+		},
+		"database": map[string]interface{}{
+			"maxConns":             stat.MaxConns(),
+			"totalConns":           stat.TotalConns(),
+			"idleConns":            stat.IdleConns(),
+			"acquiredConns":        stat.AcquiredConns(),
+			"constructingConns":    stat.ConstructingConns(),
+			"acquireCount":         stat.AcquireCount(),
+			"emptyAcquireCount":    stat.EmptyAcquireCount(),
+			"canceledAcquireCount": stat.CanceledAcquireCount(),
+			"acquireDurationMs":    stat.AcquireDuration().Milliseconds(),
+		},
+	})
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"openchamp/server/internal/database"
+	"openchamp/server/internal/oauth"
+	"regexp"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	errIdentityLinkedElsewhere = errors.New("identity is linked to another account")
+	errProviderAlreadyLinked   = errors.New("a different identity from this provider is already linked")
+	errLastLoginMethod         = errors.New("identity is the only way to sign in to this account")
+)
+
+var usernameUnsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// findOrCreateUser returns the user linked to the identity, creating a new
+// account the first time someone signs in with it
+func findOrCreateUser(ctx context.Context, identity *oauth.Identity) (int, string, bool, error) {
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return 0, "", false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		userID   int
+		username string
+	)
+	err = tx.QueryRow(ctx,
+		`UPDATE external_identities e SET last_login_at = NOW(), email = $3, display_name = $4
+		FROM users u
+		WHERE e.user_id = u.id AND e.provider = $1 AND e.subject = $2
+		RETURNING u.id, u.username`,
+		identity.Provider, identity.Subject, identity.Email, identity.DisplayName).Scan(&userID, &username)
+	if err == nil {
+		return userID, username, false, tx.Commit(ctx)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, "", false, err
+	}
+
+	// New player, external accounts have no password until they set one
+	base := usernameUnsafe.ReplaceAllString(identity.DisplayName, "")
+	if len(base) > 20 {
+		base = base[:20]
+	}
+	if len(base) < 3 {
+		base = "player"
+	}
+
+	// An empty password hash marks an account without a password, password
+	// logins to it are always rejected
+	candidate := base
+	for attempt := 0; attempt < 5; attempt++ {
+		err = tx.QueryRow(ctx,
+			`INSERT INTO users (username, password_hash) VALUES ($1, '')
+			ON CONFLICT DO NOTHING
+			RETURNING id`,
+			candidate).Scan(&userID)
+		if err == nil {
+			username = candidate
+			break
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return 0, "", false, err
+		}
+		candidate = fmt.Sprintf("%s%04d", base, rand.Intn(10000))
+	}
+	if userID == 0 {
+		return 0, "", false, fmt.Errorf("could not find a free username for %s", base)
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO external_identities (user_id, provider, subject, email, display_name, last_login_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())`,
+		userID, identity.Provider, identity.Subject, identity.Email, identity.DisplayName)
+	if err != nil {
+		return 0, "", false, err
+	}
+	return userID, username, true, tx.Commit(ctx)
+}
+
+// linkIdentity attaches an identity to an existing user
+func linkIdentity(ctx context.Context, userID int, identity *oauth.Identity) error {
+	var ownerID int
+	err := dbPool.QueryRow(ctx,
+		"SELECT user_id FROM external_identities WHERE provider = $1 AND subject = $2",
+		identity.Provider, identity.Subject).Scan(&ownerID)
+	if err == nil {
+		if ownerID == userID {
+			return nil // Already linked to this account
+		}
+		return errIdentityLinkedElsewhere
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	_, err = dbPool.Exec(ctx,
+		`INSERT INTO external_identities (user_id, provider, subject, email, display_name)
+		VALUES ($1, $2, $3, $4, $5)`,
+		userID, identity.Provider, identity.Subject, identity.Email, identity.DisplayName)
+	if constraint, ok := database.UniqueViolation(err); ok {
+		if constraint == "external_identities_user_id_provider_key" {
+			return errProviderAlreadyLinked
+		}
+		return errIdentityLinkedElsewhere
+	}
+	return err
+}
+
+// unlinkIdentity removes the user's identity for a provider, refusing if the
+// account would be left without any way to sign in. Returns false if nothing was linked.
+func unlinkIdentity(ctx context.Context, userID int, provider string) (bool, error) {
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		hasPassword bool
+		identities  int
+	)
+	err = tx.QueryRow(ctx,
+		"SELECT password_hash <> '' FROM users WHERE id = $1 FOR UPDATE",
+		userID).Scan(&hasPassword)
+	if err != nil {
+		return false, err
+	}
+	err = tx.QueryRow(ctx,
+		"SELECT COUNT(*) FROM external_identities WHERE user_id = $1",
+		userID).Scan(&identities)
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := tx.Exec(ctx,
+		"DELETE FROM external_identities WHERE user_id = $1 AND provider = $2",
+		userID, provider)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+	if !hasPassword && identities <= 1 {
+		return false, errLastLoginMethod
+	}
+	return true, tx.Commit(ctx)
+}
@@ -0,0 +1,282 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"openchamp/server/internal/account"
+	"openchamp/server/internal/audit"
+	"openchamp/server/internal/oauth"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	providers map[string]oauth.Provider
+	sessions  = oauth.NewSessionStore()
+	publicURL string
+)
+
+func setupOAuthRoutes() {
+	handle("GET /auth/providers", handleListProviders)
+	handle("GET /auth/{provider}/login", handleOAuthLogin)
+	handle("GET /auth/{provider}/callback", handleOAuthCallback)
+	handle("POST /auth/{provider}/link", requireUser(handleOAuthLink))
+	handle("GET /auth/{provider}/link/start", handleOAuthLinkStart)
+	handle("DELETE /auth/{provider}/link", requireUser(handleOAuthUnlink))
+}
+
+func redirectURI(provider string) string {
+	return strings.TrimSuffix(publicURL, "/") + "/auth/" + provider + "/callback"
+}
+
+// setBindingCookie ties the session to the browser it was started in
+func setBindingCookie(w http.ResponseWriter, session *oauth.Session) {
+	http.SetCookie(w, session.Cookie(strings.HasPrefix(publicURL, "https://")))
+}
+
+func providerFromRequest(w http.ResponseWriter, r *http.Request) oauth.Provider {
+	provider, ok := providers[r.PathValue("provider")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown_provider", "Unknown login provider: "+r.PathValue("provider"))
+		return nil
+	}
+	return provider
+}
+
+func handleListProviders(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"providers": names,
+	})
+}
+
+func handleOAuthLogin(w http.ResponseWriter, r *http.Request) {
+	provider := providerFromRequest(w, r)
+	if provider == nil {
+		return
+	}
+	session, err := sessions.Create(provider.Name(), 0)
+	if err != nil {
+		requestLog(r).WithFields(log.Fields{
+			"error": err,
+		}).Error("Error creating login session")
+		writeError(w, http.StatusInternalServerError, "server_error", "Login failed due to a server error")
+		return
+	}
+	redirectToProvider(w, r, provider, session)
+}
+
+func handleOAuthLink(w http.ResponseWriter, r *http.Request, session *account.Session) {
+	provider := providerFromRequest(w, r)
+	if provider == nil {
+		return
+	}
+	link, err := sessions.Create(provider.Name(), session.UserID)
+	if err != nil {
+		requestLog(r).WithFields(log.Fields{
+			"error": err,
+		}).Error("Error creating link session")
+		writeError(w, http.StatusInternalServerError, "server_error", "Linking failed due to a server error")
+		return
+	}
+	// The launcher opens this URL in a browser, so it is returned instead of
+	// redirecting. The start page binds the session to that browser.
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"url": strings.TrimSuffix(publicURL, "/") + "/auth/" + provider.Name() + "/link/start?state=" + url.QueryEscape(link.State),
+	})
+}
+
+// handleOAuthLinkStart binds a link session to the first browser that opens
+// it and sends that browser on to the provider
+func handleOAuthLinkStart(w http.ResponseWriter, r *http.Request) {
+	provider := providerFromRequest(w, r)
+	if provider == nil {
+		return
+	}
+	session, err := sessions.Begin(provider.Name(), r.URL.Query().Get("state"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_state", "The link is unknown, expired or was already opened, please try again")
+		return
+	}
+	redirectToProvider(w, r, provider, session)
+}
+
+func redirectToProvider(w http.ResponseWriter, r *http.Request, provider oauth.Provider, session *oauth.Session) {
+	authURL, err := provider.AuthURL(session, redirectURI(provider.Name()))
+	if err != nil {
+		requestLog(r).WithFields(log.Fields{
+			"provider": provider.Name(),
+			"error":    err,
+		}).Error("Error building login URL")
+		writeError(w, http.StatusBadGateway, "provider_error", "The login provider is unavailable")
+		return
+	}
+	setBindingCookie(w, session)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	provider := providerFromRequest(w, r)
+	if provider == nil {
+		return
+	}
+
+	session, err := sessions.Consume(provider.Name(), r.URL.Query().Get("state"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_state", "The login session is unknown or has expired, please try again")
+		return
+	}
+	// Without the binding cookie someone else started this session and sent
+	// the provider URL to this browser, finishing it could link their account
+	if !session.BoundTo(r) {
+		requestLog(r).WithFields(log.Fields{
+			"provider": provider.Name(),
+			"link":     session.LinkUserID != 0,
+		}).Warn("External login callback from another browser")
+		writeError(w, http.StatusBadRequest, "invalid_state", "The login was started in another browser, please try again")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oauth.BindingCookie, Path: "/auth/", MaxAge: -1})
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	identity, err := provider.Complete(ctx, r, session, redirectURI(provider.Name()))
+	if err != nil {
+		requestLog(r).WithFields(log.Fields{
+			"provider": provider.Name(),
+			"error":    err,
+		}).Warn("External login failed")
+		audit.Record(dbPool, audit.Event{
+			Type: audit.EventLoginFailed,
+			IP:   remoteIP(r),
+			Details: map[string]interface{}{
+				"provider": provider.Name(),
+				"reason":   "provider_verification_failed",
+			},
+		})
+		if errors.Is(err, oauth.ErrVerificationFailed) {
+			writeError(w, http.StatusUnauthorized, "verification_failed", "The login provider could not verify your account")
+			return
+		}
+		writeError(w, http.StatusBadGateway, "provider_error", "The login provider is unavailable")
+		return
+	}
+
+	if session.LinkUserID != 0 {
+		completeOAuthLink(w, r, session.LinkUserID, identity)
+		return
+	}
+
+	userID, username, created, err := findOrCreateUser(ctx, identity)
+	if err != nil {
+		requestLog(r).WithFields(log.Fields{
+			"provider": provider.Name(),
+			"error":    err,
+		}).Error("Error resolving external identity")
+		writeError(w, http.StatusInternalServerError, "server_error", "Login failed due to a server error")
+		return
+	}
+	if created {
+		audit.Record(dbPool, audit.Event{
+			Type:     audit.EventRegister,
+			ActorID:  &userID,
+			TargetID: &userID,
+			IP:       remoteIP(r),
+			Details: map[string]interface{}{
+				"username": username,
+				"provider": provider.Name(),
+			},
+		})
+	}
+
+	result, err := accounts.CompleteExternalLogin(ctx, userID, provider.Name(), remoteIP(r))
+	if err != nil {
+		writeServiceError(w, r, err, "Login failed due to a server error")
+		return
+	}
+	writeLoginResult(w, http.StatusOK, result)
+}
+
+func completeOAuthLink(w http.ResponseWriter, r *http.Request, userID int, identity *oauth.Identity) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err := linkIdentity(ctx, userID, identity)
+	switch {
+	case errors.Is(err, errIdentityLinkedElsewhere):
+		writeError(w, http.StatusConflict, "identity_in_use", "This account is already linked to another player")
+		return
+	case errors.Is(err, errProviderAlreadyLinked):
+		writeError(w, http.StatusConflict, "provider_already_linked", "Another "+identity.Provider+" account is already linked, unlink it first")
+		return
+	case err != nil:
+		requestLog(r).WithFields(log.Fields{
+			"provider": identity.Provider,
+			"error":    err,
+		}).Error("Error linking external identity")
+		writeError(w, http.StatusInternalServerError, "server_error", "Linking failed due to a server error")
+		return
+	}
+
+	audit.Record(dbPool, audit.Event{
+		Type:     audit.EventIdentityLink,
+		ActorID:  &userID,
+		TargetID: &userID,
+		IP:       remoteIP(r),
+		Details: map[string]interface{}{
+			"provider": identity.Provider,
+			"subject":  identity.Subject,
+		},
+	})
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"linked":   true,
+		"provider": identity.Provider,
+	})
+}
+
+func handleOAuthUnlink(w http.ResponseWriter, r *http.Request, session *account.Session) {
+	name := r.PathValue("provider")
+	userID := session.UserID
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	unlinked, err := unlinkIdentity(ctx, userID, name)
+	if errors.Is(err, errLastLoginMethod) {
+		writeError(w, http.StatusConflict, "last_login_method", "Set a password before unlinking your only login method")
+		return
+	}
+	if err != nil {
+		requestLog(r).WithFields(log.Fields{
+			"provider": name,
+			"error":    err,
+		}).Error("Error unlinking external identity")
+		writeError(w, http.StatusInternalServerError, "server_error", "Unlinking failed due to a server error")
+		return
+	}
+	if !unlinked {
+		writeError(w, http.StatusNotFound, "not_linked", "No "+name+" account is linked")
+		return
+	}
+
+	audit.Record(dbPool, audit.Event{
+		Type:     audit.EventIdentityUnlink,
+		ActorID:  &userID,
+		TargetID: &userID,
+		IP:       remoteIP(r),
+		Details: map[string]interface{}{
+			"provider": name,
+		},
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"openchamp/server/internal/oauth"
+	"testing"
+)
+
+// fakeProvider redirects to a fixed URL and fails the test if a callback
+// gets far enough to be completed
+type fakeProvider struct {
+	t *testing.T
+}
+
+func (p fakeProvider) Name() string { return "fake" }
+
+func (p fakeProvider) AuthURL(session *oauth.Session, redirectURI string) (string, error) {
+	return "https://provider.example/authorize?state=" + url.QueryEscape(session.State), nil
+}
+
+func (p fakeProvider) Complete(ctx context.Context, r *http.Request, session *oauth.Session, redirectURI string) (*oauth.Identity, error) {
+	p.t.Error("Complete() was called for a callback from another browser")
+	return nil, errors.New("unexpected callback")
+}
+
+func useFakeProvider(t *testing.T) {
+	t.Helper()
+	previous := providers
+	providers = map[string]oauth.Provider{"fake": fakeProvider{t: t}}
+	t.Cleanup(func() {
+		providers = previous
+	})
+}
+
+func oauthRequest(path, state string, cookies ...*http.Cookie) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, path+"?state="+url.QueryEscape(state), nil)
+	r.SetPathValue("provider", "fake")
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+func TestOAuthLinkStartBindsFirstBrowser(t *testing.T) {
+	useFakeProvider(t)
+	link, err := sessions.Create("fake", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := httptest.NewRecorder()
+	handleOAuthLinkStart(first, oauthRequest("/auth/fake/link/start", link.State))
+	if first.Code != http.StatusFound {
+		t.Fatalf("link start status = %d, want %d", first.Code, http.StatusFound)
+	}
+	cookies := first.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oauth.BindingCookie || !cookies[0].HttpOnly {
+		t.Fatalf("link start cookies = %+v, want an HttpOnly binding cookie", cookies)
+	}
+
+	second := httptest.NewRecorder()
+	handleOAuthLinkStart(second, oauthRequest("/auth/fake/link/start", link.State))
+	if second.Code != http.StatusBadRequest {
+		t.Errorf("second link start status = %d, want %d", second.Code, http.StatusBadRequest)
+	}
+}
+
+func TestOAuthCallbackRejectsOtherBrowser(t *testing.T) {
+	useFakeProvider(t)
+	link, err := sessions.Create("fake", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := httptest.NewRecorder()
+	handleOAuthLinkStart(start, oauthRequest("/auth/fake/link/start", link.State))
+
+	// The victim's browser follows the provider redirect without the cookie
+	callback := httptest.NewRecorder()
+	handleOAuthCallback(callback, oauthRequest("/auth/fake/callback", link.State))
+	if callback.Code != http.StatusBadRequest {
+		t.Errorf("callback status = %d, want %d", callback.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// requestIDHeader carries the request id, clients and proxies may set it to correlate their own logs
+const requestIDHeader = "X-Request-ID"
+
+const loggerKey contextKey = "logger"
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Hijack passes through to the underlying writer so WebSocket upgrades keep working
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(s.ResponseWriter).Hijack()
+}
+
+// withRequestLogging gives every request an id, returned in X-Request-ID and
+// attached to everything logged through requestLog
+func withRequestLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if requestID == "" || len(requestID) > 64 {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		entry := log.WithFields(log.Fields{
+			"request_id": requestID,
+		})
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), loggerKey, entry)))
+
+		entry.WithFields(log.Fields{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      recorder.status,
+			"duration_ms": time.Since(start).Milliseconds(),
+		}).Debug("Request handled")
+	})
+}
+
+// requestLog returns a log entry carrying the request id and, once authenticated, the user
+func requestLog(r *http.Request) *log.Entry {
+	if entry, ok := r.Context().Value(loggerKey).(*log.Entry); ok {
+		return entry
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// withLogField adds a field to the request's log entry for the handlers that run after it
+func withLogField(r *http.Request, key string, value interface{}) *http.Request {
+	entry := requestLog(r).WithField(key, value)
+	return r.WithContext(context.WithValue(r.Context(), loggerKey, entry))
+}
@@ -6,15 +6,23 @@ import (
 )
 
 func SetupRoutes() {
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	handle("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "Hello, World from the root route!")
 	})
-	http.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintf(w, `{
-			"status": "ok",
-		}`)
-	})
-	http.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+	handle("/hello", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "Hello from the /hello route!")
 	})
+	handle("/whoami", requirePermission("", func(w http.ResponseWriter, r *http.Request) {
+		principal := principalFromRequest(r)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"serviceAccountId": principal.ServiceAccountID,
+			"name":             principal.Name,
+			"scopes":           principal.Permissions.List(),
+		})
+	}))
+	setupHealthRoutes()
+	setupDocsRoutes()
+	setupAccountRoutes()
+	setupOAuthRoutes()
+	setupAdminRoutes()
 }
@@ -0,0 +1,90 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"openchamp/server/internal/websocket"
+	"sort"
+	"strings"
+)
+
+// openAPISpec documents every route registered through handle
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+//go:embed docs.html
+var docsPage []byte
+
+// mux serves the web server routes. It is not the default mux, so routes
+// registered elsewhere are not served on this port and these are not served on others.
+var mux = http.NewServeMux()
+
+// registeredRoutes holds the pattern of every route registered through handle
+var registeredRoutes []string
+
+// handle registers a route on the web server mux and remembers it so it can be checked against the OpenAPI spec
+func handle(pattern string, handler http.HandlerFunc) {
+	registeredRoutes = append(registeredRoutes, pattern)
+	mux.HandleFunc(pattern, handler)
+}
+
+func setupDocsRoutes() {
+	handle("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPISpec)
+	})
+	handle("GET /ws-schema.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write(websocket.MessageSchema())
+	})
+	handle("GET /docs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(docsPage)
+	})
+}
+
+// ValidateSpec checks that every registered route is documented in the
+// OpenAPI spec and that the spec does not document routes that do not exist.
+// Patterns without a method must be documented with at least one operation.
+func ValidateSpec() error {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		return fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+
+	var problems []string
+	// registered holds "method path" for each route, with an empty method for method-less patterns
+	registered := make(map[string]bool)
+	for _, pattern := range registeredRoutes {
+		method, path, found := strings.Cut(pattern, " ")
+		if !found {
+			method, path = "", pattern
+		}
+		method = strings.ToLower(method)
+		registered[method+" "+path] = true
+
+		operations := spec.Paths[path]
+		if _, ok := operations[method]; !ok && (method != "" || len(operations) == 0) {
+			problems = append(problems, "route "+pattern+" is not documented")
+		}
+	}
+
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			if !registered[method+" "+path] && !registered[" "+path] {
+				problems = append(problems, "documented operation "+strings.ToUpper(method)+" "+path+" is not registered")
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("OpenAPI spec is out of date: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
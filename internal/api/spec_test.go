@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var setupRoutes sync.Once
+
+// wildcard matches a path wildcard such as {id} or {path...}
+var wildcard = regexp.MustCompile(`\{[^}]+\}`)
+
+// routes registers the routes on the web server mux once, as the server does at startup
+func routes(t *testing.T) []string {
+	t.Helper()
+	setupRoutes.Do(SetupRoutes)
+	if len(registeredRoutes) == 0 {
+		t.Fatal("no routes were registered")
+	}
+	return registeredRoutes
+}
+
+func TestSpecDocumentsEveryRoute(t *testing.T) {
+	routes(t)
+	if err := ValidateSpec(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRoutesReachMux checks that every route known to the spec check is
+// what the web server mux actually serves for that path, and that the
+// default mux shared with other servers does not serve it
+func TestRoutesReachMux(t *testing.T) {
+	for _, pattern := range routes(t) {
+		method, path, found := strings.Cut(pattern, " ")
+		if !found {
+			method, path = http.MethodGet, pattern
+		}
+		request := httptest.NewRequest(method, wildcard.ReplaceAllString(path, "1"), nil)
+		if _, matched := mux.Handler(request); matched != pattern {
+			t.Errorf("%s %s is served by %q, want %q", method, request.URL.Path, matched, pattern)
+		}
+		if _, matched := http.DefaultServeMux.Handler(request); matched != "" {
+			t.Errorf("%s %s is also served by the default mux as %q", method, request.URL.Path, matched)
+		}
+	}
+}
+
+func TestValidateSpecReportsMissingRoutes(t *testing.T) {
+	registered := routes(t)
+	defer func() {
+		registeredRoutes = registered
+	}()
+
+	registeredRoutes = append(append([]string(nil), registered...), "GET /undocumented")
+	err := ValidateSpec()
+	if err == nil || !strings.Contains(err.Error(), "route GET /undocumented is not documented") {
+		t.Errorf("ValidateSpec() = %v, want the undocumented route reported", err)
+	}
+
+	registeredRoutes = registered[1:]
+	if err := ValidateSpec(); err == nil || !strings.Contains(err.Error(), "is not registered") {
+		t.Errorf("ValidateSpec() = %v, want the unregistered operation reported", err)
+	}
+}
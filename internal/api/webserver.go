@@ -1,26 +1,60 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"openchamp/server/internal/account"
+	"openchamp/server/internal/config"
+	"openchamp/server/internal/oauth"
+	"sync"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	log "github.com/sirupsen/logrus"
 )
 
-var dbPool *pgxpool.Pool
+var (
+	dbPool *pgxpool.Pool
 
-func StartWebServer(port int, pool *pgxpool.Pool) {
+	server      *http.Server
+	serverMutex sync.Mutex
+)
+
+func StartWebServer(cfg config.Config, pool *pgxpool.Pool, accountService *account.Service) {
 	dbPool = pool
+	accounts = accountService
+	port := cfg.WebPort
 	// Default Port
 	if port == 0 {
 		port = 8080
 	}
+	// External login providers
+	publicURL = cfg.PublicURL
+	providers = oauth.ProvidersFromConfig(cfg)
 	// Routing
 	SetupRoutes()
+	if err := ValidateSpec(); err != nil {
+		log.Fatal(err)
+	}
 	// Start Server
-	fmt.Println("Starting web server on :" + fmt.Sprint(port) + "...")
-	if err := http.ListenAndServe(":"+fmt.Sprint(port), nil); err != nil {
+	log.WithField("port", port).Info("Starting web server")
+	srv := &http.Server{Addr: ":" + fmt.Sprint(port), Handler: withRequestLogging(mux)}
+	serverMutex.Lock()
+	server = srv
+	serverMutex.Unlock()
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal("Error starting server: ", err)
 	}
 }
+
+// Shutdown stops accepting requests and waits for running ones to finish until ctx ends
+func Shutdown(ctx context.Context) error {
+	serverMutex.Lock()
+	srv := server
+	serverMutex.Unlock()
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
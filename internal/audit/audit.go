@@ -0,0 +1,208 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	log "github.com/sirupsen/logrus"
+)
+
+// EventType identifies a security relevant action
+type EventType string
+
+const (
+	EventLogin            EventType = "login"
+	EventLoginFailed      EventType = "login_failed"
+	EventRegister         EventType = "register"
+	EventTokenNewIP       EventType = "token_new_ip"
+	EventPasswordChange   EventType = "password_change"
+	EventEmailChange      EventType = "email_change"
+	EventAccountDelete    EventType = "account_deleted"
+	EventTwoFactorEnable  EventType = "2fa_enabled"
+	EventTwoFactorDisable EventType = "2fa_disabled"
+	EventTwoFactorReset   EventType = "2fa_reset"
+	EventRoleChange       EventType = "role_change"
+	EventSanctionIssue    EventType = "sanction_issued"
+	EventSanctionRevoke   EventType = "sanction_revoked"
+	EventServiceLogin     EventType = "service_login"
+	EventAPIKeyCreate     EventType = "api_key_created"
+	EventAPIKeyRotate     EventType = "api_key_rotated"
+	EventAPIKeyRevoke     EventType = "api_key_revoked"
+	EventIdentityLink     EventType = "identity_linked"
+	EventIdentityUnlink   EventType = "identity_unlinked"
+	EventTokensRevoke     EventType = "tokens_revoked"
+	EventBroadcast        EventType = "server_broadcast"
+	EventClientKick       EventType = "client_kicked"
+	EventLogLevelChange   EventType = "log_level_changed"
+	EventChatFlagReview   EventType = "chat_flag_reviewed"
+	EventReportResolve    EventType = "report_resolved"
+)
+
+const (
+	// DefaultPageSize is used when a query does not set a limit
+	DefaultPageSize = 50
+	// MaxPageSize caps how many events a single query can return
+	MaxPageSize = 500
+)
+
+// Event is a single entry in the audit log. ActorID is the user who performed
+// the action and TargetID the user it was performed on, either may be nil.
+type Event struct {
+	ID        int64                  `json:"id"`
+	Type      EventType              `json:"type"`
+	ActorID   *int                   `json:"actorId,omitempty"`
+	TargetID  *int                   `json:"targetId,omitempty"`
+	IP        string                 `json:"ip,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	CreatedAt time.Time              `json:"createdAt"`
+}
+
+// Filter narrows down an audit query, zero values are ignored
+type Filter struct {
+	Type     EventType
+	ActorID  int
+	TargetID int
+	UserID   int // Matches either the actor or the target
+	IP       string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+	Offset   int
+}
+
+// Record stores an event. Failures are logged but never returned so that
+// auditing can not break the action being audited.
+func Record(dbPool *pgxpool.Pool, event Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	details := event.Details
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+
+	_, err := dbPool.Exec(ctx,
+		`INSERT INTO audit_events (event_type, actor_id, target_id, ip_address, details)
+		VALUES ($1, $2, $3, $4, $5)`,
+		string(event.Type), event.ActorID, event.TargetID, event.IP, details)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"type":  event.Type,
+			"error": err,
+		}).Error("Failed to record audit event")
+	}
+}
+
+// Query returns a page of events matching the filter, newest first, along with the total match count
+func Query(ctx context.Context, dbPool *pgxpool.Pool, filter Filter) ([]Event, int, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Type != "" {
+		addCondition("event_type = $%d", string(filter.Type))
+	}
+	if filter.ActorID != 0 {
+		addCondition("actor_id = $%d", filter.ActorID)
+	}
+	if filter.TargetID != 0 {
+		addCondition("target_id = $%d", filter.TargetID)
+	}
+	if filter.UserID != 0 {
+		args = append(args, filter.UserID)
+		conditions = append(conditions, fmt.Sprintf("(actor_id = $%d OR target_id = $%d)", len(args), len(args)))
+	}
+	if filter.IP != "" {
+		addCondition("ip_address = $%d", filter.IP)
+	}
+	if !filter.Since.IsZero() {
+		addCondition("created_at >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		addCondition("created_at < $%d", filter.Until)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := dbPool.QueryRow(ctx, "SELECT COUNT(*) FROM audit_events "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	offset := filter.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	args = append(args, limit, offset)
+
+	rows, err := dbPool.Query(ctx,
+		fmt.Sprintf(`SELECT id, event_type, actor_id, target_id, COALESCE(ip_address, ''), details, created_at
+		FROM audit_events %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args)),
+		args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var event Event
+		if err := rows.Scan(&event.ID, &event.Type, &event.ActorID, &event.TargetID,
+			&event.IP, &event.Details, &event.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		events = append(events, event)
+	}
+	return events, total, rows.Err()
+}
+
+// StartRetentionJob deletes events older than the retention period once an hour
+func StartRetentionJob(dbPool *pgxpool.Pool, retention time.Duration) {
+	go func() {
+		for {
+			purgeExpired(dbPool, retention)
+			time.Sleep(1 * time.Hour)
+		}
+	}()
+}
+
+func purgeExpired(dbPool *pgxpool.Pool, retention time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+
+	tag, err := dbPool.Exec(ctx,
+		"DELETE FROM audit_events WHERE created_at < $1",
+		time.Now().Add(-retention))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Failed to purge old audit events")
+		return
+	}
+	if tag.RowsAffected() > 0 {
+		log.WithFields(log.Fields{
+			"purged":    tag.RowsAffected(),
+			"retention": retention,
+		}).Info("Purged old audit events")
+	}
+}
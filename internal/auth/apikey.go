@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// apiKeyPrefix marks OpenChamp API keys so they are easy to spot in leaked secrets
+const apiKeyPrefix = "ock"
+
+// GenerateAPIKey creates a new raw API key of the form ock_<id>_<secret>.
+// The id is stored in clear text for lookups, only the hash of the full key is stored.
+func GenerateAPIKey() (raw, id, hash string, err error) {
+	idBytes := make([]byte, 6)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	id = hex.EncodeToString(idBytes)
+	raw = apiKeyPrefix + "_" + id + "_" + hex.EncodeToString(secretBytes)
+	return raw, id, HashAPIKey(raw), nil
+}
+
+// ParseAPIKey extracts the lookup id from a raw key
+func ParseAPIKey(raw string) (string, bool) {
+	parts := strings.Split(raw, "_")
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// HashAPIKey returns the value stored in the database for a raw key
+func HashAPIKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyMatches compares a raw key against a stored hash in constant time
+func APIKeyMatches(raw, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashAPIKey(raw)), []byte(hash)) == 1
+}
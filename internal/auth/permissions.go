@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Role is the account type stored on each user
+type Role string
+
+const (
+	RolePlayer     Role = "player"
+	RoleModerator  Role = "moderator"
+	RoleAdmin      Role = "admin"
+	RoleGameServer Role = "game-server"
+)
+
+// Roles lists every valid role
+var Roles = []Role{RolePlayer, RoleModerator, RoleAdmin, RoleGameServer}
+
+// IsValid reports whether r is one of the known roles
+func (r Role) IsValid() bool {
+	for _, role := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// roleRank orders the roles for sanctions, game servers rank with players
+var roleRank = map[Role]int{
+	RolePlayer:     0,
+	RoleGameServer: 0,
+	RoleModerator:  1,
+	RoleAdmin:      2,
+}
+
+// Outranks reports whether r is above other, only a higher role may sanction a user
+func (r Role) Outranks(other Role) bool {
+	return roleRank[r] > roleRank[other]
+}
+
+// Permission is a single capability checked by message handlers
+type Permission string
+
+const (
+	PermAccountManage         Permission = "account.manage"
+	PermGamePlay              Permission = "game.play"
+	PermMatchReport           Permission = "match.report"
+	PermUsersManage           Permission = "users.manage"
+	PermRolesManage           Permission = "roles.manage"
+	PermSanctionsIssue        Permission = "sanctions.issue"
+	PermAuditRead             Permission = "audit.read"
+	PermServerBroadcast       Permission = "server.broadcast"
+	PermServerManage          Permission = "server.manage"
+	PermServiceAccountsManage Permission = "service_accounts.manage"
+)
+
+// Permissions lists every known permission
+var Permissions = []Permission{
+	PermAccountManage,
+	PermGamePlay,
+	PermMatchReport,
+	PermUsersManage,
+	PermRolesManage,
+	PermSanctionsIssue,
+	PermAuditRead,
+	PermServerBroadcast,
+	PermServerManage,
+	PermServiceAccountsManage,
+}
+
+// IsValid reports whether p is one of the known permissions
+func (p Permission) IsValid() bool {
+	for _, permission := range Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// IsServiceScope reports whether the permission can be granted to an API key.
+// Managing a human account and minting new credentials are never delegated.
+func (p Permission) IsServiceScope() bool {
+	switch p {
+	case PermAccountManage, PermRolesManage, PermServiceAccountsManage:
+		return false
+	}
+	return p.IsValid()
+}
+
+// DefaultRolePermissions is seeded into the role_permissions table at startup.
+// Extra grants can be added in the database, the defaults are always present.
+var DefaultRolePermissions = map[Role][]Permission{
+	RolePlayer: {
+		PermAccountManage,
+		PermGamePlay,
+	},
+	RoleModerator: {
+		PermAccountManage,
+		PermGamePlay,
+		PermUsersManage,
+		PermSanctionsIssue,
+	},
+	RoleAdmin: {
+		PermAccountManage,
+		PermGamePlay,
+		PermUsersManage,
+		PermRolesManage,
+		PermSanctionsIssue,
+		PermAuditRead,
+		PermServerBroadcast,
+		PermServerManage,
+		PermServiceAccountsManage,
+	},
+	RoleGameServer: {
+		PermMatchReport,
+	},
+}
+
+// PermissionSet is the set of permissions loaded for an authenticated client
+type PermissionSet map[Permission]bool
+
+// NewPermissionSet builds a set from a list of permissions
+func NewPermissionSet(permissions ...Permission) PermissionSet {
+	set := make(PermissionSet, len(permissions))
+	for _, permission := range permissions {
+		set[permission] = true
+	}
+	return set
+}
+
+// Has reports whether the set grants the permission
+func (p PermissionSet) Has(permission Permission) bool {
+	return p[permission]
+}
+
+// List returns the granted permissions in a stable order
+func (p PermissionSet) List() []Permission {
+	permissions := make([]Permission, 0, len(p))
+	for permission, granted := range p {
+		if granted {
+			permissions = append(permissions, permission)
+		}
+	}
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i] < permissions[j] })
+	return permissions
+}
+
+// LoadUserPermissions fetches the role of a user and the permissions granted to it
+func LoadUserPermissions(ctx context.Context, dbPool *pgxpool.Pool, userID int) (Role, PermissionSet, error) {
+	rows, err := dbPool.Query(ctx,
+		`SELECT u.role, rp.permission
+		FROM users u
+		LEFT JOIN role_permissions rp ON rp.role = u.role
+		WHERE u.id = $1`,
+		userID)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+
+	var role Role
+	permissions := NewPermissionSet()
+	for rows.Next() {
+		var (
+			name       string
+			permission pgtype.Text
+		)
+		if err := rows.Scan(&name, &permission); err != nil {
+			return "", nil, err
+		}
+		role = Role(name)
+		if permission.Valid {
+			permissions[Permission(permission.String)] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", nil, err
+	}
+	return role, permissions, nil
+}
@@ -0,0 +1,26 @@
+package auth
+
+import "testing"
+
+func TestRoleOutranks(t *testing.T) {
+	tests := []struct {
+		issuer, target Role
+		want           bool
+	}{
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RolePlayer, true},
+		{RoleModerator, RolePlayer, true},
+		{RoleModerator, RoleGameServer, true},
+		{RoleModerator, RoleModerator, false},
+		{RoleModerator, RoleAdmin, false},
+		{RoleAdmin, RoleAdmin, false},
+		{RolePlayer, RolePlayer, false},
+		{RolePlayer, RoleModerator, false},
+		{"", RolePlayer, false},
+	}
+	for _, tt := range tests {
+		if got := tt.issuer.Outranks(tt.target); got != tt.want {
+			t.Errorf("%q.Outranks(%q) = %v, want %v", tt.issuer, tt.target, got, tt.want)
+		}
+	}
+}
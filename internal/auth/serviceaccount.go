@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrInvalidAPIKey is returned for unknown, revoked or expired keys
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// ServiceAccount is a non-human account used by game servers, bots and tools
+type ServiceAccount struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Disabled    bool      `json:"disabled"`
+}
+
+// APIKey is the stored metadata of a key, the raw key is only shown once at creation
+type APIKey struct {
+	ID               int          `json:"id"`
+	ServiceAccountID int          `json:"serviceAccountId"`
+	Prefix           string       `json:"prefix"`
+	Scopes           []Permission `json:"scopes"`
+	CreatedAt        time.Time    `json:"createdAt"`
+	ExpiresAt        *time.Time   `json:"expiresAt,omitempty"`
+	LastUsedAt       *time.Time   `json:"lastUsedAt,omitempty"`
+	Revoked          bool         `json:"revoked"`
+}
+
+// ServicePrincipal is the identity resolved from a valid API key
+type ServicePrincipal struct {
+	ServiceAccountID int
+	Name             string
+	KeyID            int
+	Permissions      PermissionSet
+}
+
+// CreateServiceAccount stores a new service account
+func CreateServiceAccount(ctx context.Context, dbPool *pgxpool.Pool, name, description string, createdBy *int) (*ServiceAccount, error) {
+	account := ServiceAccount{Name: name, Description: description}
+	err := dbPool.QueryRow(ctx,
+		`INSERT INTO service_accounts (name, description, created_by)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`,
+		name, description, createdBy).Scan(&account.ID, &account.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service account %s: %w", name, err)
+	}
+	return &account, nil
+}
+
+// ListServiceAccounts returns every service account with its keys
+func ListServiceAccounts(ctx context.Context, dbPool *pgxpool.Pool) ([]ServiceAccount, map[int][]APIKey, error) {
+	rows, err := dbPool.Query(ctx,
+		`SELECT id, name, COALESCE(description, ''), created_at, disabled_at IS NOT NULL
+		FROM service_accounts ORDER BY name`)
+	if err != nil {
+		return nil, nil, err
+	}
+	accounts, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ServiceAccount, error) {
+		var account ServiceAccount
+		err := row.Scan(&account.ID, &account.Name, &account.Description, &account.CreatedAt, &account.Disabled)
+		return account, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = dbPool.Query(ctx,
+		`SELECT id, service_account_id, prefix, scopes, created_at, expires_at, last_used_at, revoked_at IS NOT NULL
+		FROM api_keys ORDER BY created_at`)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (APIKey, error) {
+		var (
+			key    APIKey
+			scopes []string
+		)
+		err := row.Scan(&key.ID, &key.ServiceAccountID, &key.Prefix, &scopes,
+			&key.CreatedAt, &key.ExpiresAt, &key.LastUsedAt, &key.Revoked)
+		for _, scope := range scopes {
+			key.Scopes = append(key.Scopes, Permission(scope))
+		}
+		return key, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keysByAccount := make(map[int][]APIKey)
+	for _, key := range keys {
+		keysByAccount[key.ServiceAccountID] = append(keysByAccount[key.ServiceAccountID], key)
+	}
+	return accounts, keysByAccount, nil
+}
+
+// CreateAPIKey issues a new key for a service account and returns the raw key.
+// A zero ttl creates a key that never expires.
+func CreateAPIKey(ctx context.Context, dbPool *pgxpool.Pool, serviceAccountID int, scopes []Permission, ttl time.Duration) (string, *APIKey, error) {
+	for _, scope := range scopes {
+		if !scope.IsServiceScope() {
+			return "", nil, fmt.Errorf("%s can not be granted to an API key", scope)
+		}
+	}
+
+	raw, prefix, hash, err := GenerateAPIKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	key := APIKey{ServiceAccountID: serviceAccountID, Prefix: prefix, Scopes: scopes}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		key.ExpiresAt = &expiresAt
+	}
+
+	scopeNames := make([]string, len(scopes))
+	for i, scope := range scopes {
+		scopeNames[i] = string(scope)
+	}
+
+	err = dbPool.QueryRow(ctx,
+		`INSERT INTO api_keys (service_account_id, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		serviceAccountID, prefix, hash, scopeNames, key.ExpiresAt).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+	return raw, &key, nil
+}
+
+// RotateAPIKey replaces a key with a new one that has the same scopes and lifetime.
+// The old key is revoked in the same transaction.
+func RotateAPIKey(ctx context.Context, dbPool *pgxpool.Pool, keyID int) (string, *APIKey, error) {
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		key       APIKey
+		scopes    []string
+		createdAt time.Time
+		expiresAt *time.Time
+	)
+	err = tx.QueryRow(ctx,
+		`UPDATE api_keys SET revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL
+		RETURNING service_account_id, scopes, created_at, expires_at`,
+		keyID).Scan(&key.ServiceAccountID, &scopes, &createdAt, &expiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil, ErrInvalidAPIKey
+		}
+		return "", nil, err
+	}
+
+	raw, prefix, hash, err := GenerateAPIKey()
+	if err != nil {
+		return "", nil, err
+	}
+	key.Prefix = prefix
+	for _, scope := range scopes {
+		key.Scopes = append(key.Scopes, Permission(scope))
+	}
+	if expiresAt != nil {
+		newExpiry := time.Now().Add(expiresAt.Sub(createdAt))
+		key.ExpiresAt = &newExpiry
+	}
+
+	err = tx.QueryRow(ctx,
+		`INSERT INTO api_keys (service_account_id, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		key.ServiceAccountID, prefix, hash, scopes, key.ExpiresAt).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", nil, err
+	}
+	return raw, &key, nil
+}
+
+// RevokeAPIKey revokes a key, returning false if it does not exist or was already revoked
+func RevokeAPIKey(ctx context.Context, dbPool *pgxpool.Pool, keyID int) (bool, error) {
+	tag, err := dbPool.Exec(ctx,
+		"UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL",
+		keyID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// AuthenticateAPIKey resolves a raw key to its service account and scopes
+func AuthenticateAPIKey(ctx context.Context, dbPool *pgxpool.Pool, raw string) (*ServicePrincipal, error) {
+	prefix, ok := ParseAPIKey(raw)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var (
+		principal ServicePrincipal
+		keyHash   string
+		scopes    []string
+	)
+	err := dbPool.QueryRow(ctx,
+		`SELECT k.id, k.key_hash, k.scopes, s.id, s.name
+		FROM api_keys k
+		JOIN service_accounts s ON s.id = k.service_account_id
+		WHERE k.prefix = $1
+		AND k.revoked_at IS NULL
+		AND (k.expires_at IS NULL OR k.expires_at > NOW())
+		AND s.disabled_at IS NULL`,
+		prefix).Scan(&principal.KeyID, &keyHash, &scopes, &principal.ServiceAccountID, &principal.Name)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if !APIKeyMatches(raw, keyHash) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	principal.Permissions = NewPermissionSet()
+	for _, scope := range scopes {
+		principal.Permissions[Permission(scope)] = true
+	}
+
+	// Tracking usage is best effort, the key is valid either way
+	dbPool.Exec(ctx, "UPDATE api_keys SET last_used_at = NOW() WHERE id = $1", principal.KeyID)
+	return &principal, nil
+}
@@ -0,0 +1,157 @@
+// Package chat holds chat messages, their limits and the storage of whispers
+// to offline players. Delivery to live connections is done by the WebSocket server.
+package chat
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MaxLength is the longest message body accepted, in characters
+const MaxLength = 500
+
+// maxPendingWhispers bounds how many stored whispers are delivered at login
+const maxPendingWhispers = 100
+
+var (
+	ErrEmpty   = errors.New("the message is empty")
+	ErrTooLong = errors.New("the message is too long")
+)
+
+// Kind is the type of conversation a message belongs to
+type Kind string
+
+const (
+	KindWhisper Kind = "whisper"
+	KindPublic  Kind = "public"
+	KindParty   Kind = "party"
+	KindTeam    Kind = "team"
+)
+
+// Message is a single chat message. Channel is empty for whispers, which
+// name their recipient instead.
+type Message struct {
+	ID          string
+	Kind        Kind
+	Channel     string
+	SenderID    int
+	Sender      string
+	RecipientID int
+	Recipient   string
+	Body        string
+	SentAt      time.Time
+	Offline     bool // Stored while the recipient was offline and delivered at login
+}
+
+// NewMessage assigns a message id and timestamp. The ids sort by time.
+func NewMessage(kind Kind, senderID int, sender, body string) (*Message, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+	return &Message{
+		ID:       id.String(),
+		Kind:     kind,
+		SenderID: senderID,
+		Sender:   sender,
+		Body:     body,
+		SentAt:   time.Now(),
+	}, nil
+}
+
+// Payload is the message as sent to clients
+func (m *Message) Payload() map[string]interface{} {
+	payload := map[string]interface{}{
+		"id":        m.ID,
+		"kind":      m.Kind,
+		"sender_id": m.SenderID,
+		"sender":    m.Sender,
+		"body":      m.Body,
+		"sent_at":   m.SentAt.UTC().Format(time.RFC3339Nano),
+	}
+	if m.Kind == KindWhisper {
+		payload["recipient_id"] = m.RecipientID
+		payload["recipient"] = m.Recipient
+	} else {
+		payload["channel"] = m.Channel
+	}
+	if m.Offline {
+		payload["offline"] = true
+	}
+	return payload
+}
+
+// Normalize trims a message body and strips control characters, rejecting empty and overlong messages
+func Normalize(body string) (string, error) {
+	body = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, body))
+	if body == "" {
+		return "", ErrEmpty
+	}
+	if len([]rune(body)) > MaxLength {
+		return "", ErrTooLong
+	}
+	return body, nil
+}
+
+// StoreWhisper keeps a whisper for a recipient who is offline
+func StoreWhisper(ctx context.Context, dbPool *pgxpool.Pool, message *Message) error {
+	_, err := dbPool.Exec(ctx,
+		`INSERT INTO offline_whispers (id, sender_id, recipient_id, body, sent_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		message.ID, message.SenderID, message.RecipientID, message.Body, message.SentAt)
+	return err
+}
+
+// TakePendingWhispers returns the oldest undelivered whispers of the
+// recipient and marks them delivered
+func TakePendingWhispers(ctx context.Context, dbPool *pgxpool.Pool, recipientID int) ([]Message, error) {
+	rows, err := dbPool.Query(ctx,
+		`UPDATE offline_whispers w SET delivered_at = NOW()
+		FROM users s, users r
+		WHERE w.id IN (
+			SELECT id FROM offline_whispers
+			WHERE recipient_id = $1 AND delivered_at IS NULL
+			ORDER BY sent_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		AND s.id = w.sender_id AND r.id = w.recipient_id
+		RETURNING w.id::text, w.sender_id, s.username, w.recipient_id, r.username, w.body, w.sent_at`,
+		recipientID, maxPendingWhispers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		message := Message{Kind: KindWhisper, Offline: true}
+		err := rows.Scan(&message.ID, &message.SenderID, &message.Sender,
+			&message.RecipientID, &message.Recipient, &message.Body, &message.SentAt)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// UPDATE ... RETURNING does not keep the order of the subquery
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].SentAt.Before(messages[j].SentAt)
+	})
+	return messages, nil
+}
@@ -0,0 +1,117 @@
+package chat
+
+import (
+	"strings"
+)
+
+// Action is what happens to a message that trips a filter
+type Action string
+
+const (
+	// ActionMask delivers the message with the offending text masked
+	ActionMask Action = "mask"
+	// ActionBlock drops the message and tells the sender
+	ActionBlock Action = "block"
+	// ActionFlag delivers the message unchanged and queues it for moderator review
+	ActionFlag Action = "flag"
+)
+
+// IsValid reports whether a is one of the known actions
+func (a Action) IsValid() bool {
+	switch a {
+	case ActionMask, ActionBlock, ActionFlag:
+		return true
+	}
+	return false
+}
+
+// Finding is a problem a filter found in a message
+type Finding struct {
+	Reason string
+	// Masked is the body with the offending text masked, empty when the
+	// problem cannot be masked, such as a flood of messages
+	Masked string
+}
+
+// Filter inspects a message body before it is delivered. Filters run in
+// order and each one sees the body as masked by the filters before it.
+type Filter interface {
+	Check(senderID int, body string) (Finding, bool)
+}
+
+// Result is the outcome of running a message through the pipeline
+type Result struct {
+	// Action is empty when no filter found anything
+	Action   Action
+	Findings []Finding
+	// Body is what to deliver, masked when the action is ActionMask
+	Body string
+}
+
+// Reasons lists why the message was filtered
+func (r Result) Reasons() []string {
+	reasons := make([]string, 0, len(r.Findings))
+	for _, finding := range r.Findings {
+		reasons = append(reasons, finding.Reason)
+	}
+	return reasons
+}
+
+// Pipeline runs filters over messages and applies the policy of their channel kind
+type Pipeline struct {
+	filters  []Filter
+	policies map[Kind]Action
+}
+
+// NewPipeline creates a pipeline. Kinds without a policy are masked.
+func NewPipeline(policies map[Kind]Action, filters ...Filter) *Pipeline {
+	return &Pipeline{filters: filters, policies: policies}
+}
+
+// Policy returns the action taken on filtered messages of the kind
+func (p *Pipeline) Policy(kind Kind) Action {
+	if action, ok := p.policies[kind]; ok {
+		return action
+	}
+	return ActionMask
+}
+
+// Run checks a message. A nil pipeline lets everything through.
+// Messages that should be masked but cannot be are blocked instead.
+func (p *Pipeline) Run(message *Message) Result {
+	result := Result{Body: message.Body}
+	if p == nil {
+		return result
+	}
+
+	maskable := true
+	for _, filter := range p.filters {
+		finding, found := filter.Check(message.SenderID, result.Body)
+		if !found {
+			continue
+		}
+		result.Findings = append(result.Findings, finding)
+		if finding.Masked == "" {
+			maskable = false
+		} else {
+			result.Body = finding.Masked
+		}
+	}
+	if len(result.Findings) == 0 {
+		return result
+	}
+
+	result.Action = p.Policy(message.Kind)
+	if result.Action == ActionMask && !maskable {
+		result.Action = ActionBlock
+	}
+	if result.Action != ActionMask {
+		result.Body = message.Body
+	}
+	return result
+}
+
+// maskRunes replaces every character of s with an asterisk
+func maskRunes(s string) string {
+	return strings.Repeat("*", len([]rune(s)))
+}
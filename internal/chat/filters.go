@@ -0,0 +1,341 @@
+package chat
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"net/url"
+	"openchamp/server/internal/config"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+//go:embed wordlist.txt
+var defaultWordList string
+
+// NewPipelineFromConfig builds the standard pipeline: spam, blocked words, links and caps
+func NewPipelineFromConfig(cfg config.ChatConfig) (*Pipeline, error) {
+	words, err := LoadWordList(cfg.WordList)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make(map[Kind]Action, len(cfg.Policies))
+	for kind, action := range cfg.Policies {
+		policies[Kind(kind)] = Action(action)
+	}
+	return NewPipeline(policies,
+		NewSpamFilter(),
+		NewWordFilter(words),
+		NewLinkFilter(cfg.AllowedLinkHosts),
+		NewCapsFilter(),
+	), nil
+}
+
+// LoadWordList reads one word per line, skipping blank lines and # comments.
+// An empty path loads the built in list.
+func LoadWordList(path string) ([]string, error) {
+	content := defaultWordList
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading chat word list: %w", err)
+		}
+		content = string(data)
+	}
+
+	var words []string
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	return words, scanner.Err()
+}
+
+// leetspeak maps look-alike characters back to the letters they stand for
+var leetspeak = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b',
+	'@': 'a', '$': 's', '!': 'i', '|': 'l', '+': 't',
+}
+
+// wordSuffixes are endings a blocked word may carry and still match
+const wordSuffixes = `(?:s|es|ed|er|ers|ing|in|z)?`
+
+// WordFilter masks blocked words. Each whitespace separated word is
+// lowercased, leetspeak is undone and punctuation inside it is dropped
+// before it is compared, so "F.u.u.c_k" and "sh1t" match. Only whole
+// words match, so "class" does not trip on a shorter blocked word.
+type WordFilter struct {
+	pattern *regexp.Regexp
+}
+
+func NewWordFilter(words []string) *WordFilter {
+	var alternatives []string
+	for _, word := range words {
+		normalized := normalizeWord(word)
+		if normalized == "" {
+			continue
+		}
+		// Repeated letters are allowed, "fuuuck" matches "fuck"
+		var pattern strings.Builder
+		for _, r := range normalized {
+			pattern.WriteString(regexp.QuoteMeta(string(r)) + "+")
+		}
+		alternatives = append(alternatives, pattern.String())
+	}
+	if len(alternatives) == 0 {
+		return &WordFilter{}
+	}
+	return &WordFilter{
+		pattern: regexp.MustCompile(`^(?:` + strings.Join(alternatives, "|") + `)` + wordSuffixes + `$`),
+	}
+}
+
+func (f *WordFilter) Check(senderID int, body string) (Finding, bool) {
+	if f.pattern == nil {
+		return Finding{}, false
+	}
+
+	found := false
+	var masked strings.Builder
+	start := -1
+	flush := func(end int) {
+		word := body[start:end]
+		// Punctuation around a word, like a full stop, is kept as written
+		core := strings.TrimFunc(word, func(r rune) bool {
+			_, leet := leetspeak[r]
+			return !leet && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if core != "" && f.pattern.MatchString(normalizeWord(core)) {
+			found = true
+			offset := strings.Index(word, core)
+			word = word[:offset] + maskRunes(core) + word[offset+len(core):]
+		}
+		masked.WriteString(word)
+		start = -1
+	}
+	for i, r := range body {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				flush(i)
+			}
+			masked.WriteRune(r)
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		flush(len(body))
+	}
+
+	if !found {
+		return Finding{}, false
+	}
+	return Finding{Reason: "blocked_word", Masked: masked.String()}, true
+}
+
+// normalizeWord lowercases a word, undoes leetspeak and drops everything that is not a letter
+func normalizeWord(word string) string {
+	var normalized strings.Builder
+	for _, r := range strings.ToLower(word) {
+		if letter, ok := leetspeak[r]; ok {
+			r = letter
+		}
+		if unicode.IsLetter(r) {
+			normalized.WriteRune(r)
+		}
+	}
+	return normalized.String()
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+|\b[a-z0-9][a-z0-9-]*(?:\.[a-z0-9-]+)*\.(?:com|net|org|gg|io|co|me|tv|ly|xyz|ru|info|biz|app|dev|link|site|shop)\b(?:/\S*)?`)
+
+// LinkFilter masks links, except those to the allowed hosts and their subdomains
+type LinkFilter struct {
+	allowed []string
+}
+
+func NewLinkFilter(allowedHosts []string) *LinkFilter {
+	allowed := make([]string, 0, len(allowedHosts))
+	for _, host := range allowedHosts {
+		allowed = append(allowed, strings.ToLower(strings.TrimSpace(host)))
+	}
+	return &LinkFilter{allowed: allowed}
+}
+
+func (f *LinkFilter) Check(senderID int, body string) (Finding, bool) {
+	found := false
+	masked := linkPattern.ReplaceAllStringFunc(body, func(link string) string {
+		if f.isAllowed(link) {
+			return link
+		}
+		found = true
+		return "[link removed]"
+	})
+	if !found {
+		return Finding{}, false
+	}
+	return Finding{Reason: "link", Masked: masked}, true
+}
+
+func (f *LinkFilter) isAllowed(link string) bool {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	for _, allowed := range f.allowed {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// Messages with at least capsMinLetters letters, of which capsRatio or more
+// are upper case, are shouting and get lowercased
+const (
+	capsMinLetters = 8
+	capsRatio      = 0.7
+)
+
+// CapsFilter lowercases messages written mostly in capitals
+type CapsFilter struct{}
+
+func NewCapsFilter() *CapsFilter {
+	return &CapsFilter{}
+}
+
+func (f *CapsFilter) Check(senderID int, body string) (Finding, bool) {
+	letters, upper := 0, 0
+	for _, r := range body {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	if letters < capsMinLetters || float64(upper) < capsRatio*float64(letters) {
+		return Finding{}, false
+	}
+	return Finding{Reason: "caps", Masked: strings.ToLower(body)}, true
+}
+
+const (
+	// spamMaxRepeatedChars is the longest run of one character allowed, longer runs are shortened
+	spamMaxRepeatedChars = 5
+	// spamWindow is how far back sent messages are remembered
+	spamWindow = 30 * time.Second
+	// spamMaxDuplicates is how many times the same message may be sent within the window
+	spamMaxDuplicates = 2
+	// spamFloodWindow and spamFloodLimit bound how fast a player may send
+	spamFloodWindow = 5 * time.Second
+	spamFloodLimit  = 5
+)
+
+type sentMessage struct {
+	body string
+	at   time.Time
+}
+
+// SpamFilter shortens long runs of one character and blocks repeated
+// messages and floods. It remembers what each player sent recently.
+type SpamFilter struct {
+	mutex     sync.Mutex
+	recent    map[int][]sentMessage
+	lastSweep time.Time
+}
+
+func NewSpamFilter() *SpamFilter {
+	return &SpamFilter{recent: make(map[int][]sentMessage)}
+}
+
+func (f *SpamFilter) Check(senderID int, body string) (Finding, bool) {
+	now := time.Now()
+	normalized := strings.ToLower(strings.Join(strings.Fields(body), " "))
+
+	f.mutex.Lock()
+	f.sweep(now)
+	recent := f.prune(f.recent[senderID], now)
+	duplicates, inFloodWindow := 0, 0
+	for _, sent := range recent {
+		if sent.body == normalized {
+			duplicates++
+		}
+		if now.Sub(sent.at) < spamFloodWindow {
+			inFloodWindow++
+		}
+	}
+	f.recent[senderID] = append(recent, sentMessage{body: normalized, at: now})
+	f.mutex.Unlock()
+
+	switch {
+	case inFloodWindow >= spamFloodLimit:
+		return Finding{Reason: "flood"}, true
+	case duplicates >= spamMaxDuplicates:
+		return Finding{Reason: "repeated_message"}, true
+	}
+
+	if shortened, ok := shortenRuns(body); ok {
+		return Finding{Reason: "repeated_characters", Masked: shortened}, true
+	}
+	return Finding{}, false
+}
+
+// prune drops messages older than the window
+func (f *SpamFilter) prune(recent []sentMessage, now time.Time) []sentMessage {
+	kept := recent[:0]
+	for _, sent := range recent {
+		if now.Sub(sent.at) < spamWindow {
+			kept = append(kept, sent)
+		}
+	}
+	return kept
+}
+
+// sweep forgets players who have not sent anything within the window, so the map does not grow forever
+func (f *SpamFilter) sweep(now time.Time) {
+	if now.Sub(f.lastSweep) < spamWindow {
+		return
+	}
+	f.lastSweep = now
+	for senderID, recent := range f.recent {
+		if recent = f.prune(recent, now); len(recent) == 0 {
+			delete(f.recent, senderID)
+		} else {
+			f.recent[senderID] = recent
+		}
+	}
+}
+
+// shortenRuns cuts runs of one character down to spamMaxRepeatedChars, reporting whether any were cut
+func shortenRuns(body string) (string, bool) {
+	var shortened strings.Builder
+	var previous rune
+	run, cut := 0, false
+	for _, r := range body {
+		if r == previous {
+			run++
+		} else {
+			previous, run = r, 1
+		}
+		if run > spamMaxRepeatedChars {
+			cut = true
+			continue
+		}
+		shortened.WriteRune(r)
+	}
+	return shortened.String(), cut
+}
@@ -0,0 +1,89 @@
+package chat
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// historyPerSender is how many messages are kept for each player
+	historyPerSender = 50
+	// historyMaxAge is how long a message is kept
+	historyMaxAge = 30 * time.Minute
+)
+
+type historyEntry struct {
+	message    Message
+	recipients map[int]bool
+}
+
+// History keeps the messages each player sent recently, along with who
+// received them, so reports can capture the chat the reporter saw.
+// Nothing is written to the database until a report is filed.
+type History struct {
+	mutex     sync.Mutex
+	sent      map[int][]historyEntry
+	lastSweep time.Time
+}
+
+func NewHistory() *History {
+	return &History{sent: make(map[int][]historyEntry)}
+}
+
+// Add remembers a delivered message and its recipients
+func (h *History) Add(message *Message, recipients []int) {
+	entry := historyEntry{message: *message, recipients: make(map[int]bool, len(recipients))}
+	for _, userID := range recipients {
+		entry.recipients[userID] = true
+	}
+
+	now := time.Now()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.sweep(now)
+	sent := append(pruneHistory(h.sent[message.SenderID], now), entry)
+	if len(sent) > historyPerSender {
+		sent = sent[len(sent)-historyPerSender:]
+	}
+	h.sent[message.SenderID] = sent
+}
+
+// SeenBy returns the recent messages of the sender that the viewer received, oldest first
+func (h *History) SeenBy(senderID, viewerID int) []Message {
+	now := time.Now()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	var messages []Message
+	for _, entry := range pruneHistory(h.sent[senderID], now) {
+		if entry.recipients[viewerID] {
+			messages = append(messages, entry.message)
+		}
+	}
+	return messages
+}
+
+// sweep forgets players who have not chatted within historyMaxAge
+func (h *History) sweep(now time.Time) {
+	if now.Sub(h.lastSweep) < historyMaxAge {
+		return
+	}
+	h.lastSweep = now
+	for senderID, sent := range h.sent {
+		if sent = pruneHistory(sent, now); len(sent) == 0 {
+			delete(h.sent, senderID)
+		} else {
+			h.sent[senderID] = sent
+		}
+	}
+}
+
+// pruneHistory drops entries older than historyMaxAge, entries are kept in the order they were sent
+func pruneHistory(sent []historyEntry, now time.Time) []historyEntry {
+	for i, entry := range sent {
+		if now.Sub(entry.message.SentAt) < historyMaxAge {
+			return sent[i:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+// Package console runs the operator console. Interactive mode redraws a
+// status screen and reads commands from stdin, headless mode only logs.
+package console
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"openchamp/server/internal/config"
+	"openchamp/server/internal/logging"
+	"openchamp/server/internal/moderation"
+	"openchamp/server/internal/store"
+	"openchamp/server/internal/util"
+	"openchamp/server/internal/websocket"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	refreshInterval  = 5 * time.Second
+	headlessInterval = 1 * time.Minute
+
+	tailSize       = 200
+	shownLogLines  = 10
+	shownUsers     = 15
+	defaultKickMsg = "kicked"
+)
+
+const help = `Commands:
+  kick <username> [reason]           Disconnect a player
+  ban <username> <minutes> <reason>  Ban a player, 0 minutes is permanent
+  broadcast <message>                Send an announcement to every client
+  loglevel <debug|info|warn|error>   Change the log level
+  quit                               Shut the server down gracefully
+  help                               Show this list`
+
+// consoleClient keeps a hung server from blocking the console
+var consoleClient = http.Client{Timeout: 3 * time.Second}
+
+// Console is the interactive operator console
+type Console struct {
+	cfg    config.Config
+	dbPool *pgxpool.Pool
+	users  store.UserStore
+	stop   func()
+	tail   *Tail
+
+	mutex  sync.Mutex // Serializes drawing and command handling
+	output string     // Result of the last command
+	done   chan struct{}
+}
+
+// Start takes over the terminal. Log output is kept in memory and shown on
+// the status screen until Close. stop is called when an operator asks the server to quit.
+func Start(cfg config.Config, dbPool *pgxpool.Pool, users store.UserStore, stop func()) *Console {
+	c := &Console{
+		cfg:    cfg,
+		dbPool: dbPool,
+		users:  users,
+		stop:   stop,
+		tail:   NewTail(tailSize),
+		output: "Type help for a list of commands",
+		done:   make(chan struct{}),
+	}
+	logging.SetTerminal(c.tail)
+
+	go c.refresh()
+	go c.readCommands()
+	return c
+}
+
+// Close stops redrawing and sends log output back to stdout
+func (c *Console) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	close(c.done)
+	logging.SetTerminal(nil)
+}
+
+// StartHeadless logs a short status line periodically instead of drawing a screen
+func StartHeadless() {
+	go func() {
+		for range time.Tick(headlessInterval) {
+			log.WithFields(log.Fields{
+				"clients":       websocket.GetConnectedClientsCount(),
+				"authenticated": len(websocket.ConnectedUsers()),
+			}).Info("Status")
+		}
+	}()
+}
+
+func (c *Console) refresh() {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	c.draw()
+	for {
+		select {
+		case <-ticker.C:
+			c.draw()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *Console) readCommands() {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		output := c.execute(line)
+
+		c.mutex.Lock()
+		c.output = "> " + line + "\n" + output
+		c.mutex.Unlock()
+		c.draw()
+	}
+}
+
+// draw clears the terminal and prints the status screen
+func (c *Console) draw() {
+	// Readiness is fetched before locking, it can take a few seconds
+	webStatus := checkReadiness(c.cfg.WebPort, 8080)
+	wsStatus := checkReadiness(c.cfg.WebSocketPort, 8081)
+	connected := websocket.GetConnectedClientsCount()
+	users := websocket.ConnectedUsers()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	util.ConsoleTitle()
+	fmt.Println("WebServer Status: " + webStatus)
+	fmt.Println("WebSocket Status: " + wsStatus)
+	fmt.Printf("Connections: %d (%d authenticated)\n", connected, len(users))
+
+	fmt.Println()
+	fmt.Println("Players:")
+	if len(users) == 0 {
+		fmt.Println("  none")
+	}
+	for i, user := range users {
+		if i == shownUsers {
+			fmt.Printf("  ... and %d more\n", len(users)-shownUsers)
+			break
+		}
+		fmt.Printf("  %-20s %-10s %s\n", user.Username, user.Role, user.RemoteAddr)
+	}
+
+	fmt.Println()
+	fmt.Println("Recent log:")
+	lines := c.tail.Lines()
+	if len(lines) > shownLogLines {
+		lines = lines[len(lines)-shownLogLines:]
+	}
+	for _, line := range lines {
+		fmt.Println("  " + line)
+	}
+
+	fmt.Println()
+	fmt.Println(c.output)
+	fmt.Print("> ")
+}
+
+// execute runs one console command and returns what to show the operator
+func (c *Console) execute(line string) string {
+	command, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+
+	switch strings.ToLower(command) {
+	case "help":
+		return help
+
+	case "kick":
+		username, reason, _ := strings.Cut(rest, " ")
+		if username == "" {
+			return "Usage: kick <username> [reason]"
+		}
+		reason = strings.TrimSpace(reason)
+		if reason == "" {
+			reason = defaultKickMsg
+		}
+		for _, user := range websocket.ConnectedUsers() {
+			if strings.EqualFold(user.Username, username) {
+				websocket.DisconnectUser(user.UserID, reason)
+				log.WithFields(log.Fields{
+					"username": user.Username,
+					"reason":   reason,
+				}).Info("Console kicked a user")
+				return "Kicked " + user.Username
+			}
+		}
+		return username + " is not connected"
+
+	case "ban":
+		return c.ban(rest)
+
+	case "broadcast":
+		if rest == "" {
+			return "Usage: broadcast <message>"
+		}
+		websocket.Announce(rest)
+		log.WithFields(log.Fields{
+			"message": rest,
+		}).Info("Console broadcast")
+		return "Sent to " + strconv.Itoa(websocket.GetConnectedClientsCount()) + " clients"
+
+	case "loglevel":
+		if err := logging.SetLevel(rest); err != nil {
+			return "Usage: loglevel <debug|info|warn|error>"
+		}
+		return "Log level set to " + rest
+
+	case "quit", "exit", "shutdown":
+		c.stop()
+		return "Shutting down"
+	}
+	return "Unknown command " + command + ", type help for a list of commands"
+}
+
+func (c *Console) ban(args string) string {
+	const usage = "Usage: ban <username> <minutes> <reason>"
+	fields := strings.SplitN(args, " ", 3)
+	if len(fields) < 3 || strings.TrimSpace(fields[2]) == "" {
+		return usage
+	}
+	minutes, err := strconv.Atoi(fields[1])
+	if err != nil || minutes < 0 {
+		return usage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := c.users.UserByUsername(ctx, fields[0])
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return "Unknown user " + fields[0]
+		}
+		return "Looking up the user failed: " + err.Error()
+	}
+
+	sanction, err := websocket.IssueSanction(c.dbPool, user.ID, moderation.SanctionBan,
+		strings.TrimSpace(fields[2]), nil, time.Duration(minutes)*time.Minute)
+	if err != nil {
+		return "Banning failed: " + err.Error()
+	}
+	log.WithFields(log.Fields{
+		"username": user.Username,
+		"reason":   sanction.Reason,
+	}).Info("Console banned a user")
+	if sanction.ExpiresAt == nil {
+		return "Banned " + user.Username + " permanently"
+	}
+	return "Banned " + user.Username + " until " + sanction.ExpiresAt.Format(time.RFC1123)
+}
+
+// checkReadiness asks a local server for its readiness and describes the answer
+func checkReadiness(port, defaultPort int) string {
+	if port == 0 {
+		port = defaultPort
+	}
+	resp, err := consoleClient.Get(fmt.Sprintf("http://localhost:%d/readyz", port))
+	if err != nil {
+		return "unreachable (" + err.Error() + ")"
+	}
+	defer resp.Body.Close()
+
+	var readiness struct {
+		Status string `json:"status"`
+		Checks map[string]struct {
+			OK    bool   `json:"ok"`
+			Error string `json:"error"`
+		} `json:"checks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&readiness); err != nil {
+		return fmt.Sprint(resp.StatusCode)
+	}
+
+	status := fmt.Sprintf("%d %s", resp.StatusCode, readiness.Status)
+	for name, check := range readiness.Checks {
+		if !check.OK {
+			status += fmt.Sprintf("\n  %s: %s", name, check.Error)
+		}
+	}
+	return status
+}
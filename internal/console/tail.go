@@ -0,0 +1,42 @@
+package console
+
+import (
+	"strings"
+	"sync"
+)
+
+// Tail keeps the most recent log lines in memory, it is used as the log
+// output while the console owns the terminal
+type Tail struct {
+	mutex sync.Mutex
+	lines []string
+	size  int
+}
+
+func NewTail(size int) *Tail {
+	return &Tail{size: size}
+}
+
+func (t *Tail) add(line string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.size {
+		t.lines = t.lines[len(t.lines)-t.size:]
+	}
+}
+
+// Lines returns a copy of the stored lines, oldest first
+func (t *Tail) Lines() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]string(nil), t.lines...)
+}
+
+func (t *Tail) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		t.add(line)
+	}
+	return len(p), nil
+}
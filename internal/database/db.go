@@ -3,10 +3,12 @@ package database
 import (
 	"context"
 	"fmt"
-	"log"
+	"openchamp/server/internal/auth"
+	"openchamp/server/internal/metrics"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	log "github.com/sirupsen/logrus"
 )
 
 var DB *pgxpool.Pool
@@ -38,54 +40,37 @@ func InitDBPool(dbConnString string) (*pgxpool.Pool, error) {
 		return nil, err
 	}
 
+	// Export pool statistics on /metrics
+	metrics.RegisterPool(pool)
+
 	return pool, nil
 }
 
+// migrationTimeout bounds how long startup waits for the migration lock and the migrations themselves
+const migrationTimeout = 5 * time.Minute
+
+// SetupDatabase applies pending migrations and seeds the default role permissions
 func SetupDatabase(dbPool *pgxpool.Pool) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
 	defer cancel()
 
-	// Create users table
-	_, err := dbPool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS users (
-			id SERIAL PRIMARY KEY,
-			username VARCHAR(50) UNIQUE NOT NULL,
-			password_hash VARCHAR(255) NOT NULL,
-			email VARCHAR(255) UNIQUE,
-			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-			last_login TIMESTAMP
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create users table: %w", err)
+	if _, err := MigrateUp(ctx, dbPool); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
-	// Create auth_tokens table
-	_, err = dbPool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS auth_tokens (
-			id SERIAL PRIMARY KEY,
-			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
-			token VARCHAR(255) UNIQUE NOT NULL,
-			ip_address VARCHAR(50),
-			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-			expires_at TIMESTAMP NOT NULL,
-			last_used_at TIMESTAMP,
-			is_revoked BOOLEAN NOT NULL DEFAULT FALSE
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create auth_tokens table: %w", err)
-	}
-
-	// Create indexes for faster lookups
-	_, err = dbPool.Exec(ctx, `
-		CREATE INDEX IF NOT EXISTS idx_auth_tokens_token ON auth_tokens(token);
-		CREATE INDEX IF NOT EXISTS idx_auth_tokens_user_id ON auth_tokens(user_id);
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create indexes: %w", err)
+	// Seed default permissions for each role. Permissions are defined in code,
+	// so they are synced on every start instead of in a migration.
+	for role, permissions := range auth.DefaultRolePermissions {
+		for _, permission := range permissions {
+			_, err := dbPool.Exec(ctx,
+				"INSERT INTO role_permissions (role, permission) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+				string(role), string(permission))
+			if err != nil {
+				return fmt.Errorf("failed to seed role permissions: %w", err)
+			}
+		}
 	}
 
-	log.Println("Database tables initialized successfully")
+	log.Info("Database tables initialized successfully")
 	return nil
 }
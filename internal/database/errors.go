@@ -0,0 +1,19 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// CodeUniqueViolation is the Postgres error code for a unique constraint violation
+const CodeUniqueViolation = "23505"
+
+// UniqueViolation reports whether err is a unique constraint violation and which constraint was hit
+func UniqueViolation(err error) (string, bool) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == CodeUniqueViolation {
+		return pgErr.ConstraintName, true
+	}
+	return "", false
+}
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS external_identities;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS service_accounts;
+DROP TABLE IF EXISTS audit_events;
+DROP TABLE IF EXISTS sanctions;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS auth_tokens;
+DROP TABLE IF EXISTS users;
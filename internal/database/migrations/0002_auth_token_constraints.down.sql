@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_auth_tokens_token ON auth_tokens(token);
+ALTER TABLE auth_tokens ALTER COLUMN user_id DROP NOT NULL;
@@ -0,0 +1,5 @@
+-- Tokens always belong to a user, and the UNIQUE constraint on token already
+-- provides an index so the separate one only slows down writes.
+DELETE FROM auth_tokens WHERE user_id IS NULL;
+ALTER TABLE auth_tokens ALTER COLUMN user_id SET NOT NULL;
+DROP INDEX IF EXISTS idx_auth_tokens_token;
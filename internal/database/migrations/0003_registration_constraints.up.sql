@@ -0,0 +1,6 @@
+-- Usernames are unique regardless of case. Accounts that only differ in case
+-- have to be renamed before this migration can be applied.
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_lower_key ON users (LOWER(username));
+-- Accounts without an email store NULL, an empty string would collide with
+-- the UNIQUE constraint on email.
+UPDATE users SET email = NULL WHERE email = '';
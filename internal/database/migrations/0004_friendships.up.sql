@@ -0,0 +1,14 @@
+-- Friendships are stored once per direction. A request is a pending row from
+-- the requester to the target, accepting it makes both rows accepted. A
+-- blocked row hides the friend from the user who blocked them.
+CREATE TABLE friendships (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    friend_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('pending', 'accepted', 'blocked')),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, friend_id),
+    CHECK (user_id <> friend_id)
+);
+
+CREATE INDEX idx_friendships_friend ON friendships(friend_id);
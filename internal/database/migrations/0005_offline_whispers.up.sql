@@ -0,0 +1,12 @@
+-- Whispers to players who are offline wait here until their next login.
+-- The id is assigned by the server and is the same one the sender saw.
+CREATE TABLE offline_whispers (
+    id UUID PRIMARY KEY,
+    sender_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    recipient_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    sent_at TIMESTAMP NOT NULL,
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX idx_offline_whispers_pending ON offline_whispers(recipient_id, sent_at) WHERE delivered_at IS NULL;
@@ -0,0 +1,20 @@
+-- Messages that tripped a chat filter. The body is the message as written,
+-- before masking. Flagged messages wait for a moderator to review them and
+-- every violation counts towards an automatic chat restriction.
+CREATE TABLE chat_violations (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message_id UUID NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    channel VARCHAR(64),
+    recipient_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    body TEXT NOT NULL,
+    reasons TEXT[] NOT NULL,
+    action VARCHAR(16) NOT NULL CHECK (action IN ('mask', 'block', 'flag')),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMP
+);
+
+CREATE INDEX idx_chat_violations_user ON chat_violations(user_id, created_at);
+CREATE INDEX idx_chat_violations_pending ON chat_violations(created_at) WHERE action = 'flag' AND reviewed_at IS NULL;
@@ -0,0 +1,26 @@
+-- Reports players file against each other. Evidence is captured by the server
+-- when the report is filed. A report is open until a moderator dismisses it
+-- or takes action, which links the sanction they issued. Reporters of
+-- actioned reports are told once, reporter_notified records that they were.
+CREATE TABLE player_reports (
+    id SERIAL PRIMARY KEY,
+    reporter_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    reported_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    category VARCHAR(32) NOT NULL,
+    comment TEXT NOT NULL DEFAULT '',
+    match_id VARCHAR(64),
+    evidence JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(16) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'dismissed', 'actioned')),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    resolved_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP,
+    resolution_note TEXT,
+    sanction_id INTEGER REFERENCES sanctions(id) ON DELETE SET NULL,
+    reporter_notified BOOLEAN NOT NULL DEFAULT FALSE,
+    CHECK (reporter_id IS NULL OR reporter_id <> reported_id)
+);
+
+CREATE INDEX idx_player_reports_open ON player_reports(created_at) WHERE status = 'open';
+CREATE INDEX idx_player_reports_reported ON player_reports(reported_id);
+CREATE INDEX idx_player_reports_reporter ON player_reports(reporter_id, created_at);
+CREATE INDEX idx_player_reports_feedback ON player_reports(reporter_id) WHERE status = 'actioned' AND NOT reporter_notified;
@@ -0,0 +1,8 @@
+ALTER TABLE friendships DROP CONSTRAINT friendships_status_check;
+ALTER TABLE friendships ADD CONSTRAINT friendships_status_check CHECK (status IN ('pending', 'accepted', 'blocked'));
+
+INSERT INTO friendships (user_id, friend_id, status, created_at, updated_at)
+SELECT blocker_id, blocked_id, 'blocked', created_at, created_at FROM user_blocks
+ON CONFLICT (user_id, friend_id) DO UPDATE SET status = 'blocked', updated_at = NOW();
+
+DROP TABLE IF EXISTS user_blocks;
@@ -0,0 +1,22 @@
+-- Blocks move out of friendships into their own table. A block is one
+-- directional: the blocker stops all contact with the blocked player and
+-- no longer sees their chat. avoid_as_teammate also asks the matchmaker to
+-- keep them off the blocker's team where it can.
+CREATE TABLE user_blocks (
+    blocker_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    avoid_as_teammate BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (blocker_id, blocked_id),
+    CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX idx_user_blocks_blocked ON user_blocks(blocked_id);
+
+INSERT INTO user_blocks (blocker_id, blocked_id, created_at)
+SELECT user_id, friend_id, created_at FROM friendships WHERE status = 'blocked';
+
+DELETE FROM friendships WHERE status = 'blocked';
+
+ALTER TABLE friendships DROP CONSTRAINT friendships_status_check;
+ALTER TABLE friendships ADD CONSTRAINT friendships_status_check CHECK (status IN ('pending', 'accepted'));
@@ -0,0 +1,118 @@
+// Package logging configures the logrus standard logger that every package
+// logs through. Output goes to rotated files and, unless disabled, stdout.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"openchamp/server/internal/config"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fileName is the prefix of the rotated log files
+const fileName = "openchamp"
+
+var (
+	file     *RotatingFile
+	terminal = &swapWriter{w: os.Stdout}
+	// remaining is the output left once the file is closed
+	remaining io.Writer = terminal
+)
+
+// swapWriter lets the terminal output be replaced while the logger is in use
+type swapWriter struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func (s *swapWriter) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.w.Write(p)
+}
+
+func (s *swapWriter) set(w io.Writer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.w = w
+}
+
+// Setup applies the configuration to the standard logger. Packages log with
+// the logrus package functions, so nothing else has to be passed around.
+func Setup(cfg config.LogConfig) error {
+	logger := logrus.StandardLogger()
+	level, err := parseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	logger.SetLevel(level)
+	if cfg.JSON {
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	}
+
+	var outputs []io.Writer
+	if cfg.Files {
+		rotating, err := NewRotatingFile(cfg.Dir, fileName,
+			int64(cfg.MaxSizeMB)*1024*1024, time.Duration(cfg.MaxAgeDays)*24*time.Hour)
+		if err != nil {
+			return err
+		}
+		file = rotating
+		outputs = append(outputs, file)
+	}
+	remaining = io.Discard
+	if cfg.Stdout {
+		outputs = append(outputs, terminal)
+		remaining = terminal
+	}
+	logger.SetOutput(io.MultiWriter(outputs...))
+
+	if file != nil {
+		logrus.Infof("Logs will be written to %s", file.Path())
+	}
+	return nil
+}
+
+// SetTerminal replaces stdout as the terminal output, for example while the
+// console draws the screen. Passing nil restores stdout.
+func SetTerminal(w io.Writer) {
+	if w == nil {
+		w = os.Stdout
+	}
+	terminal.set(w)
+}
+
+// SetLevel changes the log level at runtime, accepting debug, info, warn and error
+func SetLevel(level string) error {
+	parsed, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	logrus.SetLevel(parsed)
+	logrus.WithFields(logrus.Fields{
+		"log_level": level,
+	}).Info("Log level changed")
+	return nil
+}
+
+func parseLevel(level string) (logrus.Level, error) {
+	switch level {
+	case "debug", "info", "warn", "error":
+		return logrus.ParseLevel(level)
+	}
+	return 0, fmt.Errorf("unknown log level %q", level)
+}
+
+// Close closes the log file, later output only reaches the terminal if enabled
+func Close() {
+	if file != nil {
+		logrus.SetOutput(remaining)
+		file.Close()
+	}
+}
@@ -0,0 +1,141 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// RotatingFile writes to <dir>/<name>-<date>.log, starting a new file every
+// day and whenever the current one grows past maxSize. Files older than
+// maxAge are deleted each time a new file is started.
+type RotatingFile struct {
+	dir     string
+	name    string
+	maxSize int64
+	maxAge  time.Duration
+	now     func() time.Time // Replaced by tests to change the date
+
+	mutex sync.Mutex
+	file  *os.File
+	date  string
+	index int // Number of the current file within the day
+	size  int64
+}
+
+// NewRotatingFile opens today's log file, creating the directory if needed.
+// A zero maxSize or maxAge disables that limit.
+func NewRotatingFile(dir, name string, maxSize int64, maxAge time.Duration) (*RotatingFile, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create logs directory: %w", err)
+	}
+	f := &RotatingFile{dir: dir, name: name, maxSize: maxSize, maxAge: maxAge, now: time.Now}
+	if err := f.rotate(f.now().Format(dateLayout), 0); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Path returns the file currently written to
+func (f *RotatingFile) Path() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.file.Name()
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if date := f.now().Format(dateLayout); date != f.date {
+		if err := f.rotate(date, 0); err != nil {
+			return 0, err
+		}
+	} else if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(date, f.index+1); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file, later writes fail
+func (f *RotatingFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// rotate switches to the first file of the date from index on that still
+// has room, and removes expired files
+func (f *RotatingFile) rotate(date string, index int) error {
+	for ; ; index++ {
+		path := filepath.Join(f.dir, fmt.Sprintf("%s-%s.log", f.name, date))
+		if index > 0 {
+			path = filepath.Join(f.dir, fmt.Sprintf("%s-%s.%d.log", f.name, date, index))
+		}
+		info, err := os.Stat(path)
+		if err == nil && f.maxSize > 0 && info.Size() >= f.maxSize {
+			continue
+		}
+
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		info, err = file.Stat()
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		if f.file != nil {
+			f.file.Close()
+		}
+		f.file, f.date, f.index, f.size = file, date, index, info.Size()
+		break
+	}
+
+	f.removeExpired()
+	return nil
+}
+
+// removeExpired deletes this logger's files that were last written before the retention period
+func (f *RotatingFile) removeExpired() {
+	if f.maxAge <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return
+	}
+	cutoff := f.now().Add(-f.maxAge)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, f.name+"-") || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if path := filepath.Join(f.dir, name); path != f.file.Name() {
+			os.Remove(path)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func mustWrite(t *testing.T, f *RotatingFile, line string) {
+	t.Helper()
+	if _, err := f.Write([]byte(line)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotatingFileSize(t *testing.T) {
+	dir := t.TempDir()
+	f, err := NewRotatingFile(dir, "server", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	today := time.Now().Format(dateLayout)
+	first := filepath.Join(dir, "server-"+today+".log")
+	second := filepath.Join(dir, "server-"+today+".1.log")
+
+	mustWrite(t, f, "123456789\n")
+	mustWrite(t, f, "abc\n")
+	if f.Path() != second {
+		t.Fatalf("Path() = %q after passing the size limit, want %q", f.Path(), second)
+	}
+	if got := readLog(t, first); got != "123456789\n" {
+		t.Errorf("first file = %q", got)
+	}
+	if got := readLog(t, second); got != "abc\n" {
+		t.Errorf("second file = %q", got)
+	}
+
+	// A line longer than the limit still goes into an empty file whole
+	mustWrite(t, f, "this line is too long\n")
+	if got := readLog(t, filepath.Join(dir, "server-"+today+".2.log")); got != "this line is too long\n" {
+		t.Errorf("third file = %q", got)
+	}
+
+	// A restart skips the full first file and continues in the first one with room
+	f.Close()
+	reopened, err := NewRotatingFile(dir, "server", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if reopened.Path() != second {
+		t.Errorf("Path() after reopening = %q, want %q", reopened.Path(), second)
+	}
+}
+
+func TestRotatingFileDate(t *testing.T) {
+	dir := t.TempDir()
+	f, err := NewRotatingFile(dir, "server", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	mustWrite(t, f, "12345678\n")
+	mustWrite(t, f, "abc\n")
+
+	// The next day starts again at the first file, whatever the size of the last one
+	tomorrow := time.Now().Add(24 * time.Hour)
+	f.now = func() time.Time { return tomorrow }
+	mustWrite(t, f, "next day\n")
+	want := filepath.Join(dir, "server-"+tomorrow.Format(dateLayout)+".log")
+	if f.Path() != want {
+		t.Fatalf("Path() = %q after the date changed, want %q", f.Path(), want)
+	}
+	if got := readLog(t, want); got != "next day\n" {
+		t.Errorf("new day file = %q", got)
+	}
+}
+
+func TestRotatingFileRemovesExpired(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-72 * time.Hour)
+	files := map[string]bool{ // Name to whether it should survive
+		"server-2000-01-01.log":   false,
+		"server-2000-01-02.1.log": false,
+		"server-recent.log":       true,
+		"other-2000-01-01.log":    true, // Another logger's file
+		"server-notes.txt":        true, // Not a log file
+	}
+	for name := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("line\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if name != "server-recent.log" {
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	f, err := NewRotatingFile(dir, "server", 0, 48*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for name, kept := range files {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if exists := err == nil; exists != kept {
+			t.Errorf("%s exists = %v, want %v", name, exists, kept)
+		}
+	}
+	if _, err := os.Stat(f.Path()); err != nil {
+		t.Errorf("current file was removed: %v", err)
+	}
+}
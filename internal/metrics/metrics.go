@@ -0,0 +1,130 @@
+// Package metrics defines the Prometheus metrics exported on /metrics
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "openchamp"
+
+var (
+	ActiveConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "active_connections",
+		Help:      "Number of open WebSocket connections.",
+	})
+	Connects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "connects_total",
+		Help:      "WebSocket connections accepted.",
+	})
+	Disconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "disconnects_total",
+		Help:      "WebSocket connections closed, by reason.",
+	}, []string{"reason"})
+	MessagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "messages_received_total",
+		Help:      "Messages received from clients, by message type.",
+	}, []string{"type"})
+	MessagesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "messages_sent_total",
+		Help:      "Messages sent to clients, by message type.",
+	}, []string{"type"})
+	HandlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "handler_duration_seconds",
+		Help:      "Time spent handling a message, by message type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"type"})
+
+	AuthSuccesses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "successes_total",
+		Help:      "Successful logins, by method.",
+	}, []string{"method"})
+	AuthFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "failures_total",
+		Help:      "Failed logins, by reason.",
+	}, []string{"reason"})
+	BcryptDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "bcrypt_duration_seconds",
+		Help:      "Time spent hashing or comparing passwords.",
+		Buckets:   []float64{0.01, 0.025, 0.05, 0.1, 0.2, 0.3, 0.5, 0.75, 1, 2},
+	}, []string{"operation"})
+)
+
+// UnknownType is the label used for message types without a handler, so
+// clients can not create unbounded label values
+const UnknownType = "unknown"
+
+// RegisterPool exports the connection pool statistics
+func RegisterPool(pool *pgxpool.Pool) {
+	prometheus.MustRegister(&poolCollector{pool: pool})
+}
+
+// poolCollector reads pgxpool statistics at scrape time
+type poolCollector struct {
+	pool *pgxpool.Pool
+}
+
+var (
+	poolMaxConns = prometheus.NewDesc(namespace+"_db_pool_max_connections",
+		"Maximum size of the connection pool.", nil, nil)
+	poolTotalConns = prometheus.NewDesc(namespace+"_db_pool_total_connections",
+		"Connections currently in the pool.", nil, nil)
+	poolIdleConns = prometheus.NewDesc(namespace+"_db_pool_idle_connections",
+		"Idle connections in the pool.", nil, nil)
+	poolAcquiredConns = prometheus.NewDesc(namespace+"_db_pool_acquired_connections",
+		"Connections currently in use.", nil, nil)
+	poolConstructingConns = prometheus.NewDesc(namespace+"_db_pool_constructing_connections",
+		"Connections being established.", nil, nil)
+	poolAcquires = prometheus.NewDesc(namespace+"_db_pool_acquires_total",
+		"Successful connection acquires.", nil, nil)
+	poolEmptyAcquires = prometheus.NewDesc(namespace+"_db_pool_empty_acquires_total",
+		"Acquires that had to wait for a connection.", nil, nil)
+	poolCanceledAcquires = prometheus.NewDesc(namespace+"_db_pool_canceled_acquires_total",
+		"Acquires canceled by their context.", nil, nil)
+	poolAcquireDuration = prometheus.NewDesc(namespace+"_db_pool_acquire_duration_seconds_total",
+		"Total time spent acquiring connections.", nil, nil)
+)
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolMaxConns
+	ch <- poolTotalConns
+	ch <- poolIdleConns
+	ch <- poolAcquiredConns
+	ch <- poolConstructingConns
+	ch <- poolAcquires
+	ch <- poolEmptyAcquires
+	ch <- poolCanceledAcquires
+	ch <- poolAcquireDuration
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(poolMaxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolConstructingConns, prometheus.GaugeValue, float64(stat.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolCanceledAcquires, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
@@ -0,0 +1,95 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"openchamp/server/internal/auth"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrOutranked is returned when the target's role is equal to or above the issuer's
+var ErrOutranked = errors.New("you cannot sanction a user whose role is equal to or above yours")
+
+// ranks looks up what the rank checks compare
+type ranks interface {
+	// role returns false when the user does not exist
+	role(ctx context.Context, userID int) (auth.Role, bool, error)
+	// sanctionUser returns the user a sanction was placed on, false when the sanction does not exist
+	sanctionUser(ctx context.Context, sanctionID int) (int, bool, error)
+}
+
+// poolRanks reads ranks from the database
+type poolRanks struct {
+	dbPool *pgxpool.Pool
+}
+
+func (p poolRanks) role(ctx context.Context, userID int) (auth.Role, bool, error) {
+	var role string
+	err := p.dbPool.QueryRow(ctx, "SELECT role FROM users WHERE id = $1", userID).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return auth.Role(role), true, nil
+}
+
+func (p poolRanks) sanctionUser(ctx context.Context, sanctionID int) (int, bool, error) {
+	var userID int
+	err := p.dbPool.QueryRow(ctx, "SELECT user_id FROM sanctions WHERE id = $1", sanctionID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return userID, true, nil
+}
+
+// CheckRank returns ErrOutranked unless the issuer's role is above the
+// target's, so moderators cannot sanction each other or admins. A nil issuer
+// is a service account, which ranks like a moderator. An unknown target is
+// left for the caller to report.
+func CheckRank(ctx context.Context, dbPool *pgxpool.Pool, issuedBy *int, userID int) error {
+	return checkRank(ctx, poolRanks{dbPool}, issuedBy, userID)
+}
+
+// CheckRevokeRank applies the rank rule of CheckRank to the user a sanction
+// was placed on, so nobody lifts a sanction on themselves or a peer. An
+// unknown sanction is left for RevokeSanction to report.
+func CheckRevokeRank(ctx context.Context, dbPool *pgxpool.Pool, revokedBy *int, sanctionID int) error {
+	return checkRevokeRank(ctx, poolRanks{dbPool}, revokedBy, sanctionID)
+}
+
+func checkRank(ctx context.Context, ranks ranks, issuedBy *int, userID int) error {
+	issuerRole := auth.RoleModerator
+	if issuedBy != nil {
+		role, found, err := ranks.role(ctx, *issuedBy)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return ErrOutranked
+		}
+		issuerRole = role
+	}
+	targetRole, found, err := ranks.role(ctx, userID)
+	if err != nil || !found {
+		return err
+	}
+	if !issuerRole.Outranks(targetRole) {
+		return ErrOutranked
+	}
+	return nil
+}
+
+func checkRevokeRank(ctx context.Context, ranks ranks, revokedBy *int, sanctionID int) error {
+	userID, found, err := ranks.sanctionUser(ctx, sanctionID)
+	if err != nil || !found {
+		return err
+	}
+	return checkRank(ctx, ranks, revokedBy, userID)
+}
@@ -0,0 +1,101 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"openchamp/server/internal/auth"
+	"testing"
+)
+
+// fakeRanks holds the roles of users and who each sanction was placed on
+type fakeRanks struct {
+	roles     map[int]auth.Role
+	sanctions map[int]int
+}
+
+func (f fakeRanks) role(ctx context.Context, userID int) (auth.Role, bool, error) {
+	role, found := f.roles[userID]
+	return role, found, nil
+}
+
+func (f fakeRanks) sanctionUser(ctx context.Context, sanctionID int) (int, bool, error) {
+	userID, found := f.sanctions[sanctionID]
+	return userID, found, nil
+}
+
+const (
+	player     = 1
+	moderator  = 2
+	moderator2 = 3
+	admin      = 4
+)
+
+var testRanks = fakeRanks{
+	roles: map[int]auth.Role{
+		player:     auth.RolePlayer,
+		moderator:  auth.RoleModerator,
+		moderator2: auth.RoleModerator,
+		admin:      auth.RoleAdmin,
+	},
+	// Sanctions are numbered after the user they were placed on
+	sanctions: map[int]int{
+		10 + player:     player,
+		10 + moderator:  moderator,
+		10 + moderator2: moderator2,
+		10 + admin:      admin,
+	},
+}
+
+func userID(id int) *int {
+	return &id
+}
+
+func TestCheckRank(t *testing.T) {
+	tests := []struct {
+		name     string
+		issuedBy *int
+		target   int
+		want     error
+	}{
+		{"moderator sanctions a player", userID(moderator), player, nil},
+		{"admin sanctions a moderator", userID(admin), moderator, nil},
+		{"moderator sanctions a peer", userID(moderator), moderator2, ErrOutranked},
+		{"moderator sanctions themselves", userID(moderator), moderator, ErrOutranked},
+		{"moderator sanctions an admin", userID(moderator), admin, ErrOutranked},
+		{"player sanctions a player", userID(player), player, ErrOutranked},
+		{"service account sanctions a player", nil, player, nil},
+		{"service account sanctions a moderator", nil, moderator, ErrOutranked},
+		{"unknown issuer", userID(99), player, ErrOutranked},
+		{"unknown target", userID(moderator), 99, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkRank(context.Background(), testRanks, tt.issuedBy, tt.target); !errors.Is(err, tt.want) {
+				t.Errorf("checkRank() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckRevokeRank(t *testing.T) {
+	tests := []struct {
+		name      string
+		revokedBy *int
+		sanction  int
+		want      error
+	}{
+		{"moderator lifts a player's sanction", userID(moderator), 10 + player, nil},
+		{"moderator lifts their own sanction", userID(moderator), 10 + moderator, ErrOutranked},
+		{"moderator lifts a peer's sanction", userID(moderator), 10 + moderator2, ErrOutranked},
+		{"admin lifts a moderator's sanction", userID(admin), 10 + moderator, nil},
+		{"admin lifts their own sanction", userID(admin), 10 + admin, ErrOutranked},
+		{"unknown sanction", userID(moderator), 99, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkRevokeRank(context.Background(), testRanks, tt.revokedBy, tt.sanction); !errors.Is(err, tt.want) {
+				t.Errorf("checkRevokeRank() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ReportCategory is why a player was reported
+type ReportCategory string
+
+const (
+	ReportHarassment        ReportCategory = "harassment"
+	ReportHateSpeech        ReportCategory = "hate_speech"
+	ReportCheating          ReportCategory = "cheating"
+	ReportGriefing          ReportCategory = "griefing"
+	ReportAFK               ReportCategory = "afk"
+	ReportInappropriateName ReportCategory = "inappropriate_name"
+	ReportSpam              ReportCategory = "spam"
+	ReportOther             ReportCategory = "other"
+)
+
+// ReportCategories lists every category players can choose from
+var ReportCategories = []ReportCategory{
+	ReportHarassment,
+	ReportHateSpeech,
+	ReportCheating,
+	ReportGriefing,
+	ReportAFK,
+	ReportInappropriateName,
+	ReportSpam,
+	ReportOther,
+}
+
+// IsValid reports whether c is one of the known categories
+func (c ReportCategory) IsValid() bool {
+	for _, category := range ReportCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// ReportStatus is where a report is in the moderator queue
+type ReportStatus string
+
+const (
+	ReportOpen      ReportStatus = "open"
+	ReportDismissed ReportStatus = "dismissed"
+	ReportActioned  ReportStatus = "actioned"
+)
+
+const (
+	// MaxReportComment bounds the reporter's comment in characters
+	MaxReportComment = 1000
+	// maxReportsPerDay bounds how many reports a player can file in 24 hours
+	maxReportsPerDay = 20
+)
+
+var (
+	ErrReportSelf      = errors.New("you cannot report yourself")
+	ErrReportDuplicate = errors.New("you already reported this player for this match")
+	ErrTooManyReports  = errors.New("you have filed too many reports today")
+	ErrReportNotFound  = errors.New("report not found or already resolved")
+)
+
+// Report is a complaint filed by one player about another. Evidence is
+// captured by the server, never supplied by the reporter.
+type Report struct {
+	ID             int                    `json:"id"`
+	ReporterID     *int                   `json:"reporter_id,omitempty"`
+	Reporter       string                 `json:"reporter,omitempty"`
+	ReportedID     int                    `json:"reported_id"`
+	Reported       string                 `json:"reported"`
+	Category       ReportCategory         `json:"category"`
+	Comment        string                 `json:"comment"`
+	MatchID        string                 `json:"match_id,omitempty"`
+	Evidence       map[string]interface{} `json:"evidence"`
+	Status         ReportStatus           `json:"status"`
+	CreatedAt      time.Time              `json:"created_at"`
+	ResolvedBy     *int                   `json:"resolved_by,omitempty"`
+	ResolvedAt     *time.Time             `json:"resolved_at,omitempty"`
+	ResolutionNote string                 `json:"resolution_note,omitempty"`
+	SanctionID     *int                   `json:"sanction_id,omitempty"`
+}
+
+// CreateReport files a report, setting its id and creation time. A player
+// can only have one open report against another per match, and only a
+// limited number of reports a day.
+func CreateReport(ctx context.Context, dbPool *pgxpool.Pool, report *Report) error {
+	if report.ReporterID != nil && *report.ReporterID == report.ReportedID {
+		return ErrReportSelf
+	}
+
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if report.ReporterID != nil {
+		// Serialise reports from the same player so the checks below hold
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('player_reports'), $1)", *report.ReporterID); err != nil {
+			return err
+		}
+		var recent int
+		var duplicate bool
+		err := tx.QueryRow(ctx,
+			`SELECT COUNT(*) FILTER (WHERE created_at > NOW() - INTERVAL '24 hours'),
+				COALESCE(BOOL_OR(status = 'open' AND reported_id = $2 AND COALESCE(match_id, '') = $3), FALSE)
+			FROM player_reports
+			WHERE reporter_id = $1 AND (status = 'open' OR created_at > NOW() - INTERVAL '24 hours')`,
+			*report.ReporterID, report.ReportedID, report.MatchID).Scan(&recent, &duplicate)
+		if err != nil {
+			return err
+		}
+		if duplicate {
+			return ErrReportDuplicate
+		}
+		if recent >= maxReportsPerDay {
+			return ErrTooManyReports
+		}
+	}
+
+	var matchID *string
+	if report.MatchID != "" {
+		matchID = &report.MatchID
+	}
+	if report.Evidence == nil {
+		report.Evidence = map[string]interface{}{}
+	}
+	report.Status = ReportOpen
+	err = tx.QueryRow(ctx,
+		`INSERT INTO player_reports (reporter_id, reported_id, category, comment, match_id, evidence)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		report.ReporterID, report.ReportedID, string(report.Category), report.Comment, matchID,
+		report.Evidence).Scan(&report.ID, &report.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Reports lists reports with the given status, oldest first so the queue is worked in order
+func Reports(ctx context.Context, dbPool *pgxpool.Pool, status ReportStatus, limit int) ([]Report, error) {
+	rows, err := dbPool.Query(ctx,
+		`SELECT r.id, r.reporter_id, COALESCE(reporter.username, ''), r.reported_id, reported.username,
+			r.category, r.comment, COALESCE(r.match_id, ''), r.evidence, r.status, r.created_at,
+			r.resolved_by, r.resolved_at, COALESCE(r.resolution_note, ''), r.sanction_id
+		FROM player_reports r
+		JOIN users reported ON reported.id = r.reported_id
+		LEFT JOIN users reporter ON reporter.id = r.reporter_id
+		WHERE r.status = $1
+		ORDER BY r.created_at
+		LIMIT $2`,
+		string(status), limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Report, error) {
+		var r Report
+		err := row.Scan(&r.ID, &r.ReporterID, &r.Reporter, &r.ReportedID, &r.Reported,
+			&r.Category, &r.Comment, &r.MatchID, &r.Evidence, &r.Status, &r.CreatedAt,
+			&r.ResolvedBy, &r.ResolvedAt, &r.ResolutionNote, &r.SanctionID)
+		return r, err
+	})
+}
+
+// OpenReport returns an open report, or ErrReportNotFound
+func OpenReport(ctx context.Context, dbPool *pgxpool.Pool, reportID int) (*Report, error) {
+	var r Report
+	err := dbPool.QueryRow(ctx,
+		`SELECT id, reporter_id, reported_id, category, status
+		FROM player_reports
+		WHERE id = $1 AND status = 'open'`,
+		reportID).Scan(&r.ID, &r.ReporterID, &r.ReportedID, &r.Category, &r.Status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrReportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ResolveReport closes an open report. A sanction marks it actioned, so the
+// reporter is told action was taken, without one it is dismissed.
+func ResolveReport(ctx context.Context, dbPool *pgxpool.Pool, reportID int, resolvedBy *int, note string, sanctionID *int) (ReportStatus, error) {
+	status := ReportDismissed
+	if sanctionID != nil {
+		status = ReportActioned
+	}
+	result, err := dbPool.Exec(ctx,
+		`UPDATE player_reports
+		SET status = $1, resolved_by = $2, resolved_at = NOW(), resolution_note = NULLIF($3, ''), sanction_id = $4
+		WHERE id = $5 AND status = 'open'`,
+		string(status), resolvedBy, note, sanctionID, reportID)
+	if err != nil {
+		return "", err
+	}
+	if result.RowsAffected() == 0 {
+		return "", ErrReportNotFound
+	}
+	return status, nil
+}
+
+// ReportFeedback is what a reporter is told once action was taken on their report
+type ReportFeedback struct {
+	ReportID  int
+	Category  ReportCategory
+	CreatedAt time.Time
+}
+
+// TakeReportFeedback returns the actioned reports the reporter has not been
+// told about, or only the given report when reportID is not zero, and marks them told
+func TakeReportFeedback(ctx context.Context, dbPool *pgxpool.Pool, reporterID, reportID int) ([]ReportFeedback, error) {
+	rows, err := dbPool.Query(ctx,
+		`UPDATE player_reports SET reporter_notified = TRUE
+		WHERE reporter_id = $1 AND status = 'actioned' AND NOT reporter_notified
+		AND ($2 = 0 OR id = $2)
+		RETURNING id, category, created_at`,
+		reporterID, reportID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (ReportFeedback, error) {
+		var feedback ReportFeedback
+		err := row.Scan(&feedback.ReportID, &feedback.Category, &feedback.CreatedAt)
+		return feedback, err
+	})
+}
@@ -0,0 +1,144 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"openchamp/server/internal/audit"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	log "github.com/sirupsen/logrus"
+)
+
+// SanctionType is the kind of restriction placed on an account
+type SanctionType string
+
+const (
+	SanctionBan               SanctionType = "ban"
+	SanctionChatRestriction   SanctionType = "chat_restriction"
+	SanctionRankedRestriction SanctionType = "ranked_restriction"
+)
+
+// IsValid reports whether t is one of the known sanction types
+func (t SanctionType) IsValid() bool {
+	switch t {
+	case SanctionBan, SanctionChatRestriction, SanctionRankedRestriction:
+		return true
+	}
+	return false
+}
+
+// Sanction is a ban or restriction on a user, a nil ExpiresAt means it is permanent
+type Sanction struct {
+	ID        int
+	UserID    int
+	Type      SanctionType
+	Reason    string
+	IssuedBy  *int
+	StartsAt  time.Time
+	ExpiresAt *time.Time
+}
+
+// Payload returns the sanction details sent to clients
+func (s *Sanction) Payload() map[string]interface{} {
+	payload := map[string]interface{}{
+		"id":        s.ID,
+		"type":      s.Type,
+		"reason":    s.Reason,
+		"startsAt":  s.StartsAt.UTC().Format(time.RFC3339),
+		"permanent": s.ExpiresAt == nil,
+	}
+	if s.ExpiresAt != nil {
+		payload["expiresAt"] = s.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return payload
+}
+
+// ActiveSanction returns the longest running active sanction of the given type, or nil if there is none
+func ActiveSanction(ctx context.Context, dbPool *pgxpool.Pool, userID int, sanctionType SanctionType) (*Sanction, error) {
+	var sanction Sanction
+	err := dbPool.QueryRow(ctx,
+		`SELECT id, user_id, type, reason, issued_by, starts_at, expires_at
+		FROM sanctions
+		WHERE user_id = $1 AND type = $2
+		AND revoked_at IS NULL
+		AND starts_at <= NOW()
+		AND (expires_at IS NULL OR expires_at > NOW())
+		ORDER BY expires_at DESC NULLS FIRST
+		LIMIT 1`,
+		userID, string(sanctionType)).Scan(&sanction.ID, &sanction.UserID, &sanction.Type,
+		&sanction.Reason, &sanction.IssuedBy, &sanction.StartsAt, &sanction.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &sanction, nil
+}
+
+// IssueSanction stores a new sanction. A zero duration makes it permanent.
+func IssueSanction(ctx context.Context, dbPool *pgxpool.Pool, userID int, sanctionType SanctionType, reason string, issuedBy *int, duration time.Duration) (*Sanction, error) {
+	var expiresAt *time.Time
+	if duration > 0 {
+		expiry := time.Now().Add(duration)
+		expiresAt = &expiry
+	}
+
+	sanction := Sanction{
+		UserID:    userID,
+		Type:      sanctionType,
+		Reason:    reason,
+		IssuedBy:  issuedBy,
+		ExpiresAt: expiresAt,
+	}
+	err := dbPool.QueryRow(ctx,
+		`INSERT INTO sanctions (user_id, type, reason, issued_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, starts_at`,
+		userID, string(sanctionType), reason, issuedBy, expiresAt).Scan(&sanction.ID, &sanction.StartsAt)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"sanction_id": sanction.ID,
+		"type":        sanctionType,
+		"user_id":     userID,
+	}).Info("Sanction issued")
+	audit.Record(dbPool, audit.Event{
+		Type:     audit.EventSanctionIssue,
+		ActorID:  issuedBy,
+		TargetID: &userID,
+		Details:  sanction.Payload(),
+	})
+	return &sanction, nil
+}
+
+// RevokeSanction lifts a sanction early, returning false if it does not exist or was already revoked
+func RevokeSanction(ctx context.Context, dbPool *pgxpool.Pool, sanctionID int, revokedBy *int) (bool, error) {
+	var userID int
+	err := dbPool.QueryRow(ctx,
+		`UPDATE sanctions SET revoked_at = NOW(), revoked_by = $1
+		WHERE id = $2 AND revoked_at IS NULL
+		RETURNING user_id`,
+		revokedBy, sanctionID).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	log.WithField("sanction_id", sanctionID).Info("Sanction revoked")
+	audit.Record(dbPool, audit.Event{
+		Type:     audit.EventSanctionRevoke,
+		ActorID:  revokedBy,
+		TargetID: &userID,
+		Details: map[string]interface{}{
+			"sanction_id": sanctionID,
+		},
+	})
+	return true, nil
+}
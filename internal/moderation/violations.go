@@ -0,0 +1,100 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ChatViolation is a chat message that tripped a filter. Body is the message
+// as written, Action is what was done with it: mask, block or flag.
+type ChatViolation struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Username    string     `json:"username"`
+	MessageID   string     `json:"message_id"`
+	Kind        string     `json:"kind"`
+	Channel     string     `json:"channel,omitempty"`
+	RecipientID *int       `json:"recipient_id,omitempty"`
+	Body        string     `json:"body"`
+	Reasons     []string   `json:"reasons"`
+	Action      string     `json:"action"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ReviewedBy  *int       `json:"reviewed_by,omitempty"`
+	ReviewedAt  *time.Time `json:"reviewed_at,omitempty"`
+}
+
+// RecordChatViolation stores a violation and returns how many violations the
+// sender has had since the start of the window or their last chat
+// restriction, whichever is later, including this one. Only blocked messages
+// and word list hits count. Caps, repeats and messages flagged for review
+// are left to moderators.
+func RecordChatViolation(ctx context.Context, dbPool *pgxpool.Pool, violation *ChatViolation, window time.Duration) (int, error) {
+	var channel *string
+	if violation.Channel != "" {
+		channel = &violation.Channel
+	}
+	_, err := dbPool.Exec(ctx,
+		`INSERT INTO chat_violations (user_id, message_id, kind, channel, recipient_id, body, reasons, action)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		violation.UserID, violation.MessageID, violation.Kind, channel, violation.RecipientID,
+		violation.Body, violation.Reasons, violation.Action)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	err = dbPool.QueryRow(ctx,
+		`SELECT COUNT(*) FROM chat_violations
+		WHERE user_id = $1
+		AND (action = 'block' OR 'blocked_word' = ANY(reasons))
+		AND created_at > GREATEST(
+			NOW() - make_interval(secs => $2),
+			COALESCE((SELECT MAX(starts_at) FROM sanctions WHERE user_id = $1 AND type = $3), '-infinity')
+		)`,
+		violation.UserID, window.Seconds(), string(SanctionChatRestriction)).Scan(&count)
+	return count, err
+}
+
+// PendingChatFlags lists flagged messages no moderator has reviewed yet, oldest first
+func PendingChatFlags(ctx context.Context, dbPool *pgxpool.Pool, limit int) ([]ChatViolation, error) {
+	rows, err := dbPool.Query(ctx,
+		`SELECT v.id, v.user_id, u.username, v.message_id::text, v.kind, COALESCE(v.channel, ''),
+			v.recipient_id, v.body, v.reasons, v.action, v.created_at, v.reviewed_by, v.reviewed_at
+		FROM chat_violations v
+		JOIN users u ON u.id = v.user_id
+		WHERE v.action = 'flag' AND v.reviewed_at IS NULL
+		ORDER BY v.created_at
+		LIMIT $1`,
+		limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (ChatViolation, error) {
+		var v ChatViolation
+		err := row.Scan(&v.ID, &v.UserID, &v.Username, &v.MessageID, &v.Kind, &v.Channel,
+			&v.RecipientID, &v.Body, &v.Reasons, &v.Action, &v.CreatedAt, &v.ReviewedBy, &v.ReviewedAt)
+		return v, err
+	})
+}
+
+// ReviewChatFlag marks a flagged message as reviewed, returning the sender's
+// id, or false if it does not exist or was already reviewed
+func ReviewChatFlag(ctx context.Context, dbPool *pgxpool.Pool, violationID int, reviewedBy *int) (int, bool, error) {
+	var userID int
+	err := dbPool.QueryRow(ctx,
+		`UPDATE chat_violations SET reviewed_by = $1, reviewed_at = NOW()
+		WHERE id = $2 AND action = 'flag' AND reviewed_at IS NULL
+		RETURNING user_id`,
+		reviewedBy, violationID).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return userID, true, nil
+}
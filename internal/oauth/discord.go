@@ -0,0 +1,67 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	discordAuthURL  = "https://discord.com/oauth2/authorize"
+	discordTokenURL = "https://discord.com/api/oauth2/token"
+	discordUserURL  = "https://discord.com/api/users/@me"
+)
+
+// Discord signs users in with their Discord account
+type Discord struct {
+	client oauth2Client
+}
+
+func NewDiscord(clientID, clientSecret string) *Discord {
+	return &Discord{client: oauth2Client{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		authURL:      discordAuthURL,
+		tokenURL:     discordTokenURL,
+		scopes:       []string{"identify", "email"},
+	}}
+}
+
+func (d *Discord) Name() string {
+	return "discord"
+}
+
+func (d *Discord) AuthURL(session *Session, redirectURI string) (string, error) {
+	return d.client.authCodeURL(session, redirectURI, nil), nil
+}
+
+func (d *Discord) Complete(ctx context.Context, r *http.Request, session *Session, redirectURI string) (*Identity, error) {
+	token, err := d.client.exchange(ctx, r, session, redirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	var user struct {
+		ID         string `json:"id"`
+		Username   string `json:"username"`
+		GlobalName string `json:"global_name"`
+		Email      string `json:"email"`
+		Verified   bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, discordUserURL, token.AccessToken, &user); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Provider:    d.Name(),
+		Subject:     user.ID,
+		DisplayName: user.GlobalName,
+	}
+	if identity.DisplayName == "" {
+		identity.DisplayName = user.Username
+	}
+	// Unverified emails can not be trusted to belong to the user
+	if user.Verified {
+		identity.Email = user.Email
+	}
+	return identity, nil
+}
@@ -0,0 +1,179 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// keyRefreshInterval limits how often an unknown key id makes us fetch the key set again
+const keyRefreshInterval = time.Minute
+
+// jsonWebKey is a public key published by the provider, only RSA and P-256 keys are used
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes the key, returning nil for keys that can not sign ID tokens
+func (k *jsonWebKey) publicKey() crypto.PublicKey {
+	if k.Use != "" && k.Use != "sig" {
+		return nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return nil
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "EC":
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if k.Crv != "P-256" || errX != nil || errY != nil {
+			return nil
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil
+		}
+		return key
+	}
+	return nil
+}
+
+// keySet caches the signing keys of a provider, fetching them again when a
+// token names a key we have not seen, as providers rotate their keys
+type keySet struct {
+	url string
+
+	mutex     sync.Mutex
+	keys      []jsonWebKey
+	fetchedAt time.Time
+}
+
+// verify checks the signature of a compact JWT and returns its payload
+func (s *keySet) verify(ctx context.Context, token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed ID token", ErrVerificationFailed)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(rawHeader, &header) != nil {
+		return nil, fmt.Errorf("%w: malformed ID token", ErrVerificationFailed)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed ID token", ErrVerificationFailed)
+	}
+	var kty string
+	switch header.Alg {
+	case "RS256":
+		kty = "RSA"
+	case "ES256":
+		kty = "EC"
+	default:
+		return nil, fmt.Errorf("%w: unsupported ID token algorithm %q", ErrVerificationFailed, header.Alg)
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	keys, err := s.candidates(ctx, header.Kid, kty)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if verifySignature(key, digest[:], signature) {
+			payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("%w: malformed ID token", ErrVerificationFailed)
+			}
+			return payload, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: invalid ID token signature", ErrVerificationFailed)
+}
+
+func verifySignature(key crypto.PublicKey, digest, signature []byte) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		// JWS encodes ES256 signatures as the two 32 byte integers r and s
+		if len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		sig := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(key, digest, r, sig)
+	}
+	return false
+}
+
+// candidates returns the keys that may have signed a token with the given key id and type
+func (s *keySet) candidates(ctx context.Context, kid, kty string) ([]crypto.PublicKey, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	keys := s.matching(kid, kty)
+	if len(keys) == 0 && time.Since(s.fetchedAt) >= keyRefreshInterval {
+		if err := s.fetch(ctx); err != nil {
+			return nil, err
+		}
+		keys = s.matching(kid, kty)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no signing key %q published by the provider", ErrVerificationFailed, kid)
+	}
+	return keys, nil
+}
+
+func (s *keySet) matching(kid, kty string) []crypto.PublicKey {
+	var keys []crypto.PublicKey
+	for i := range s.keys {
+		key := &s.keys[i]
+		if key.Kty != kty || (kid != "" && key.Kid != kid) {
+			continue
+		}
+		if publicKey := key.publicKey(); publicKey != nil {
+			keys = append(keys, publicKey)
+		}
+	}
+	return keys
+}
+
+func (s *keySet) fetch(ctx context.Context) error {
+	if s.url == "" {
+		return errors.New("the provider does not publish a jwks_uri")
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, s.url, "", &set); err != nil {
+		return fmt.Errorf("fetching the provider keys failed: %w", err)
+	}
+	s.keys = set.Keys
+	s.fetchedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,115 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// oauth2Client implements the authorization code flow shared by OAuth2 and OIDC providers
+type oauth2Client struct {
+	clientID     string
+	clientSecret string
+	authURL      string
+	tokenURL     string
+	scopes       []string
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+}
+
+func (c *oauth2Client) authCodeURL(session *Session, redirectURI string, extra url.Values) string {
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", c.clientID)
+	params.Set("redirect_uri", redirectURI)
+	params.Set("scope", strings.Join(c.scopes, " "))
+	params.Set("state", session.State)
+	params.Set("code_challenge", session.challenge())
+	params.Set("code_challenge_method", "S256")
+	for key, values := range extra {
+		params[key] = values
+	}
+
+	separator := "?"
+	if strings.Contains(c.authURL, "?") {
+		separator = "&"
+	}
+	return c.authURL + separator + params.Encode()
+}
+
+// exchange trades the authorization code from the callback for tokens
+func (c *oauth2Client) exchange(ctx context.Context, r *http.Request, session *Session, redirectURI string) (*tokenResponse, error) {
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		return nil, fmt.Errorf("%w: provider returned %s", ErrVerificationFailed, providerError)
+	}
+	code := query.Get("code")
+	if code == "" {
+		return nil, fmt.Errorf("%w: missing authorization code", ErrVerificationFailed)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("client_id", c.clientID)
+	form.Set("client_secret", c.clientSecret)
+	form.Set("code_verifier", session.Verifier)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	var token tokenResponse
+	if err := doJSON(request, &token); err != nil {
+		return nil, fmt.Errorf("token exchange failed: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("%w: token response has no access token", ErrVerificationFailed)
+	}
+	return &token, nil
+}
+
+// getJSON performs an authenticated GET and decodes the JSON response
+func getJSON(ctx context.Context, endpoint, accessToken string, target interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if accessToken != "" {
+		request.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	request.Header.Set("Accept", "application/json")
+	return doJSON(request, target)
+}
+
+func doJSON(request *http.Request, target interface{}) error {
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d: %s", request.URL.Host, response.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, target)
+}
@@ -0,0 +1,186 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OIDC signs users in with any OpenID Connect provider found through discovery.
+// Pointing the issuer at a local mock server makes the flow testable offline.
+type OIDC struct {
+	name   string
+	issuer string
+	client oauth2Client
+
+	discovery     *oidcDiscovery
+	discoveryLock sync.Mutex
+	keys          keySet
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func NewOIDC(name, issuer, clientID, clientSecret string) *OIDC {
+	return &OIDC{
+		name:   name,
+		issuer: strings.TrimSuffix(issuer, "/"),
+		client: oauth2Client{
+			clientID:     clientID,
+			clientSecret: clientSecret,
+			scopes:       []string{"openid", "profile", "email"},
+		},
+	}
+}
+
+func (o *OIDC) Name() string {
+	return o.name
+}
+
+// discover fetches and caches the provider metadata
+func (o *OIDC) discover(ctx context.Context) (*oidcDiscovery, error) {
+	o.discoveryLock.Lock()
+	defer o.discoveryLock.Unlock()
+
+	if o.discovery != nil {
+		return o.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := getJSON(ctx, o.issuer+"/.well-known/openid-configuration", "", &discovery); err != nil {
+		return nil, fmt.Errorf("OIDC discovery for %s failed: %w", o.issuer, err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != o.issuer {
+		return nil, fmt.Errorf("OIDC discovery issuer mismatch: expected %s, got %s", o.issuer, discovery.Issuer)
+	}
+
+	o.discovery = &discovery
+	o.client.authURL = discovery.AuthorizationEndpoint
+	o.client.tokenURL = discovery.TokenEndpoint
+	o.keys.url = discovery.JWKSURI
+	return o.discovery, nil
+}
+
+func (o *OIDC) AuthURL(session *Session, redirectURI string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := o.discover(ctx); err != nil {
+		return "", err
+	}
+	return o.client.authCodeURL(session, redirectURI, url.Values{"nonce": {session.Nonce}}), nil
+}
+
+func (o *OIDC) Complete(ctx context.Context, r *http.Request, session *Session, redirectURI string) (*Identity, error) {
+	discovery, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := o.client.exchange(ctx, r, session, redirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature is always checked against the keys the issuer publishes,
+	// the issuer may be reached over plain http, for example a local mock
+	claims, err := o.verifyIDToken(ctx, token.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(claims.Issuer, "/") != o.issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %s", ErrVerificationFailed, claims.Issuer)
+	}
+	if !claims.hasAudience(o.client.clientID) {
+		return nil, fmt.Errorf("%w: token was not issued for this client", ErrVerificationFailed)
+	}
+	if time.Now().Unix() > claims.Expiry {
+		return nil, fmt.Errorf("%w: ID token expired", ErrVerificationFailed)
+	}
+	if claims.Nonce != session.Nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrVerificationFailed)
+	}
+
+	identity := &Identity{
+		Provider:    o.name,
+		Subject:     claims.Subject,
+		DisplayName: claims.PreferredUsername,
+	}
+	if identity.DisplayName == "" {
+		identity.DisplayName = claims.Name
+	}
+	if claims.EmailVerified {
+		identity.Email = claims.Email
+	}
+
+	// Fill in profile details the ID token left out
+	if identity.DisplayName == "" && discovery.UserinfoEndpoint != "" {
+		var userinfo idTokenClaims
+		if err := getJSON(ctx, discovery.UserinfoEndpoint, token.AccessToken, &userinfo); err == nil && userinfo.Subject == claims.Subject {
+			identity.DisplayName = userinfo.PreferredUsername
+			if identity.DisplayName == "" {
+				identity.DisplayName = userinfo.Name
+			}
+		}
+	}
+	return identity, nil
+}
+
+type idTokenClaims struct {
+	Issuer            string          `json:"iss"`
+	Subject           string          `json:"sub"`
+	Audience          json.RawMessage `json:"aud"`
+	Expiry            int64           `json:"exp"`
+	Nonce             string          `json:"nonce"`
+	Email             string          `json:"email"`
+	EmailVerified     bool            `json:"email_verified"`
+	Name              string          `json:"name"`
+	PreferredUsername string          `json:"preferred_username"`
+}
+
+// hasAudience handles aud being either a single string or a list
+func (c *idTokenClaims) hasAudience(clientID string) bool {
+	var single string
+	if err := json.Unmarshal(c.Audience, &single); err == nil {
+		return single == clientID
+	}
+	var list []string
+	if err := json.Unmarshal(c.Audience, &list); err == nil {
+		for _, audience := range list {
+			if audience == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifyIDToken checks the signature of the ID token and decodes its claims
+func (o *OIDC) verifyIDToken(ctx context.Context, idToken string) (*idTokenClaims, error) {
+	if idToken == "" {
+		return nil, fmt.Errorf("%w: token response has no ID token", ErrVerificationFailed)
+	}
+	payload, err := o.keys.verify(ctx, idToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims idTokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed ID token", ErrVerificationFailed)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: ID token has no subject", ErrVerificationFailed)
+	}
+	return &claims, nil
+}
@@ -0,0 +1,292 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	mockClientID     = "openchamp"
+	mockClientSecret = "client-secret"
+	mockCode         = "authorization-code"
+)
+
+// mockProvider is an OpenID Connect provider serving discovery, keys, the
+// token endpoint and userinfo. Tests change the claims it signs before
+// completing a login.
+type mockProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mutex     sync.Mutex
+	challenge string                                                  // PKCE challenge from the authorization request
+	nonce     string                                                  // Nonce from the authorization request
+	claims    func(map[string]interface{})                            // Changes the ID token claims
+	sign      func(key *rsa.PrivateKey, header, claims []byte) string // Replaces the normal signature
+	userinfo  map[string]interface{}
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := &mockProvider{t: t, key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 mock.server.URL,
+			"authorization_endpoint": mock.server.URL + "/authorize",
+			"token_endpoint":         mock.server.URL + "/token",
+			"userinfo_endpoint":      mock.server.URL + "/userinfo",
+			"jwks_uri":               mock.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "mock-key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", mock.handleToken)
+	mux.HandleFunc("GET /userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		mock.mutex.Lock()
+		defer mock.mutex.Unlock()
+		json.NewEncoder(w).Encode(mock.userinfo)
+	})
+	mock.server = httptest.NewServer(mux)
+	t.Cleanup(mock.server.Close)
+	return mock
+}
+
+// authorize plays the user signing in at the provider and returns the callback request
+func (m *mockProvider) authorize(authURL string) *http.Request {
+	m.t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("client_id") != mockClientID || query.Get("code_challenge_method") != "S256" {
+		m.t.Fatalf("unexpected authorization request: %s", authURL)
+	}
+	m.mutex.Lock()
+	m.challenge = query.Get("code_challenge")
+	m.nonce = query.Get("nonce")
+	m.mutex.Unlock()
+
+	return httptest.NewRequest(http.MethodGet, "/auth/mock/callback?code="+mockCode+"&state="+url.QueryEscape(query.Get("state")), nil)
+}
+
+func (m *mockProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	switch {
+	case r.PostFormValue("code") != mockCode,
+		r.PostFormValue("client_id") != mockClientID,
+		r.PostFormValue("client_secret") != mockClientSecret,
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != m.challenge:
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss":                m.server.URL,
+		"sub":                "subject-42",
+		"aud":                mockClientID,
+		"exp":                time.Now().Add(time.Minute).Unix(),
+		"nonce":              m.nonce,
+		"email":              "player@example.com",
+		"email_verified":     true,
+		"preferred_username": "mockplayer",
+	}
+	if m.claims != nil {
+		m.claims(claims)
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "mock-key", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	var idToken string
+	if m.sign != nil {
+		idToken = m.sign(m.key, header, payload)
+	} else {
+		idToken = signRS256(m.t, m.key, header, payload)
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, header, payload []byte) string {
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Error(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// login runs the whole flow against the mock: session, redirect, callback and code exchange
+func (m *mockProvider) login(linkUserID int) (*Session, *Identity, error) {
+	m.t.Helper()
+	provider := NewOIDC("mock", m.server.URL, mockClientID, mockClientSecret)
+	sessions := NewSessionStore()
+	const redirectURI = "http://localhost/auth/mock/callback"
+
+	session, err := sessions.Create(provider.Name(), linkUserID)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	authURL, err := provider.AuthURL(session, redirectURI)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	callback := m.authorize(authURL)
+
+	session, err = sessions.Consume(provider.Name(), callback.URL.Query().Get("state"))
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	identity, err := provider.Complete(context.Background(), callback, session, redirectURI)
+	return session, identity, err
+}
+
+func TestOIDCLogin(t *testing.T) {
+	mock := newMockProvider(t)
+	session, identity, err := mock.login(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Identity{Provider: "mock", Subject: "subject-42", Email: "player@example.com", DisplayName: "mockplayer"}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+	if session.LinkUserID != 0 {
+		t.Errorf("login session links user %d", session.LinkUserID)
+	}
+}
+
+func TestOIDCLink(t *testing.T) {
+	mock := newMockProvider(t)
+	session, identity, err := mock.login(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.LinkUserID != 7 || identity.Subject != "subject-42" {
+		t.Errorf("link completed for user %d with subject %q, want user 7 and subject-42", session.LinkUserID, identity.Subject)
+	}
+}
+
+func TestOIDCUserinfoFillsDisplayName(t *testing.T) {
+	mock := newMockProvider(t)
+	mock.claims = func(claims map[string]interface{}) {
+		delete(claims, "preferred_username")
+		claims["email_verified"] = false
+	}
+	mock.userinfo = map[string]interface{}{"sub": "subject-42", "name": "Mock Player"}
+
+	_, identity, err := mock.login(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.DisplayName != "Mock Player" || identity.Email != "" {
+		t.Errorf("identity = %+v, want the userinfo name and no unverified email", *identity)
+	}
+}
+
+func TestOIDCRejectsUntrustedTokens(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		claims func(map[string]interface{})
+		sign   func(t *testing.T, key *rsa.PrivateKey, header, payload []byte) string
+	}{
+		{
+			name: "signed by another key",
+			sign: func(t *testing.T, key *rsa.PrivateKey, header, payload []byte) string {
+				return signRS256(t, otherKey, header, payload)
+			},
+		},
+		{
+			name: "unsigned",
+			sign: func(t *testing.T, key *rsa.PrivateKey, header, payload []byte) string {
+				none, _ := json.Marshal(map[string]string{"alg": "none"})
+				return base64.RawURLEncoding.EncodeToString(none) + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+			},
+		},
+		{
+			name: "claims changed after signing",
+			sign: func(t *testing.T, key *rsa.PrivateKey, header, payload []byte) string {
+				signed := strings.Split(signRS256(t, key, header, payload), ".")
+				forged, _ := json.Marshal(map[string]interface{}{"sub": "someone-else"})
+				return signed[0] + "." + base64.RawURLEncoding.EncodeToString(forged) + "." + signed[2]
+			},
+		},
+		{
+			name:   "wrong issuer",
+			claims: func(claims map[string]interface{}) { claims["iss"] = "https://evil.example.com" },
+		},
+		{
+			name:   "wrong audience",
+			claims: func(claims map[string]interface{}) { claims["aud"] = []string{"someone-else"} },
+		},
+		{
+			name:   "expired",
+			claims: func(claims map[string]interface{}) { claims["exp"] = time.Now().Add(-time.Minute).Unix() },
+		},
+		{
+			name:   "wrong nonce",
+			claims: func(claims map[string]interface{}) { claims["nonce"] = "replayed" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockProvider(t)
+			mock.claims = tt.claims
+			if tt.sign != nil {
+				mock.sign = func(key *rsa.PrivateKey, header, payload []byte) string {
+					return tt.sign(t, key, header, payload)
+				}
+			}
+			if _, _, err := mock.login(0); !errors.Is(err, ErrVerificationFailed) {
+				t.Errorf("login error = %v, want ErrVerificationFailed", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// sessionTTL is how long a user has to finish signing in at the provider
+const sessionTTL = 10 * time.Minute
+
+// BindingCookie holds the binding of the session started in this browser
+const BindingCookie = "openchamp_oauth"
+
+var (
+	// ErrUnknownState is returned when a callback does not match a pending session
+	ErrUnknownState = errors.New("unknown or expired login state")
+	// ErrVerificationFailed is returned when the provider response can not be trusted
+	ErrVerificationFailed = errors.New("identity verification failed")
+)
+
+// Identity is the account a user proved they own at an external provider
+type Identity struct {
+	Provider    string
+	Subject     string // Stable user id at the provider
+	Email       string
+	DisplayName string
+}
+
+// Provider is an external identity provider. Implementations build the URL the
+// user is sent to and verify the callback request the provider redirects back with.
+type Provider interface {
+	Name() string
+	AuthURL(session *Session, redirectURI string) (string, error)
+	Complete(ctx context.Context, r *http.Request, session *Session, redirectURI string) (*Identity, error)
+}
+
+// Session tracks a sign-in between the redirect to the provider and the callback
+type Session struct {
+	State    string
+	Nonce    string
+	Verifier string // PKCE code verifier
+	Provider string
+
+	// LinkUserID is set when an existing user is linking a new identity
+	LinkUserID int
+
+	// Binding is kept in a cookie of the browser that started the session, the
+	// callback must come from that browser so nobody can finish someone else's
+	Binding string
+
+	expiresAt time.Time
+	begun     bool
+}
+
+// Cookie returns the cookie that binds the browser to the session. It is sent
+// on the top level redirect back from the provider, but not on cross-site requests.
+func (s *Session) Cookie(secure bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     BindingCookie,
+		Value:    s.Binding,
+		Path:     "/auth/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		Secure:   secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// BoundTo reports whether the request comes from the browser that started the session
+func (s *Session) BoundTo(r *http.Request) bool {
+	cookie, err := r.Cookie(BindingCookie)
+	return err == nil && subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(s.Binding)) == 1
+}
+
+// challenge returns the PKCE S256 code challenge for the session verifier
+func (s *Session) challenge() string {
+	sum := sha256.Sum256([]byte(s.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// SessionStore keeps pending sessions in memory keyed by their state parameter
+type SessionStore struct {
+	sessions map[string]*Session
+	mutex    sync.Mutex
+}
+
+func NewSessionStore() *SessionStore {
+	return &SessionStore{sessions: make(map[string]*Session)}
+}
+
+// Create starts a new session for the provider
+func (store *SessionStore) Create(provider string, linkUserID int) (*Session, error) {
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	binding, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{
+		State:      state,
+		Nonce:      nonce,
+		Verifier:   verifier,
+		Provider:   provider,
+		LinkUserID: linkUserID,
+		Binding:    binding,
+		expiresAt:  time.Now().Add(sessionTTL),
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// Drop abandoned sessions so the map does not grow forever
+	for key, existing := range store.sessions {
+		if time.Now().After(existing.expiresAt) {
+			delete(store.sessions, key)
+		}
+	}
+	store.sessions[state] = session
+	return session, nil
+}
+
+// Consume returns and removes the session for a state, each state can only be used once
+func (store *SessionStore) Consume(provider, state string) (*Session, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	session, ok := store.sessions[state]
+	if !ok {
+		return nil, ErrUnknownState
+	}
+	delete(store.sessions, state)
+
+	if session.Provider != provider || time.Now().After(session.expiresAt) {
+		return nil, ErrUnknownState
+	}
+	return session, nil
+}
+
+// Begin hands a link session to the first browser that opens its start URL.
+// Later visits get ErrUnknownState, so only that browser can finish the link.
+func (store *SessionStore) Begin(provider, state string) (*Session, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	session, ok := store.sessions[state]
+	if !ok || session.begun || session.LinkUserID == 0 ||
+		session.Provider != provider || time.Now().After(session.expiresAt) {
+		return nil, ErrUnknownState
+	}
+	session.begun = true
+	return session, nil
+}
+
+func randomString() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate random state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,80 @@
+package oauth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSessionBoundTo(t *testing.T) {
+	sessions := NewSessionStore()
+	session, err := sessions.Create("mock", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := httptest.NewRequest(http.MethodGet, "/auth/mock/callback", nil)
+	started.AddCookie(session.Cookie(true))
+	if !session.BoundTo(started) {
+		t.Error("BoundTo() = false for the browser that started the session")
+	}
+
+	other := httptest.NewRequest(http.MethodGet, "/auth/mock/callback", nil)
+	if session.BoundTo(other) {
+		t.Error("BoundTo() = true without the binding cookie")
+	}
+
+	other.AddCookie(&http.Cookie{Name: BindingCookie, Value: "someone-else"})
+	if session.BoundTo(other) {
+		t.Error("BoundTo() = true for another session's binding")
+	}
+}
+
+func TestSessionCookieIsHidden(t *testing.T) {
+	session, err := NewSessionStore().Create("mock", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie := session.Cookie(true)
+	if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("Cookie() = %+v, want HttpOnly, Secure and SameSite=Lax", cookie)
+	}
+	if cookie.Value != session.Binding || cookie.Value == "" {
+		t.Errorf("Cookie() value = %q, want the session binding", cookie.Value)
+	}
+}
+
+func TestSessionBeginOnce(t *testing.T) {
+	sessions := NewSessionStore()
+	link, err := sessions.Create("mock", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sessions.Begin("other", link.State); !errors.Is(err, ErrUnknownState) {
+		t.Errorf("Begin() for another provider = %v, want ErrUnknownState", err)
+	}
+	begun, err := sessions.Begin("mock", link.State)
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	if begun != link {
+		t.Error("Begin() returned a different session")
+	}
+	// A forwarded link URL must not hand the session to a second browser
+	if _, err := sessions.Begin("mock", link.State); !errors.Is(err, ErrUnknownState) {
+		t.Errorf("second Begin() = %v, want ErrUnknownState", err)
+	}
+}
+
+func TestSessionBeginOnlyLinks(t *testing.T) {
+	sessions := NewSessionStore()
+	login, err := sessions.Create("mock", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sessions.Begin("mock", login.State); !errors.Is(err, ErrUnknownState) {
+		t.Errorf("Begin() for a login session = %v, want ErrUnknownState", err)
+	}
+}
@@ -0,0 +1,27 @@
+package oauth
+
+import (
+	"openchamp/server/internal/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ProvidersFromConfig builds every provider that has credentials configured
+func ProvidersFromConfig(cfg config.Config) map[string]Provider {
+	providers := make(map[string]Provider)
+
+	if cfg.OAuth.Discord.ClientID != "" {
+		providers["discord"] = NewDiscord(cfg.OAuth.Discord.ClientID, cfg.OAuth.Discord.ClientSecret)
+	}
+	if cfg.OAuth.Steam.Enabled {
+		providers["steam"] = NewSteam(cfg.PublicURL)
+	}
+	if oidc := cfg.OAuth.OIDC; oidc.Issuer != "" && oidc.ClientID != "" {
+		providers[oidc.Name] = NewOIDC(oidc.Name, oidc.Issuer, oidc.ClientID, oidc.ClientSecret)
+	}
+
+	for name := range providers {
+		log.WithField("provider", name).Info("External login provider enabled")
+	}
+	return providers
+}
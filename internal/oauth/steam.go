@@ -0,0 +1,97 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	steamOpenIDURL   = "https://steamcommunity.com/openid/login"
+	steamClaimPrefix = "https://steamcommunity.com/openid/id/"
+	openIDNamespace  = "http://specs.openid.net/auth/2.0"
+	openIDIdentifier = "http://specs.openid.net/auth/2.0/identifier_select"
+)
+
+// Steam signs users in through Steam's OpenID 2.0 endpoint
+type Steam struct {
+	realm string
+}
+
+// NewSteam creates the provider, realm is the public URL of the server
+func NewSteam(realm string) *Steam {
+	return &Steam{realm: realm}
+}
+
+func (s *Steam) Name() string {
+	return "steam"
+}
+
+func (s *Steam) AuthURL(session *Session, redirectURI string) (string, error) {
+	params := url.Values{}
+	params.Set("openid.ns", openIDNamespace)
+	params.Set("openid.mode", "checkid_setup")
+	params.Set("openid.return_to", returnTo(session, redirectURI))
+	params.Set("openid.realm", s.realm)
+	params.Set("openid.identity", openIDIdentifier)
+	params.Set("openid.claimed_id", openIDIdentifier)
+	return steamOpenIDURL + "?" + params.Encode(), nil
+}
+
+// returnTo carries the state through Steam, which has no state parameter of its own
+func returnTo(session *Session, redirectURI string) string {
+	return redirectURI + "?state=" + url.QueryEscape(session.State)
+}
+
+func (s *Steam) Complete(ctx context.Context, r *http.Request, session *Session, redirectURI string) (*Identity, error) {
+	query := r.URL.Query()
+	if query.Get("openid.mode") != "id_res" {
+		return nil, fmt.Errorf("%w: sign in was cancelled", ErrVerificationFailed)
+	}
+	if query.Get("openid.return_to") != returnTo(session, redirectURI) {
+		return nil, fmt.Errorf("%w: return_to mismatch", ErrVerificationFailed)
+	}
+	claimedID := query.Get("openid.claimed_id")
+	if !strings.HasPrefix(claimedID, steamClaimPrefix) {
+		return nil, fmt.Errorf("%w: unexpected claimed id", ErrVerificationFailed)
+	}
+
+	// Ask Steam to confirm it signed this response
+	form := url.Values{}
+	for key, values := range query {
+		if strings.HasPrefix(key, "openid.") {
+			form[key] = values
+		}
+	}
+	form.Set("openid.mode", "check_authentication")
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, steamOpenIDURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<16))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(string(body), "is_valid:true") {
+		return nil, fmt.Errorf("%w: Steam rejected the assertion", ErrVerificationFailed)
+	}
+
+	steamID := strings.TrimPrefix(claimedID, steamClaimPrefix)
+	return &Identity{
+		Provider:    s.Name(),
+		Subject:     steamID,
+		DisplayName: "steam_" + steamID,
+	}, nil
+}
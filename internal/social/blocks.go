@@ -0,0 +1,165 @@
+package social
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MaxAvoidedTeammates bounds how many players one player can ask the
+// matchmaker to keep off their team, so queues stay workable
+const MaxAvoidedTeammates = 10
+
+var (
+	ErrBlockSelf      = errors.New("you cannot block yourself")
+	ErrTooManyAvoided = errors.New("you are already avoiding the most teammates allowed")
+	ErrNotBlocked     = errors.New("you have not blocked this player")
+)
+
+// querier is satisfied by both the pool and a transaction
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// BlockedUser is a player the user has blocked
+type BlockedUser struct {
+	UserID          int       `json:"user_id"`
+	Username        string    `json:"username"`
+	AvoidAsTeammate bool      `json:"avoid_as_teammate"`
+	Since           time.Time `json:"since"`
+}
+
+// Block blocks a player, or updates the teammate preference of an existing
+// block. Any friendship or pending request between them ends, the returned
+// bool says whether there was one.
+func Block(ctx context.Context, dbPool *pgxpool.Pool, userID, blockedID int, avoidAsTeammate bool) (bool, error) {
+	if userID == blockedID {
+		return false, ErrBlockSelf
+	}
+
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	if avoidAsTeammate {
+		var avoided int
+		err := tx.QueryRow(ctx,
+			`SELECT COUNT(*) FROM user_blocks
+			WHERE blocker_id = $1 AND blocked_id <> $2 AND avoid_as_teammate`,
+			userID, blockedID).Scan(&avoided)
+		if err != nil {
+			return false, err
+		}
+		if avoided >= MaxAvoidedTeammates {
+			return false, ErrTooManyAvoided
+		}
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO user_blocks (blocker_id, blocked_id, avoid_as_teammate) VALUES ($1, $2, $3)
+		ON CONFLICT (blocker_id, blocked_id) DO UPDATE SET avoid_as_teammate = $3`,
+		userID, blockedID, avoidAsTeammate)
+	if err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(ctx,
+		`DELETE FROM friendships
+		WHERE (user_id = $1 AND friend_id = $2) OR (user_id = $2 AND friend_id = $1)`,
+		userID, blockedID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, tx.Commit(ctx)
+}
+
+// Unblock lifts a block, returning ErrNotBlocked if there was none
+func Unblock(ctx context.Context, dbPool *pgxpool.Pool, userID, blockedID int) error {
+	result, err := dbPool.Exec(ctx,
+		"DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2",
+		userID, blockedID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotBlocked
+	}
+	return nil
+}
+
+// Blocks lists the players the user has blocked, sorted by username
+func Blocks(ctx context.Context, dbPool *pgxpool.Pool, userID int) ([]BlockedUser, error) {
+	rows, err := dbPool.Query(ctx,
+		`SELECT b.blocked_id, u.username, b.avoid_as_teammate, b.created_at
+		FROM user_blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = $1
+		ORDER BY u.username`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (BlockedUser, error) {
+		var blocked BlockedUser
+		err := row.Scan(&blocked.UserID, &blocked.Username, &blocked.AvoidAsTeammate, &blocked.Since)
+		return blocked, err
+	})
+}
+
+// IsBlocked reports whether either player has blocked the other
+func IsBlocked(ctx context.Context, dbPool *pgxpool.Pool, userID, otherID int) (bool, error) {
+	return isBlocked(ctx, dbPool, userID, otherID)
+}
+
+func isBlocked(ctx context.Context, db querier, userID, otherID int) (bool, error) {
+	var blocked bool
+	err := db.QueryRow(ctx,
+		`SELECT EXISTS (
+			SELECT 1 FROM user_blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		)`,
+		userID, otherID).Scan(&blocked)
+	return blocked, err
+}
+
+// BlockersAmong returns which of the given players have blocked the user
+func BlockersAmong(ctx context.Context, dbPool *pgxpool.Pool, userID int, candidateIDs []int) ([]int, error) {
+	rows, err := dbPool.Query(ctx,
+		"SELECT blocker_id FROM user_blocks WHERE blocked_id = $1 AND blocker_id = ANY($2)",
+		userID, candidateIDs)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
+// BlockedIDs returns the ids of the players the user has blocked
+func BlockedIDs(ctx context.Context, dbPool *pgxpool.Pool, userID int) ([]int, error) {
+	rows, err := dbPool.Query(ctx,
+		"SELECT blocked_id FROM user_blocks WHERE blocker_id = $1",
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
+// AvoidedTeammates returns the players the user asked not to be teamed
+// with. The matchmaker should treat them as a preference it may break
+// when no other match can be made in reasonable time.
+func AvoidedTeammates(ctx context.Context, dbPool *pgxpool.Pool, userID int) ([]int, error) {
+	rows, err := dbPool.Query(ctx,
+		`SELECT blocked_id FROM user_blocks
+		WHERE blocker_id = $1 AND avoid_as_teammate
+		ORDER BY created_at DESC
+		LIMIT $2`,
+		userID, MaxAvoidedTeammates)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
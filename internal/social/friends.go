@@ -0,0 +1,194 @@
+// Package social stores friendships and blocks between players
+package social
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// FriendStatus is the state of one direction of a friendship
+type FriendStatus string
+
+const (
+	FriendPending  FriendStatus = "pending"
+	FriendAccepted FriendStatus = "accepted"
+)
+
+var (
+	ErrSelf            = errors.New("you cannot add yourself as a friend")
+	ErrBlocked         = errors.New("you cannot send a friend request to this player")
+	ErrAlreadyFriends  = errors.New("you are already friends")
+	ErrRequestPending  = errors.New("a friend request is already pending")
+	ErrNoFriendRequest = errors.New("there is no pending friend request from this player")
+)
+
+// Friend is an accepted friend or a pending request, seen from one user
+type Friend struct {
+	UserID   int          `json:"user_id"`
+	Username string       `json:"username"`
+	Status   FriendStatus `json:"status"`
+	Incoming bool         `json:"incoming"` // For pending requests, whether the other player sent it
+	Since    time.Time    `json:"since"`
+}
+
+// RequestFriend sends a friend request. If the other player already asked
+// to be friends the request is accepted instead, the returned status says which happened.
+func RequestFriend(ctx context.Context, dbPool *pgxpool.Pool, userID, friendID int) (FriendStatus, error) {
+	if userID == friendID {
+		return "", ErrSelf
+	}
+
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	blocked, err := isBlocked(ctx, tx, userID, friendID)
+	if err != nil {
+		return "", err
+	}
+	if blocked {
+		return "", ErrBlocked
+	}
+
+	theirs, err := friendshipStatus(ctx, tx, friendID, userID)
+	if err != nil {
+		return "", err
+	}
+	switch theirs {
+	case FriendAccepted:
+		return "", ErrAlreadyFriends
+	case FriendPending:
+		if err := acceptFriend(ctx, tx, userID, friendID); err != nil {
+			return "", err
+		}
+		return FriendAccepted, tx.Commit(ctx)
+	}
+
+	mine, err := friendshipStatus(ctx, tx, userID, friendID)
+	if err != nil {
+		return "", err
+	}
+	switch mine {
+	case FriendPending:
+		return "", ErrRequestPending
+	case FriendAccepted:
+		return "", ErrAlreadyFriends
+	}
+
+	_, err = tx.Exec(ctx,
+		"INSERT INTO friendships (user_id, friend_id, status) VALUES ($1, $2, 'pending')",
+		userID, friendID)
+	if err != nil {
+		return "", err
+	}
+	return FriendPending, tx.Commit(ctx)
+}
+
+// AcceptFriend accepts the pending request the requester sent to the user
+func AcceptFriend(ctx context.Context, dbPool *pgxpool.Pool, userID, requesterID int) error {
+	tx, err := dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	theirs, err := friendshipStatus(ctx, tx, requesterID, userID)
+	if err != nil {
+		return err
+	}
+	if theirs != FriendPending {
+		return ErrNoFriendRequest
+	}
+	if err := acceptFriend(ctx, tx, userID, requesterID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// RemoveFriend ends a friendship, or declines or cancels a pending request.
+// It returns false if there was nothing to remove.
+func RemoveFriend(ctx context.Context, dbPool *pgxpool.Pool, userID, friendID int) (bool, error) {
+	result, err := dbPool.Exec(ctx,
+		`DELETE FROM friendships
+		WHERE ((user_id = $1 AND friend_id = $2) OR (user_id = $2 AND friend_id = $1))`,
+		userID, friendID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// Friends lists the user's friends and pending requests in both directions, sorted by username
+func Friends(ctx context.Context, dbPool *pgxpool.Pool, userID int) ([]Friend, error) {
+	rows, err := dbPool.Query(ctx,
+		`SELECT f.friend_id, u.username, f.status, FALSE, f.updated_at
+		FROM friendships f
+		JOIN users u ON u.id = f.friend_id
+		WHERE f.user_id = $1
+		UNION ALL
+		SELECT f.user_id, u.username, f.status, TRUE, f.updated_at
+		FROM friendships f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.friend_id = $1 AND f.status = 'pending'
+		ORDER BY 2`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	friends := []Friend{}
+	for rows.Next() {
+		var friend Friend
+		if err := rows.Scan(&friend.UserID, &friend.Username, &friend.Status, &friend.Incoming, &friend.Since); err != nil {
+			return nil, err
+		}
+		friends = append(friends, friend)
+	}
+	return friends, rows.Err()
+}
+
+// FriendIDs returns the ids of the user's accepted friends
+func FriendIDs(ctx context.Context, dbPool *pgxpool.Pool, userID int) ([]int, error) {
+	rows, err := dbPool.Query(ctx,
+		"SELECT friend_id FROM friendships WHERE user_id = $1 AND status = 'accepted'",
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
+// friendshipStatus returns the status of the row from userID to friendID, or "" if there is none
+func friendshipStatus(ctx context.Context, tx pgx.Tx, userID, friendID int) (FriendStatus, error) {
+	var status FriendStatus
+	err := tx.QueryRow(ctx,
+		"SELECT status FROM friendships WHERE user_id = $1 AND friend_id = $2 FOR UPDATE",
+		userID, friendID).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return status, err
+}
+
+// acceptFriend turns the request from requesterID into a friendship in both directions
+func acceptFriend(ctx context.Context, tx pgx.Tx, userID, requesterID int) error {
+	_, err := tx.Exec(ctx,
+		`UPDATE friendships SET status = 'accepted', updated_at = NOW()
+		WHERE user_id = $1 AND friend_id = $2`,
+		requesterID, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO friendships (user_id, friend_id, status) VALUES ($1, $2, 'accepted')
+		ON CONFLICT (user_id, friend_id) DO UPDATE SET status = 'accepted', updated_at = NOW()`,
+		userID, requesterID)
+	return err
+}
@@ -0,0 +1,421 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"openchamp/server/internal/auth"
+	"openchamp/server/internal/moderation"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errDuplicateToken = errors.New("token already exists")
+
+// Memory implements the stores in memory. It enforces the same constraints
+// as the Postgres schema and is safe for concurrent use.
+type Memory struct {
+	mutex          sync.Mutex
+	users          map[int]*User
+	tokens         map[string]*Token
+	sanctions      []*moderation.Sanction
+	twoFactor      map[int]*memoryTwoFactor
+	nextUserID     int
+	nextTokenID    int
+	nextSanctionID int
+}
+
+// memoryTwoFactor is the two-factor data Postgres keeps on the users and
+// recovery_codes tables, the enabled flag lives on the user
+type memoryTwoFactor struct {
+	secret        string
+	lastStep      *int64
+	recoveryCodes map[string]bool // Code hash to whether it was used
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:          make(map[int]*User),
+		tokens:         make(map[string]*Token),
+		twoFactor:      make(map[int]*memoryTwoFactor),
+		nextUserID:     1,
+		nextTokenID:    1,
+		nextSanctionID: 1,
+	}
+}
+
+// copyUser returns a copy so callers can not modify stored users without the lock
+func copyUser(user *User) *User {
+	result := *user
+	return &result
+}
+
+func copyToken(token *Token) *Token {
+	result := *token
+	return &result
+}
+
+func (m *Memory) userByUsernameLocked(username string) *User {
+	for _, user := range m.users {
+		if strings.EqualFold(user.Username, username) {
+			return user
+		}
+	}
+	return nil
+}
+
+func (m *Memory) emailTakenLocked(email string, exceptID int) bool {
+	if email == "" {
+		return false
+	}
+	for _, user := range m.users {
+		if user.Email == email && user.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) CreateUser(ctx context.Context, username, passwordHash, email string) (*User, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	user, err := m.createUserLocked(username, passwordHash, email)
+	if err != nil {
+		return nil, err
+	}
+	return copyUser(user), nil
+}
+
+func (m *Memory) Register(ctx context.Context, registration Registration) (*User, *Token, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.tokens[registration.Token]; ok {
+		return nil, nil, errDuplicateToken
+	}
+	user, err := m.createUserLocked(registration.Username, registration.PasswordHash, registration.Email)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	user.LastLogin = &now
+	token := m.createTokenLocked(user.ID, registration.Token, registration.IPAddress, registration.TokenLifetime)
+	return copyUser(user), copyToken(token), nil
+}
+
+func (m *Memory) createUserLocked(username, passwordHash, email string) (*User, error) {
+	if m.userByUsernameLocked(username) != nil {
+		return nil, ErrUsernameTaken
+	}
+	if m.emailTakenLocked(email, 0) {
+		return nil, ErrEmailTaken
+	}
+
+	user := &User{
+		ID:           m.nextUserID,
+		Username:     username,
+		PasswordHash: passwordHash,
+		Email:        email,
+		Role:         auth.RolePlayer,
+		CreatedAt:    time.Now(),
+	}
+	m.nextUserID++
+	m.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) UserByID(ctx context.Context, id int) (*User, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyUser(user), nil
+}
+
+func (m *Memory) UserByUsername(ctx context.Context, username string) (*User, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	user := m.userByUsernameLocked(username)
+	if user == nil {
+		return nil, ErrNotFound
+	}
+	return copyUser(user), nil
+}
+
+func (m *Memory) UpdateEmail(ctx context.Context, id int, email string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if m.emailTakenLocked(email, id) {
+		return ErrEmailTaken
+	}
+	user.Email = email
+	return nil
+}
+
+func (m *Memory) UpdatePassword(ctx context.Context, id int, passwordHash, keepToken string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.PasswordHash = passwordHash
+	m.revokeUserTokensLocked(id, keepToken)
+	return nil
+}
+
+func (m *Memory) TouchLastLogin(ctx context.Context, id int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if user, ok := m.users[id]; ok {
+		now := time.Now()
+		user.LastLogin = &now
+	}
+	return nil
+}
+
+func (m *Memory) DeleteUser(ctx context.Context, id int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.users, id)
+	for key, token := range m.tokens {
+		if token.UserID == id {
+			delete(m.tokens, key)
+		}
+	}
+	delete(m.twoFactor, id)
+	kept := m.sanctions[:0]
+	for _, sanction := range m.sanctions {
+		if sanction.UserID != id {
+			kept = append(kept, sanction)
+		}
+	}
+	m.sanctions = kept
+	return nil
+}
+
+// LinkedProviders is always empty, external logins need the database
+func (m *Memory) LinkedProviders(ctx context.Context, id int) ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.users[id]; !ok {
+		return nil, ErrNotFound
+	}
+	return []string{}, nil
+}
+
+func (m *Memory) CreateToken(ctx context.Context, userID int, token, ip string, ttl time.Duration) (*Token, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.users[userID]; !ok {
+		return nil, ErrNotFound
+	}
+	if _, ok := m.tokens[token]; ok {
+		return nil, errDuplicateToken
+	}
+	return copyToken(m.createTokenLocked(userID, token, ip, ttl)), nil
+}
+
+func (m *Memory) createTokenLocked(userID int, token, ip string, ttl time.Duration) *Token {
+	now := time.Now()
+	stored := &Token{
+		ID:        m.nextTokenID,
+		UserID:    userID,
+		Token:     token,
+		IPAddress: ip,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	m.nextTokenID++
+	m.tokens[token] = stored
+	return stored
+}
+
+func (m *Memory) ActiveToken(ctx context.Context, token string) (*Token, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored, ok := m.tokens[token]
+	if !ok || stored.Revoked || !time.Now().Before(stored.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	return copyToken(stored), nil
+}
+
+func (m *Memory) MarkTokenUsed(ctx context.Context, id int, ip string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, token := range m.tokens {
+		if token.ID == id {
+			now := time.Now()
+			token.LastUsedAt = &now
+			token.IPAddress = ip
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *Memory) RevokeToken(ctx context.Context, token string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if stored, ok := m.tokens[token]; ok {
+		stored.Revoked = true
+	}
+	return nil
+}
+
+func (m *Memory) RevokeUserTokens(ctx context.Context, userID int, except string) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.revokeUserTokensLocked(userID, except), nil
+}
+
+func (m *Memory) revokeUserTokensLocked(userID int, except string) int {
+	revoked := 0
+	for key, token := range m.tokens {
+		if token.UserID == userID && key != except && !token.Revoked {
+			token.Revoked = true
+			revoked++
+		}
+	}
+	return revoked
+}
+
+// AddSanction stores a sanction and returns it with its ID. The memory store
+// has no moderation tools, this stands in for issuing one.
+func (m *Memory) AddSanction(sanction moderation.Sanction) *moderation.Sanction {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sanction.ID = m.nextSanctionID
+	m.nextSanctionID++
+	m.sanctions = append(m.sanctions, &sanction)
+	result := sanction
+	return &result
+}
+
+func (m *Memory) ActiveSanction(ctx context.Context, userID int, sanctionType moderation.SanctionType) (*moderation.Sanction, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	var longest *moderation.Sanction
+	for _, sanction := range m.sanctions {
+		if sanction.UserID != userID || sanction.Type != sanctionType || sanction.StartsAt.After(now) ||
+			(sanction.ExpiresAt != nil && !sanction.ExpiresAt.After(now)) {
+			continue
+		}
+		// Permanent sanctions come first, then the one that runs the longest
+		if longest == nil || (longest.ExpiresAt != nil &&
+			(sanction.ExpiresAt == nil || sanction.ExpiresAt.After(*longest.ExpiresAt))) {
+			longest = sanction
+		}
+	}
+	if longest == nil {
+		return nil, nil
+	}
+	result := *longest
+	return &result, nil
+}
+
+func (m *Memory) SaveTwoFactorEnrolment(ctx context.Context, userID int, secret string, recoveryCodeHashes []string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	user.TwoFactorEnabled = false
+	stored := &memoryTwoFactor{secret: secret, recoveryCodes: make(map[string]bool)}
+	for _, codeHash := range recoveryCodeHashes {
+		stored.recoveryCodes[codeHash] = false
+	}
+	m.twoFactor[userID] = stored
+	return nil
+}
+
+func (m *Memory) EnableTwoFactor(ctx context.Context, userID int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if user, ok := m.users[userID]; ok {
+		user.TwoFactorEnabled = true
+	}
+	return nil
+}
+
+func (m *Memory) ClearTwoFactor(ctx context.Context, userID int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if user, ok := m.users[userID]; ok {
+		user.TwoFactorEnabled = false
+	}
+	delete(m.twoFactor, userID)
+	return nil
+}
+
+func (m *Memory) TwoFactorSecret(ctx context.Context, userID int) (string, bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return "", false, ErrNotFound
+	}
+	stored, ok := m.twoFactor[userID]
+	if !ok {
+		return "", false, nil
+	}
+	return stored.secret, user.TwoFactorEnabled, nil
+}
+
+func (m *Memory) ClaimTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored, ok := m.twoFactor[userID]
+	if !ok || (stored.lastStep != nil && *stored.lastStep >= step) {
+		return false, nil
+	}
+	stored.lastStep = &step
+	return true, nil
+}
+
+func (m *Memory) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored, ok := m.twoFactor[userID]
+	if !ok {
+		return false, nil
+	}
+	used, exists := stored.recoveryCodes[codeHash]
+	if !exists || used {
+		return false, nil
+	}
+	stored.recoveryCodes[codeHash] = true
+	return true, nil
+}
@@ -0,0 +1,299 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"openchamp/server/internal/auth"
+	"openchamp/server/internal/moderation"
+	"testing"
+	"time"
+)
+
+// The memory store must behave like the Postgres one, these tests describe
+// the constraints of the schema that the account service relies on.
+
+func registration(username, email, token string) Registration {
+	return Registration{
+		Username:      username,
+		PasswordHash:  "hash",
+		Email:         email,
+		Token:         token,
+		IPAddress:     "10.0.0.1",
+		TokenLifetime: time.Hour,
+	}
+}
+
+func TestMemoryRegister(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemory()
+
+	user, token, err := memory.Register(ctx, registration("Player", "player@example.com", "token-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != auth.RolePlayer || user.LastLogin == nil {
+		t.Errorf("registered user has role %q and last login %v, want a player who just logged in", user.Role, user.LastLogin)
+	}
+	if token.UserID != user.ID || token.IPAddress != "10.0.0.1" || !token.ExpiresAt.After(time.Now()) {
+		t.Errorf("registration token = %+v", token)
+	}
+	if _, err := memory.ActiveToken(ctx, "token-1"); err != nil {
+		t.Errorf("registration token is not active: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		registration Registration
+		want         error
+	}{
+		{"username differing in case", registration("PLAYER", "", "token-2"), ErrUsernameTaken},
+		{"email", registration("other", "player@example.com", "token-3"), ErrEmailTaken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := memory.Register(ctx, tt.registration); !errors.Is(err, tt.want) {
+				t.Fatalf("Register() error = %v, want %v", err, tt.want)
+			}
+			// Neither the user nor the token is stored on a conflict
+			if _, err := memory.ActiveToken(ctx, tt.registration.Token); !errors.Is(err, ErrNotFound) {
+				t.Errorf("token of a failed registration: %v, want ErrNotFound", err)
+			}
+		})
+	}
+
+	// Users without an email never conflict with each other
+	if _, _, err := memory.Register(ctx, registration("first", "", "token-4")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := memory.Register(ctx, registration("second", "", "token-5")); err != nil {
+		t.Errorf("second user without email: %v", err)
+	}
+}
+
+func TestMemoryLogin(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemory()
+	created, err := memory.CreateUser(ctx, "Player", "hash", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := memory.UserByUsername(ctx, "pLaYeR")
+	if err != nil {
+		t.Fatalf("lookup ignoring case: %v", err)
+	}
+	if user.ID != created.ID || user.Username != "Player" || user.PasswordHash != "hash" {
+		t.Errorf("UserByUsername() = %+v", user)
+	}
+	if _, err := memory.UserByUsername(ctx, "unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown username: %v, want ErrNotFound", err)
+	}
+	if _, err := memory.UserByID(ctx, created.ID+1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown id: %v, want ErrNotFound", err)
+	}
+
+	if err := memory.TouchLastLogin(ctx, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	user, err = memory.UserByID(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.LastLogin == nil {
+		t.Error("TouchLastLogin did not record the login")
+	}
+
+	// Returned users are copies, changing them does not change the store
+	user.Username = "changed"
+	if stored, _ := memory.UserByID(ctx, created.ID); stored.Username != "Player" {
+		t.Errorf("stored username = %q after changing a returned user", stored.Username)
+	}
+}
+
+func TestMemoryTokens(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemory()
+	user, err := memory.CreateUser(ctx, "player", "hash", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{"current", "other", "another"} {
+		if _, err := memory.CreateToken(ctx, user.ID, token, "10.0.0.1", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := memory.CreateToken(ctx, user.ID, "expired", "10.0.0.1", -time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := memory.CreateToken(ctx, user.ID+1, "orphan", "10.0.0.1", time.Hour); !errors.Is(err, ErrNotFound) {
+		t.Errorf("token for an unknown user: %v, want ErrNotFound", err)
+	}
+	if _, err := memory.CreateToken(ctx, user.ID, "current", "10.0.0.1", time.Hour); err == nil {
+		t.Error("duplicate token was accepted")
+	}
+	for _, token := range []string{"unknown", "expired"} {
+		if _, err := memory.ActiveToken(ctx, token); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ActiveToken(%q) = %v, want ErrNotFound", token, err)
+		}
+	}
+
+	stored, err := memory.ActiveToken(ctx, "current")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := memory.MarkTokenUsed(ctx, stored.ID, "10.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+	if used, _ := memory.ActiveToken(ctx, "current"); used.IPAddress != "10.0.0.2" || used.LastUsedAt == nil {
+		t.Errorf("used token = %+v, want the new IP and a last use", used)
+	}
+
+	if err := memory.RevokeToken(ctx, "another"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := memory.ActiveToken(ctx, "another"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("revoked token: %v, want ErrNotFound", err)
+	}
+
+	// The expired token still counts, only already revoked ones are skipped
+	revoked, err := memory.RevokeUserTokens(ctx, user.ID, "current")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked != 2 {
+		t.Errorf("RevokeUserTokens() = %d, want 2", revoked)
+	}
+	if _, err := memory.ActiveToken(ctx, "other"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("token after revoking all: %v, want ErrNotFound", err)
+	}
+	if _, err := memory.ActiveToken(ctx, "current"); err != nil {
+		t.Errorf("kept token: %v", err)
+	}
+}
+
+func TestMemoryUpdatePasswordKeepsOneToken(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemory()
+	user, _, err := memory.Register(ctx, registration("player", "", "kept"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := memory.CreateToken(ctx, user.ID, "stolen", "10.0.0.9", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := memory.UpdatePassword(ctx, user.ID, "new-hash", "kept"); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := memory.UserByID(ctx, user.ID); stored.PasswordHash != "new-hash" {
+		t.Errorf("password hash = %q, want new-hash", stored.PasswordHash)
+	}
+	if _, err := memory.ActiveToken(ctx, "stolen"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("other token after a password change: %v, want ErrNotFound", err)
+	}
+	if _, err := memory.ActiveToken(ctx, "kept"); err != nil {
+		t.Errorf("kept token: %v", err)
+	}
+}
+
+func TestMemoryDeleteUser(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemory()
+	user, _, err := memory.Register(ctx, registration("player", "player@example.com", "token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := memory.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := memory.ActiveToken(ctx, "token"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("token of a deleted user: %v, want ErrNotFound", err)
+	}
+	if err := memory.DeleteUser(ctx, user.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleting twice: %v, want ErrNotFound", err)
+	}
+	// The username and email are free again
+	if _, _, err := memory.Register(ctx, registration("player", "player@example.com", "token-2")); err != nil {
+		t.Errorf("registering a deleted username: %v", err)
+	}
+}
+
+func TestMemoryActiveSanction(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemory()
+	user, err := memory.CreateUser(ctx, "player", "hash", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	expired, soon, later := now.Add(-time.Minute), now.Add(time.Hour), now.Add(24*time.Hour)
+	memory.AddSanction(moderation.Sanction{UserID: user.ID, Type: moderation.SanctionBan, Reason: "expired", StartsAt: now.Add(-time.Hour), ExpiresAt: &expired})
+	memory.AddSanction(moderation.Sanction{UserID: user.ID, Type: moderation.SanctionBan, Reason: "future", StartsAt: now.Add(time.Hour)})
+	memory.AddSanction(moderation.Sanction{UserID: user.ID, Type: moderation.SanctionChatRestriction, Reason: "chat", StartsAt: now})
+	if ban, err := memory.ActiveSanction(ctx, user.ID, moderation.SanctionBan); err != nil || ban != nil {
+		t.Fatalf("ActiveSanction() = %+v, %v, want no active ban", ban, err)
+	}
+
+	memory.AddSanction(moderation.Sanction{UserID: user.ID, Type: moderation.SanctionBan, Reason: "soon", StartsAt: now, ExpiresAt: &soon})
+	memory.AddSanction(moderation.Sanction{UserID: user.ID, Type: moderation.SanctionBan, Reason: "later", StartsAt: now, ExpiresAt: &later})
+	if ban, err := memory.ActiveSanction(ctx, user.ID, moderation.SanctionBan); err != nil || ban == nil || ban.Reason != "later" {
+		t.Fatalf("ActiveSanction() = %+v, %v, want the longest ban", ban, err)
+	}
+
+	memory.AddSanction(moderation.Sanction{UserID: user.ID, Type: moderation.SanctionBan, Reason: "permanent", StartsAt: now})
+	if ban, err := memory.ActiveSanction(ctx, user.ID, moderation.SanctionBan); err != nil || ban == nil || ban.Reason != "permanent" {
+		t.Errorf("ActiveSanction() = %+v, %v, want the permanent ban", ban, err)
+	}
+}
+
+func TestMemoryTwoFactor(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemory()
+	user, err := memory.CreateUser(ctx, "player", "hash", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if secret, enabled, err := memory.TwoFactorSecret(ctx, user.ID); err != nil || secret != "" || enabled {
+		t.Fatalf("TwoFactorSecret() before enrolment = %q, %v, %v", secret, enabled, err)
+	}
+	if err := memory.SaveTwoFactorEnrolment(ctx, user.ID, "SECRET", []string{"code-hash"}); err != nil {
+		t.Fatal(err)
+	}
+	if secret, enabled, err := memory.TwoFactorSecret(ctx, user.ID); err != nil || secret != "SECRET" || enabled {
+		t.Fatalf("TwoFactorSecret() after enrolment = %q, %v, %v, want a disabled secret", secret, enabled, err)
+	}
+	if err := memory.EnableTwoFactor(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := memory.UserByID(ctx, user.ID); !stored.TwoFactorEnabled {
+		t.Error("user does not have two-factor enabled")
+	}
+
+	// Steps are single use and can not go backwards
+	for _, claim := range []struct {
+		step int64
+		want bool
+	}{{10, true}, {10, false}, {9, false}, {11, true}} {
+		if claimed, err := memory.ClaimTOTPStep(ctx, user.ID, claim.step); err != nil || claimed != claim.want {
+			t.Errorf("ClaimTOTPStep(%d) = %v, %v, want %v", claim.step, claimed, err, claim.want)
+		}
+	}
+
+	if used, err := memory.UseRecoveryCode(ctx, user.ID, "code-hash"); err != nil || !used {
+		t.Errorf("UseRecoveryCode() = %v, %v, want the code used", used, err)
+	}
+	if used, err := memory.UseRecoveryCode(ctx, user.ID, "code-hash"); err != nil || used {
+		t.Errorf("UseRecoveryCode() twice = %v, %v, want it rejected", used, err)
+	}
+
+	if err := memory.ClearTwoFactor(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if secret, enabled, err := memory.TwoFactorSecret(ctx, user.ID); err != nil || secret != "" || enabled {
+		t.Errorf("TwoFactorSecret() after clearing = %q, %v, %v", secret, enabled, err)
+	}
+}
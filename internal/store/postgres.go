@@ -0,0 +1,329 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"openchamp/server/internal/database"
+	"openchamp/server/internal/moderation"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Postgres implements the stores on top of a pgx pool
+type Postgres struct {
+	dbPool *pgxpool.Pool
+}
+
+func NewPostgres(dbPool *pgxpool.Pool) *Postgres {
+	return &Postgres{dbPool: dbPool}
+}
+
+// userColumns is the column list scanned by scanUser
+const userColumns = `id, username, password_hash, COALESCE(email, ''), role, created_at, last_login, totp_enabled`
+
+func scanUser(row pgx.Row) (*User, error) {
+	var user User
+	err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Email, &user.Role,
+		&user.CreatedAt, &user.LastLogin, &user.TwoFactorEnabled)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// conflictError maps unique violations on the users table onto the store errors
+func conflictError(err error) error {
+	constraint, ok := database.UniqueViolation(err)
+	if !ok {
+		return err
+	}
+	switch constraint {
+	case "users_username_key", "users_username_lower_key":
+		return ErrUsernameTaken
+	case "users_email_key":
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// nullableEmail stores an empty email as NULL so it does not collide with the unique constraint
+func nullableEmail(email string) *string {
+	if email == "" {
+		return nil
+	}
+	return &email
+}
+
+func (p *Postgres) CreateUser(ctx context.Context, username, passwordHash, email string) (*User, error) {
+	row := p.dbPool.QueryRow(ctx,
+		`INSERT INTO users (username, password_hash, email) VALUES ($1, $2, $3)
+		RETURNING `+userColumns,
+		username, passwordHash, nullableEmail(email))
+	user, err := scanUser(row)
+	if err != nil {
+		return nil, conflictError(err)
+	}
+	return user, nil
+}
+
+func (p *Postgres) Register(ctx context.Context, registration Registration) (*User, *Token, error) {
+	tx, err := p.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// The unique constraints decide conflicts, so two registrations racing for a name can not both succeed
+	user, err := scanUser(tx.QueryRow(ctx,
+		`INSERT INTO users (username, password_hash, email, last_login) VALUES ($1, $2, $3, NOW())
+		RETURNING `+userColumns,
+		registration.Username, registration.PasswordHash, nullableEmail(registration.Email)))
+	if err != nil {
+		return nil, nil, conflictError(err)
+	}
+
+	token, err := scanToken(tx.QueryRow(ctx, insertToken,
+		user.ID, registration.Token, registration.IPAddress, registration.TokenLifetime.Seconds()))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	return user, token, nil
+}
+
+func (p *Postgres) UserByID(ctx context.Context, id int) (*User, error) {
+	return scanUser(p.dbPool.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", id))
+}
+
+func (p *Postgres) UserByUsername(ctx context.Context, username string) (*User, error) {
+	return scanUser(p.dbPool.QueryRow(ctx,
+		"SELECT "+userColumns+" FROM users WHERE LOWER(username) = LOWER($1)",
+		username))
+}
+
+func (p *Postgres) UpdateEmail(ctx context.Context, id int, email string) error {
+	tag, err := p.dbPool.Exec(ctx, "UPDATE users SET email = $1 WHERE id = $2", nullableEmail(email), id)
+	if err != nil {
+		return conflictError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) UpdatePassword(ctx context.Context, id int, passwordHash, keepToken string) error {
+	tx, err := p.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, "UPDATE users SET password_hash = $1 WHERE id = $2", passwordHash, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	_, err = tx.Exec(ctx,
+		"UPDATE auth_tokens SET is_revoked = TRUE WHERE user_id = $1 AND token <> $2",
+		id, keepToken)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (p *Postgres) TouchLastLogin(ctx context.Context, id int) error {
+	_, err := p.dbPool.Exec(ctx, "UPDATE users SET last_login = NOW() WHERE id = $1", id)
+	return err
+}
+
+func (p *Postgres) DeleteUser(ctx context.Context, id int) error {
+	tag, err := p.dbPool.Exec(ctx, "DELETE FROM users WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *Postgres) LinkedProviders(ctx context.Context, id int) ([]string, error) {
+	rows, err := p.dbPool.Query(ctx,
+		"SELECT provider FROM external_identities WHERE user_id = $1 ORDER BY provider",
+		id)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// tokenColumns is the column list scanned by scanToken
+const tokenColumns = `id, user_id, token, COALESCE(ip_address, ''), created_at, expires_at, last_used_at, is_revoked`
+
+func scanToken(row pgx.Row) (*Token, error) {
+	var token Token
+	err := row.Scan(&token.ID, &token.UserID, &token.Token, &token.IPAddress,
+		&token.CreatedAt, &token.ExpiresAt, &token.LastUsedAt, &token.Revoked)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+const insertToken = `INSERT INTO auth_tokens (user_id, token, ip_address, created_at, expires_at)
+	VALUES ($1, $2, $3, NOW(), NOW() + make_interval(secs => $4))
+	RETURNING ` + tokenColumns
+
+func (p *Postgres) CreateToken(ctx context.Context, userID int, token, ip string, ttl time.Duration) (*Token, error) {
+	return scanToken(p.dbPool.QueryRow(ctx, insertToken, userID, token, ip, ttl.Seconds()))
+}
+
+func (p *Postgres) ActiveToken(ctx context.Context, token string) (*Token, error) {
+	return scanToken(p.dbPool.QueryRow(ctx,
+		`SELECT `+tokenColumns+`
+		FROM auth_tokens
+		WHERE token = $1
+		AND expires_at > NOW()
+		AND NOT is_revoked`,
+		token))
+}
+
+func (p *Postgres) MarkTokenUsed(ctx context.Context, id int, ip string) error {
+	_, err := p.dbPool.Exec(ctx,
+		"UPDATE auth_tokens SET last_used_at = NOW(), ip_address = $1 WHERE id = $2",
+		ip, id)
+	return err
+}
+
+func (p *Postgres) RevokeToken(ctx context.Context, token string) error {
+	_, err := p.dbPool.Exec(ctx, "UPDATE auth_tokens SET is_revoked = TRUE WHERE token = $1", token)
+	return err
+}
+
+func (p *Postgres) RevokeUserTokens(ctx context.Context, userID int, except string) (int, error) {
+	tag, err := p.dbPool.Exec(ctx,
+		"UPDATE auth_tokens SET is_revoked = TRUE WHERE user_id = $1 AND token <> $2 AND NOT is_revoked",
+		userID, except)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (p *Postgres) ActiveSanction(ctx context.Context, userID int, sanctionType moderation.SanctionType) (*moderation.Sanction, error) {
+	return moderation.ActiveSanction(ctx, p.dbPool, userID, sanctionType)
+}
+
+func (p *Postgres) SaveTwoFactorEnrolment(ctx context.Context, userID int, secret string, recoveryCodeHashes []string) error {
+	tx, err := p.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		"UPDATE users SET totp_secret = $1, totp_enabled = FALSE, totp_last_step = NULL WHERE id = $2",
+		secret, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+
+	for _, codeHash := range recoveryCodeHashes {
+		_, err = tx.Exec(ctx,
+			"INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)",
+			userID, codeHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (p *Postgres) EnableTwoFactor(ctx context.Context, userID int) error {
+	_, err := p.dbPool.Exec(ctx, "UPDATE users SET totp_enabled = TRUE WHERE id = $1", userID)
+	return err
+}
+
+func (p *Postgres) ClearTwoFactor(ctx context.Context, userID int) error {
+	tx, err := p.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		"UPDATE users SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = NULL WHERE id = $1",
+		userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (p *Postgres) TwoFactorSecret(ctx context.Context, userID int) (string, bool, error) {
+	var (
+		secret  pgtype.Text
+		enabled bool
+	)
+	err := p.dbPool.QueryRow(ctx,
+		"SELECT totp_secret, totp_enabled FROM users WHERE id = $1",
+		userID).Scan(&secret, &enabled)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", false, ErrNotFound
+		}
+		return "", false, err
+	}
+	return secret.String, enabled, nil
+}
+
+func (p *Postgres) ClaimTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	// Claiming the step in the same statement that checks it means only one
+	// of two concurrent logins can use a code
+	tag, err := p.dbPool.Exec(ctx,
+		`UPDATE users SET totp_last_step = $1
+		WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`,
+		step, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (p *Postgres) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	tag, err := p.dbPool.Exec(ctx,
+		`UPDATE recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,122 @@
+// Package store defines the persistence interfaces used by the account
+// service, with a Postgres implementation for the server and an in-memory
+// implementation for running without a database.
+package store
+
+import (
+	"context"
+	"errors"
+	"openchamp/server/internal/auth"
+	"openchamp/server/internal/moderation"
+	"time"
+)
+
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrUsernameTaken = errors.New("username already exists")
+	ErrEmailTaken    = errors.New("email already registered")
+)
+
+// User is a player account
+type User struct {
+	ID               int
+	Username         string
+	PasswordHash     string // Empty for accounts created through an external provider
+	Email            string // Empty when the user has no email
+	Role             auth.Role
+	CreatedAt        time.Time
+	LastLogin        *time.Time
+	TwoFactorEnabled bool
+}
+
+// Token is a login token issued to a user
+type Token struct {
+	ID         int
+	UserID     int
+	Token      string
+	IPAddress  string // IP the token was last used from
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+	Revoked    bool
+}
+
+// Registration is a new account and the token it is logged in with
+type Registration struct {
+	Username      string
+	PasswordHash  string
+	Email         string
+	Token         string
+	IPAddress     string
+	TokenLifetime time.Duration
+}
+
+// UserStore persists user accounts
+type UserStore interface {
+	// CreateUser stores a new player, returning ErrUsernameTaken or ErrEmailTaken on conflicts.
+	// Usernames are unique regardless of case.
+	CreateUser(ctx context.Context, username, passwordHash, email string) (*User, error)
+	// Register creates a new player together with their first login token,
+	// either both are stored or neither is. Conflicts are reported like CreateUser.
+	Register(ctx context.Context, registration Registration) (*User, *Token, error)
+	// UserByID returns ErrNotFound if the user does not exist
+	UserByID(ctx context.Context, id int) (*User, error)
+	// UserByUsername matches the username case-insensitively and returns ErrNotFound if the user does not exist
+	UserByUsername(ctx context.Context, username string) (*User, error)
+	// UpdateEmail changes the email, an empty email removes it
+	UpdateEmail(ctx context.Context, id int, email string) error
+	// UpdatePassword sets a new password hash and revokes every token of the user except keepToken
+	UpdatePassword(ctx context.Context, id int, passwordHash, keepToken string) error
+	TouchLastLogin(ctx context.Context, id int) error
+	// DeleteUser removes the user and their tokens
+	DeleteUser(ctx context.Context, id int) error
+	// LinkedProviders lists the external login providers linked to the user, sorted by name
+	LinkedProviders(ctx context.Context, id int) ([]string, error)
+}
+
+// TokenStore persists login tokens
+type TokenStore interface {
+	CreateToken(ctx context.Context, userID int, token, ip string, ttl time.Duration) (*Token, error)
+	// ActiveToken returns ErrNotFound if the token does not exist, has expired or was revoked
+	ActiveToken(ctx context.Context, token string) (*Token, error)
+	// MarkTokenUsed records that the token was just used from ip
+	MarkTokenUsed(ctx context.Context, id int, ip string) error
+	RevokeToken(ctx context.Context, token string) error
+	// RevokeUserTokens revokes every token of the user except the given one, returning how many were revoked
+	RevokeUserTokens(ctx context.Context, userID int, except string) (int, error)
+}
+
+// SanctionStore reads the sanctions checked when a user logs in
+type SanctionStore interface {
+	// ActiveSanction returns the longest running active sanction of the given type, or nil if there is none
+	ActiveSanction(ctx context.Context, userID int, sanctionType moderation.SanctionType) (*moderation.Sanction, error)
+}
+
+// TwoFactorStore persists TOTP secrets and recovery codes. Recovery codes
+// are only ever passed in hashed.
+type TwoFactorStore interface {
+	// SaveTwoFactorEnrolment stores a secret that stays disabled until
+	// EnableTwoFactor, replacing any previous secret and recovery codes
+	SaveTwoFactorEnrolment(ctx context.Context, userID int, secret string, recoveryCodeHashes []string) error
+	EnableTwoFactor(ctx context.Context, userID int) error
+	// ClearTwoFactor disables two-factor and removes the secret and recovery codes
+	ClearTwoFactor(ctx context.Context, userID int) error
+	// TwoFactorSecret returns an empty secret for users who never enrolled
+	TwoFactorSecret(ctx context.Context, userID int) (secret string, enabled bool, err error)
+	// ClaimTOTPStep records that the code of a time step was used, returning
+	// false if that step or a later one was used already
+	ClaimTOTPStep(ctx context.Context, userID int, step int64) (bool, error)
+	// UseRecoveryCode marks a recovery code as used, returning false if it is unknown or already used
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error)
+}
+
+var (
+	_ UserStore      = (*Postgres)(nil)
+	_ TokenStore     = (*Postgres)(nil)
+	_ SanctionStore  = (*Postgres)(nil)
+	_ TwoFactorStore = (*Postgres)(nil)
+	_ UserStore      = (*Memory)(nil)
+	_ TokenStore     = (*Memory)(nil)
+	_ SanctionStore  = (*Memory)(nil)
+	_ TwoFactorStore = (*Memory)(nil)
+)
@@ -0,0 +1,26 @@
+// Package version holds build information, set at link time with
+//
+//	go build -ldflags "-X openchamp/server/internal/version.Version=1.2.0 -X openchamp/server/internal/version.Commit=abc123"
+package version
+
+import "runtime/debug"
+
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+// Revision returns the commit the binary was built from, falling back to the VCS info embedded by the go tool
+func Revision() string {
+	if Commit != "" {
+		return Commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,190 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"openchamp/server/internal/account"
+	"openchamp/server/internal/audit"
+	"openchamp/server/internal/auth"
+	"openchamp/server/internal/moderation"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func (client *Client) handleAdminResetTwoFactor(msg Message) {
+	var request struct {
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal(msg.Payload, &request); err != nil || request.Username == "" {
+		client.sendError("admin_error", "Invalid reset format")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Taking away a second factor is as serious as a sanction, only a higher role may do it
+	target, err := client.accounts.UserByUsername(ctx, request.Username)
+	if err == nil {
+		err = moderation.CheckRank(ctx, client.dbPool, &client.userID, target.ID)
+	}
+	if err == nil {
+		err = client.accounts.ResetTwoFactor(ctx, request.Username, &client.userID, client.getClientIP())
+	}
+	if errors.Is(err, moderation.ErrOutranked) {
+		client.sendError("admin_error", "You cannot reset two-factor for a user whose role is equal to or above yours")
+		return
+	}
+	if err != nil {
+		if errors.Is(err, account.ErrUserNotFound) {
+			client.sendError("admin_error", "Unknown user: "+request.Username)
+			return
+		}
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error resetting two-factor")
+		client.sendError("admin_error", "Could not reset two-factor for "+request.Username)
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"admin":    client.username,
+		"username": request.Username,
+	}).Info("Admin reset two-factor authentication")
+	client.sendResponse("admin_reset_2fa", map[string]interface{}{
+		"success":  true,
+		"username": request.Username,
+	})
+}
+
+func (client *Client) handleAdminSetRole(msg Message) {
+	var request struct {
+		Username string `json:"username"`
+		Role     string `json:"role"`
+	}
+	if err := json.Unmarshal(msg.Payload, &request); err != nil || request.Username == "" {
+		client.sendError("admin_error", "Invalid role format")
+		return
+	}
+	if !auth.Role(request.Role).IsValid() {
+		client.sendError("admin_error", "Unknown role: "+request.Role)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Like sanctions, only a higher role may change someone's role, and
+	// nobody hands out a role above their own
+	target, err := client.accounts.UserByUsername(ctx, request.Username)
+	if err == nil {
+		err = moderation.CheckRank(ctx, client.dbPool, &client.userID, target.ID)
+	}
+	if err == nil && auth.Role(request.Role).Outranks(client.state().role) {
+		err = moderation.ErrOutranked
+	}
+	if err == nil {
+		_, err = client.dbPool.Exec(ctx, "UPDATE users SET role = $1 WHERE id = $2", request.Role, target.ID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, account.ErrUserNotFound):
+			client.sendError("admin_error", "Unknown user: "+request.Username)
+			return
+		case errors.Is(err, moderation.ErrOutranked):
+			client.sendError("admin_error", "You can only change the role of users below you, and not to a role above yours")
+			return
+		}
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error setting role")
+		client.sendError("admin_error", "Setting role failed due to a server error")
+		return
+	}
+
+	// Live connections get the new permissions right away instead of on their next login
+	manager.reloadPermissions(target.ID)
+
+	log.WithFields(logrus.Fields{
+		"admin":    client.username,
+		"username": target.Username,
+		"role":     request.Role,
+	}).Info("Admin changed user role")
+	audit.Record(client.dbPool, audit.Event{
+		Type:     audit.EventRoleChange,
+		ActorID:  &client.userID,
+		TargetID: &target.ID,
+		IP:       client.getClientIP(),
+		Details: map[string]interface{}{
+			"role": request.Role,
+		},
+	})
+	client.sendResponse("admin_set_role", map[string]interface{}{
+		"success":  true,
+		"username": request.Username,
+		"role":     request.Role,
+	})
+}
+
+func (client *Client) handleAuditQuery(msg Message) {
+	var request struct {
+		Type     string `json:"type"`
+		ActorID  int    `json:"actor_id"`
+		TargetID int    `json:"target_id"`
+		UserID   int    `json:"user_id"`
+		IP       string `json:"ip"`
+		Since    string `json:"since"`
+		Until    string `json:"until"`
+		Limit    int    `json:"limit"`
+		Offset   int    `json:"offset"`
+	}
+	if len(msg.Payload) > 0 {
+		if err := json.Unmarshal(msg.Payload, &request); err != nil {
+			client.sendError("audit_error", "Invalid audit query format")
+			return
+		}
+	}
+
+	filter := audit.Filter{
+		Type:     audit.EventType(request.Type),
+		ActorID:  request.ActorID,
+		TargetID: request.TargetID,
+		UserID:   request.UserID,
+		IP:       request.IP,
+		Limit:    request.Limit,
+		Offset:   request.Offset,
+	}
+	var err error
+	if request.Since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, request.Since); err != nil {
+			client.sendError("audit_error", "since must be an RFC 3339 timestamp")
+			return
+		}
+	}
+	if request.Until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, request.Until); err != nil {
+			client.sendError("audit_error", "until must be an RFC 3339 timestamp")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events, total, err := audit.Query(ctx, client.dbPool, filter)
+	if err != nil {
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error querying audit events")
+		client.sendError("audit_error", "Audit query failed due to a server error")
+		return
+	}
+
+	client.sendResponse("audit_events", map[string]interface{}{
+		"events": events,
+		"total":  total,
+		"offset": request.Offset,
+	})
+}
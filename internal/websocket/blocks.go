@@ -0,0 +1,185 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"openchamp/server/internal/social"
+	"openchamp/server/internal/store"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sirupsen/logrus"
+)
+
+// sendFromUser delivers a message a player caused, such as their chat or a
+// friend request, leaving out everyone who has blocked them. The sender is
+// always included. Every message routed from one player to others goes
+// through here so blocks are enforced by the server, not the clients. If
+// blocks cannot be loaded only the sender gets the message. It returns the
+// users the message was sent to.
+func sendFromUser(dbPool *pgxpool.Pool, senderID int, userIDs []int, msgType string, payload map[string]interface{}) []int {
+	var others []int
+	for _, userID := range userIDs {
+		if userID != senderID {
+			others = append(others, userID)
+		}
+	}
+
+	recipients := make([]int, 0, len(userIDs))
+	if len(others) < len(userIDs) {
+		recipients = append(recipients, senderID)
+	}
+	if len(others) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		blockers, err := social.BlockersAmong(ctx, dbPool, senderID, others)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"user_id": senderID,
+				"type":    msgType,
+				"error":   err,
+			}).Error("Error loading blocks, message only sent to the sender")
+			others = nil
+		}
+		blockedBy := make(map[int]bool, len(blockers))
+		for _, userID := range blockers {
+			blockedBy[userID] = true
+		}
+		for _, userID := range others {
+			if !blockedBy[userID] {
+				recipients = append(recipients, userID)
+			}
+		}
+	}
+
+	sendToUsers(recipients, msgType, payload)
+	return recipients
+}
+
+// blockTarget looks up the player named in a block request
+func (client *Client) blockTarget(username string) (*store.User, bool) {
+	if client.userID == 0 {
+		client.sendError("block_error", "Only players can block other players")
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := client.accounts.UserByUsername(ctx, username)
+	if err != nil {
+		client.sendServiceError("block_error", err, "Looking up the player failed due to a server error")
+		return nil, false
+	}
+	return user, true
+}
+
+func (client *Client) handleBlockAdd(msg Message) {
+	var request struct {
+		Username        string `json:"username"`
+		AvoidAsTeammate bool   `json:"avoid_as_teammate"`
+	}
+	if err := json.Unmarshal(msg.Payload, &request); err != nil || request.Username == "" {
+		client.sendError("block_error", "Invalid block format")
+		return
+	}
+	blocked, ok := client.blockTarget(request.Username)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	wereFriends, err := social.Block(ctx, client.dbPool, client.userID, blocked.ID, request.AvoidAsTeammate)
+	if err != nil {
+		client.sendSocialError("block_error", err, "Blocking the player failed due to a server error")
+		return
+	}
+
+	// Blocking ends any friendship, both sides see it go like a removal
+	if wereFriends {
+		sendToUsers([]int{client.userID}, "friend_removed", map[string]interface{}{
+			"user_id":  blocked.ID,
+			"username": blocked.Username,
+		})
+		sendToUsers([]int{blocked.ID}, "friend_removed", map[string]interface{}{
+			"user_id":  client.userID,
+			"username": client.username,
+		})
+	}
+	sendToUsers([]int{client.userID}, "block_added", map[string]interface{}{
+		"user_id":           blocked.ID,
+		"username":          blocked.Username,
+		"avoid_as_teammate": request.AvoidAsTeammate,
+	})
+}
+
+func (client *Client) handleBlockRemove(msg Message) {
+	var request struct {
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal(msg.Payload, &request); err != nil || request.Username == "" {
+		client.sendError("block_error", "Invalid block format")
+		return
+	}
+	blocked, ok := client.blockTarget(request.Username)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := social.Unblock(ctx, client.dbPool, client.userID, blocked.ID); err != nil {
+		client.sendSocialError("block_error", err, "Unblocking the player failed due to a server error")
+		return
+	}
+	sendToUsers([]int{client.userID}, "block_removed", map[string]interface{}{
+		"user_id":  blocked.ID,
+		"username": blocked.Username,
+	})
+}
+
+func (client *Client) handleBlockList(msg Message) {
+	if client.userID == 0 {
+		client.sendError("block_error", "Only players can block other players")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	blocks, err := social.Blocks(ctx, client.dbPool, client.userID)
+	if err != nil {
+		client.sendSocialError("block_error", err, "Loading blocked players failed due to a server error")
+		return
+	}
+
+	entries := make([]map[string]interface{}, 0, len(blocks))
+	for _, block := range blocks {
+		entries = append(entries, map[string]interface{}{
+			"user_id":           block.UserID,
+			"username":          block.Username,
+			"avoid_as_teammate": block.AvoidAsTeammate,
+			"since":             block.Since.UTC().Format(time.RFC3339),
+		})
+	}
+	client.sendResponse("block_list", map[string]interface{}{
+		"blocks": entries,
+	})
+}
+
+// blockedSet loads the players the client has blocked, for filtering stored messages
+func (client *Client) blockedSet(ctx context.Context) (map[int]bool, error) {
+	blockedIDs, err := social.BlockedIDs(ctx, client.dbPool, client.userID)
+	if err != nil {
+		return nil, err
+	}
+	blocked := make(map[int]bool, len(blockedIDs))
+	for _, userID := range blockedIDs {
+		blocked[userID] = true
+	}
+	return blocked, nil
+}
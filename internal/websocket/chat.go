@@ -0,0 +1,430 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"openchamp/server/internal/chat"
+	"openchamp/server/internal/moderation"
+	"openchamp/server/internal/social"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sirupsen/logrus"
+)
+
+// maxJoinedChannels bounds how many public channels a player can be in at once
+const maxJoinedChannels = 10
+
+var publicChannelName = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// chatChannel is a conversation between its members. Members are players,
+// so every connection of a member receives the channel's messages.
+type chatChannel struct {
+	id      string
+	kind    chat.Kind
+	name    string
+	members map[int]string // User id to username
+}
+
+// channelRegistry holds the open chat channels by id, which is "<kind>:<name>"
+type channelRegistry struct {
+	mutex    sync.Mutex
+	channels map[string]*chatChannel
+}
+
+var channels = channelRegistry{channels: make(map[string]*chatChannel)}
+
+func channelID(kind chat.Kind, name string) string {
+	return string(kind) + ":" + name
+}
+
+// OpenChannel opens a party or team channel for the given players, replacing
+// any channel of the same kind and name, and returns its id. Players cannot
+// join or leave these channels themselves, whoever opened one closes it.
+func OpenChannel(kind chat.Kind, name string, members map[int]string) string {
+	channel := &chatChannel{
+		id:      channelID(kind, name),
+		kind:    kind,
+		name:    name,
+		members: make(map[int]string, len(members)),
+	}
+	for userID, username := range members {
+		channel.members[userID] = username
+	}
+
+	channels.mutex.Lock()
+	channels.channels[channel.id] = channel
+	channels.mutex.Unlock()
+	return channel.id
+}
+
+// CloseChannel removes a channel and its membership
+func CloseChannel(id string) {
+	channels.mutex.Lock()
+	delete(channels.channels, id)
+	channels.mutex.Unlock()
+}
+
+// join adds a player to a public channel, creating it if needed. It returns
+// the usernames of all members and the ids of the other members, or false
+// if the player is already in too many channels.
+func (r *channelRegistry) join(name string, userID int, username string) ([]string, []int, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	joined := 0
+	for _, channel := range r.channels {
+		if _, ok := channel.members[userID]; ok && channel.kind == chat.KindPublic {
+			joined++
+		}
+	}
+
+	id := channelID(chat.KindPublic, name)
+	channel, ok := r.channels[id]
+	if !ok {
+		channel = &chatChannel{id: id, kind: chat.KindPublic, name: name, members: make(map[int]string)}
+		r.channels[id] = channel
+	}
+	if _, member := channel.members[userID]; !member {
+		if joined >= maxJoinedChannels {
+			if len(channel.members) == 0 {
+				delete(r.channels, id)
+			}
+			return nil, nil, false
+		}
+		channel.members[userID] = username
+	}
+
+	usernames := make([]string, 0, len(channel.members))
+	others := make([]int, 0, len(channel.members))
+	for memberID, member := range channel.members {
+		usernames = append(usernames, member)
+		if memberID != userID {
+			others = append(others, memberID)
+		}
+	}
+	sort.Strings(usernames)
+	return usernames, others, true
+}
+
+// leave removes a player from a public channel, which is closed once empty.
+// It returns the remaining members, or false if the player was not in it.
+func (r *channelRegistry) leave(id string, userID int) ([]int, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	channel, ok := r.channels[id]
+	if !ok || channel.kind != chat.KindPublic {
+		return nil, false
+	}
+	if _, member := channel.members[userID]; !member {
+		return nil, false
+	}
+	delete(channel.members, userID)
+	if len(channel.members) == 0 {
+		delete(r.channels, id)
+	}
+	return channel.memberIDs(), true
+}
+
+// leavePublic removes a player who went offline from all public channels
+// and returns the ids of the channels they left, with the remaining members
+func (r *channelRegistry) leavePublic(userID int) map[string][]int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	left := make(map[string][]int)
+	for id, channel := range r.channels {
+		if _, member := channel.members[userID]; !member || channel.kind != chat.KindPublic {
+			continue
+		}
+		delete(channel.members, userID)
+		if len(channel.members) == 0 {
+			delete(r.channels, id)
+		}
+		left[id] = channel.memberIDs()
+	}
+	return left
+}
+
+// recipients returns the members of a channel the player belongs to
+func (r *channelRegistry) recipients(id string, userID int) (*chatChannel, []int, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	channel, ok := r.channels[id]
+	if !ok {
+		return nil, nil, false
+	}
+	if _, member := channel.members[userID]; !member {
+		return nil, nil, false
+	}
+	return channel, channel.memberIDs(), true
+}
+
+// memberIDs must be called with the registry locked
+func (c *chatChannel) memberIDs() []int {
+	ids := make([]int, 0, len(c.members))
+	for userID := range c.members {
+		ids = append(ids, userID)
+	}
+	return ids
+}
+
+// leaveChatChannels takes a player who went offline out of public channels and tells the other members
+func leaveChatChannels(dbPool *pgxpool.Pool, userID int, username string) {
+	for id, members := range channels.leavePublic(userID) {
+		sendFromUser(dbPool, userID, members, "chat_member_left", map[string]interface{}{
+			"channel":  id,
+			"user_id":  userID,
+			"username": username,
+		})
+	}
+}
+
+// chatAllowed checks the client is a player without an active chat restriction
+func (client *Client) chatAllowed(ctx context.Context) bool {
+	if client.userID == 0 {
+		client.sendError("chat_error", "Only players can chat")
+		return false
+	}
+
+	restriction, err := moderation.ActiveSanction(ctx, client.dbPool, client.userID, moderation.SanctionChatRestriction)
+	if err != nil {
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error checking chat restriction")
+		client.sendError("chat_error", "Sending the message failed due to a server error")
+		return false
+	}
+	if restriction != nil {
+		client.sendResponse("error", chatRestrictedPayload(restriction))
+		return false
+	}
+	return true
+}
+
+// chatBody validates a message body, reporting problems to the client
+func (client *Client) chatBody(body string) (string, bool) {
+	body, err := chat.Normalize(body)
+	switch {
+	case errors.Is(err, chat.ErrEmpty):
+		client.sendError("chat_error", "The message is empty")
+		return "", false
+	case errors.Is(err, chat.ErrTooLong):
+		client.sendError("chat_error", "The message is too long")
+		return "", false
+	}
+	return body, true
+}
+
+func (client *Client) handleChatWhisper(msg Message) {
+	var request struct {
+		Username string `json:"username"`
+		Body     string `json:"body"`
+	}
+	if err := json.Unmarshal(msg.Payload, &request); err != nil || request.Username == "" {
+		client.sendError("chat_error", "Invalid whisper format")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if !client.chatAllowed(ctx) {
+		return
+	}
+	body, ok := client.chatBody(request.Body)
+	if !ok {
+		return
+	}
+
+	recipient, err := client.accounts.UserByUsername(ctx, request.Username)
+	if err != nil {
+		client.sendServiceError("chat_error", err, "Sending the whisper failed due to a server error")
+		return
+	}
+	if recipient.ID == client.userID {
+		client.sendError("chat_error", "You cannot whisper to yourself")
+		return
+	}
+	blocked, err := social.IsBlocked(ctx, client.dbPool, client.userID, recipient.ID)
+	if err != nil {
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error checking blocks for a whisper")
+		client.sendError("chat_error", "Sending the whisper failed due to a server error")
+		return
+	}
+	if blocked {
+		client.sendError("chat_error", "You cannot whisper to this player")
+		return
+	}
+
+	message, err := chat.NewMessage(chat.KindWhisper, client.userID, client.username, body)
+	if err != nil {
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error creating a whisper")
+		client.sendError("chat_error", "Sending the whisper failed due to a server error")
+		return
+	}
+	message.RecipientID = recipient.ID
+	message.Recipient = recipient.Username
+	if !client.filterChat(ctx, message) {
+		return
+	}
+
+	// Whispers to offline players wait for their next login
+	if currentPresence(recipient.ID).Status == StatusOffline {
+		message.Offline = true
+		if err := chat.StoreWhisper(ctx, client.dbPool, message); err != nil {
+			client.logger().WithFields(logrus.Fields{
+				"error": err,
+			}).Error("Error storing an offline whisper")
+			client.sendError("chat_error", "Sending the whisper failed due to a server error")
+			return
+		}
+		sendToUsers([]int{client.userID}, "chat_message", message.Payload())
+		chatHistory.Add(message, []int{recipient.ID})
+		return
+	}
+	sendFromUser(client.dbPool, client.userID, []int{client.userID, recipient.ID}, "chat_message", message.Payload())
+	chatHistory.Add(message, []int{recipient.ID})
+}
+
+func (client *Client) handleChatSend(msg Message) {
+	var request struct {
+		Channel string `json:"channel"`
+		Body    string `json:"body"`
+	}
+	if err := json.Unmarshal(msg.Payload, &request); err != nil || request.Channel == "" {
+		client.sendError("chat_error", "Invalid chat message format")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if !client.chatAllowed(ctx) {
+		return
+	}
+	body, ok := client.chatBody(request.Body)
+	if !ok {
+		return
+	}
+
+	channel, members, ok := channels.recipients(request.Channel, client.userID)
+	if !ok {
+		client.sendError("chat_error", "You are not in that channel")
+		return
+	}
+
+	message, err := chat.NewMessage(channel.kind, client.userID, client.username, body)
+	if err != nil {
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error creating a chat message")
+		client.sendError("chat_error", "Sending the message failed due to a server error")
+		return
+	}
+	message.Channel = channel.id
+	if !client.filterChat(ctx, message) {
+		return
+	}
+	// Members who blocked the sender do not see their messages
+	recipients := sendFromUser(client.dbPool, client.userID, members, "chat_message", message.Payload())
+	chatHistory.Add(message, recipients)
+}
+
+func (client *Client) handleChatJoin(msg Message) {
+	var request struct {
+		Channel string `json:"channel"`
+	}
+	if err := json.Unmarshal(msg.Payload, &request); err != nil {
+		client.sendError("chat_error", "Invalid channel format")
+		return
+	}
+	if client.userID == 0 {
+		client.sendError("chat_error", "Only players can chat")
+		return
+	}
+	if !publicChannelName.MatchString(request.Channel) {
+		client.sendError("chat_error", "Channel names are 1 to 32 lowercase letters, digits, dashes or underscores")
+		return
+	}
+
+	members, others, ok := channels.join(request.Channel, client.userID, client.username)
+	if !ok {
+		client.sendError("chat_error", "You are in too many channels")
+		return
+	}
+
+	id := channelID(chat.KindPublic, request.Channel)
+	sendToUsers([]int{client.userID}, "chat_joined", map[string]interface{}{
+		"channel": id,
+		"members": members,
+	})
+
+	sendFromUser(client.dbPool, client.userID, others, "chat_member_joined", map[string]interface{}{
+		"channel":  id,
+		"user_id":  client.userID,
+		"username": client.username,
+	})
+}
+
+func (client *Client) handleChatLeave(msg Message) {
+	var request struct {
+		Channel string `json:"channel"`
+	}
+	if err := json.Unmarshal(msg.Payload, &request); err != nil || request.Channel == "" {
+		client.sendError("chat_error", "Invalid channel format")
+		return
+	}
+
+	members, ok := channels.leave(request.Channel, client.userID)
+	if !ok {
+		client.sendError("chat_error", "You are not in that channel")
+		return
+	}
+	sendToUsers([]int{client.userID}, "chat_left", map[string]interface{}{
+		"channel": request.Channel,
+	})
+	sendFromUser(client.dbPool, client.userID, members, "chat_member_left", map[string]interface{}{
+		"channel":  request.Channel,
+		"user_id":  client.userID,
+		"username": client.username,
+	})
+}
+
+// deliverOfflineWhispers sends the whispers that arrived while the player was offline
+func (client *Client) deliverOfflineWhispers() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Whispers from players blocked since they were sent are dropped. Blocks
+	// are loaded first, taking the whispers marks them delivered.
+	blocked, err := client.blockedSet(ctx)
+	if err != nil {
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error loading blocks for offline whispers")
+		return
+	}
+	messages, err := chat.TakePendingWhispers(ctx, client.dbPool, client.userID)
+	if err != nil {
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error loading offline whispers")
+		return
+	}
+	for i := range messages {
+		if !blocked[messages[i].SenderID] {
+			client.sendResponse("chat_message", messages[i].Payload())
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package websocket
+
+import (
+	"context"
+	"openchamp/server/internal/chat"
+	"openchamp/server/internal/config"
+	"openchamp/server/internal/moderation"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// autoRestrictReason is recorded on chat restrictions the server issues itself
+const autoRestrictReason = "Automatic: repeated chat filter violations"
+
+// chatModeration filters chat messages before delivery. Without
+// ConfigureChat messages are delivered unfiltered.
+var chatModeration struct {
+	filter         *chat.Pipeline
+	restrictAfter  int
+	restrictWindow time.Duration
+	restrictFor    time.Duration
+}
+
+// ConfigureChat sets up the chat filter pipeline and automatic chat restrictions
+func ConfigureChat(cfg config.ChatConfig) error {
+	filter, err := chat.NewPipelineFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	chatModeration.filter = filter
+	chatModeration.restrictAfter = cfg.RestrictAfter
+	chatModeration.restrictWindow = cfg.RestrictWindow
+	chatModeration.restrictFor = cfg.RestrictFor
+	return nil
+}
+
+// filterChat runs a message through the filters, masking its body if the
+// channel's policy says so. It returns false if the message must not be delivered.
+func (client *Client) filterChat(ctx context.Context, message *chat.Message) bool {
+	result := chatModeration.filter.Run(message)
+	if result.Action == "" {
+		return true
+	}
+
+	client.recordChatViolation(ctx, message, result)
+
+	switch result.Action {
+	case chat.ActionBlock:
+		client.sendCodedError("chat_error", "message_blocked",
+			"Your message was blocked by the chat filter ("+strings.Join(result.Reasons(), ", ")+")")
+		return false
+	case chat.ActionMask:
+		message.Body = result.Body
+	}
+	return true
+}
+
+// recordChatViolation stores a filtered message for review and restricts the
+// sender from chatting once they have too many violations that count towards it
+func (client *Client) recordChatViolation(ctx context.Context, message *chat.Message, result chat.Result) {
+	violation := &moderation.ChatViolation{
+		UserID:    client.userID,
+		MessageID: message.ID,
+		Kind:      string(message.Kind),
+		Channel:   message.Channel,
+		Body:      message.Body,
+		Reasons:   result.Reasons(),
+		Action:    string(result.Action),
+	}
+	if message.RecipientID != 0 {
+		violation.RecipientID = &message.RecipientID
+	}
+
+	count, err := moderation.RecordChatViolation(ctx, client.dbPool, violation, chatModeration.restrictWindow)
+	if err != nil {
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error recording a chat violation")
+		return
+	}
+	client.logger().WithFields(logrus.Fields{
+		"message_id": message.ID,
+		"reasons":    violation.Reasons,
+		"action":     violation.Action,
+		"violations": count,
+	}).Info("Chat message filtered")
+
+	if chatModeration.restrictAfter <= 0 || count < chatModeration.restrictAfter {
+		return
+	}
+	restriction, err := IssueSanction(client.dbPool, client.userID, moderation.SanctionChatRestriction,
+		autoRestrictReason, nil, chatModeration.restrictFor)
+	if err != nil {
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error issuing an automatic chat restriction")
+		return
+	}
+	sendToUsers([]int{client.userID}, "error", chatRestrictedPayload(restriction))
+}
+
+// chatRestrictedPayload tells a player why and until when they cannot chat
+func chatRestrictedPayload(restriction *moderation.Sanction) map[string]interface{} {
+	payload := restriction.Payload()
+	payload["subtype"] = "chat_restricted"
+	payload["message"] = "You are restricted from chatting"
+	return payload
+}
@@ -0,0 +1,179 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"openchamp/server/internal/social"
+	"openchamp/server/internal/store"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// friendTarget decodes a {"username"} payload and looks the player up
+func (client *Client) friendTarget(msg Message) (*store.User, bool) {
+	var request struct {
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal(msg.Payload, &request); err != nil || request.Username == "" {
+		client.sendError("friend_error", "Invalid friend format")
+		return nil, false
+	}
+	if client.userID == 0 {
+		client.sendError("friend_error", "Only players can have friends")
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := client.accounts.UserByUsername(ctx, request.Username)
+	if err != nil {
+		client.sendServiceError("friend_error", err, "Looking up the player failed due to a server error")
+		return nil, false
+	}
+	return user, true
+}
+
+// sendSocialError reports a social error to the client, logging unexpected ones
+func (client *Client) sendSocialError(category string, err error, fallback string) {
+	switch {
+	case errors.Is(err, social.ErrSelf),
+		errors.Is(err, social.ErrBlocked),
+		errors.Is(err, social.ErrAlreadyFriends),
+		errors.Is(err, social.ErrRequestPending),
+		errors.Is(err, social.ErrNoFriendRequest),
+		errors.Is(err, social.ErrBlockSelf),
+		errors.Is(err, social.ErrTooManyAvoided),
+		errors.Is(err, social.ErrNotBlocked):
+		message := err.Error()
+		client.sendError(category, strings.ToUpper(message[:1])+message[1:])
+	default:
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error(fallback)
+		client.sendError(category, fallback)
+	}
+}
+
+func (client *Client) handleFriendRequest(msg Message) {
+	target, ok := client.friendTarget(msg)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	status, err := social.RequestFriend(ctx, client.dbPool, client.userID, target.ID)
+	if err != nil {
+		client.sendSocialError("friend_error", err, "Sending the friend request failed due to a server error")
+		return
+	}
+
+	// A request to someone who already asked us is an accept
+	if status == social.FriendAccepted {
+		client.announceFriendship(target.ID, target.Username)
+		return
+	}
+	client.sendResponse("friend_request_sent", map[string]interface{}{
+		"user_id":  target.ID,
+		"username": target.Username,
+	})
+	sendFromUser(client.dbPool, client.userID, []int{target.ID}, "friend_request_received", map[string]interface{}{
+		"user_id":  client.userID,
+		"username": client.username,
+	})
+}
+
+func (client *Client) handleFriendAccept(msg Message) {
+	requester, ok := client.friendTarget(msg)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := social.AcceptFriend(ctx, client.dbPool, client.userID, requester.ID); err != nil {
+		client.sendSocialError("friend_error", err, "Accepting the friend request failed due to a server error")
+		return
+	}
+	client.announceFriendship(requester.ID, requester.Username)
+}
+
+// announceFriendship tells both players they are now friends, along with each other's presence
+func (client *Client) announceFriendship(friendID int, friendUsername string) {
+	sendToUsers([]int{client.userID}, "friend_accepted", presence.lookup(friendID, friendUsername).payload())
+	sendToUsers([]int{friendID}, "friend_accepted", presence.lookup(client.userID, client.username).payload())
+}
+
+func (client *Client) handleFriendRemove(msg Message) {
+	friend, ok := client.friendTarget(msg)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	removed, err := social.RemoveFriend(ctx, client.dbPool, client.userID, friend.ID)
+	if err != nil {
+		client.sendSocialError("friend_error", err, "Removing the friend failed due to a server error")
+		return
+	}
+	if !removed {
+		client.sendError("friend_error", "You are not friends with "+friend.Username)
+		return
+	}
+
+	sendToUsers([]int{client.userID}, "friend_removed", map[string]interface{}{
+		"user_id":  friend.ID,
+		"username": friend.Username,
+	})
+	sendToUsers([]int{friend.ID}, "friend_removed", map[string]interface{}{
+		"user_id":  client.userID,
+		"username": client.username,
+	})
+}
+
+func (client *Client) handleFriendList(msg Message) {
+	if client.userID == 0 {
+		client.sendError("friend_error", "Only players can have friends")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	friends, err := social.Friends(ctx, client.dbPool, client.userID)
+	if err != nil {
+		client.sendSocialError("friend_error", err, "Loading friends failed due to a server error")
+		return
+	}
+
+	entries := make([]map[string]interface{}, 0, len(friends))
+	for _, friend := range friends {
+		entry := map[string]interface{}{
+			"user_id":  friend.UserID,
+			"username": friend.Username,
+			"status":   friend.Status,
+			"incoming": friend.Incoming,
+			"since":    friend.Since.UTC().Format(time.RFC3339),
+		}
+		// Presence is only shared between accepted friends
+		if friend.Status == social.FriendAccepted {
+			current := presence.lookup(friend.UserID, friend.Username)
+			entry["presence"] = current.Status
+			if current.CustomStatus != "" {
+				entry["custom_status"] = current.CustomStatus
+			}
+		}
+		entries = append(entries, entry)
+	}
+	client.sendResponse("friend_list", map[string]interface{}{
+		"friends": entries,
+	})
+}
@@ -2,16 +2,17 @@ package websocket
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"net"
-	"openchamp/server/internal/util"
+	"openchamp/server/internal/account"
+	"openchamp/server/internal/auth"
+	"openchamp/server/internal/metrics"
+	"strings"
 	"time"
 
-	"github.com/google/uuid"
-	"github.com/jackc/pgx"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type Message struct {
@@ -19,43 +20,93 @@ type Message struct {
 	Payload json.RawMessage `json:"payload"`
 }
 
-func handlePacket(client *Client, message_string string, log *logrus.Logger) {
+// messageHandler describes how a message type is handled and who may send it
+type messageHandler struct {
+	handle     func(*Client, Message)
+	public     bool            // May be sent before authenticating
+	permission auth.Permission // Required permission, empty means any authenticated client
+	sensitive  []string        // Payload fields that are never written to logs
+}
+
+// messageHandlers maps each message type to its handler
+var messageHandlers = map[string]messageHandler{
+	"login":           {handle: (*Client).handleAuthentication, public: true, sensitive: []string{"password"}},
+	"token_auth":      {handle: (*Client).handleAuthentication, public: true, sensitive: []string{"token"}},
+	"register":        {handle: (*Client).handleRegistration, public: true, sensitive: []string{"password", "email"}},
+	"2fa_verify":      {handle: (*Client).handleTwoFactorVerify, public: true, sensitive: []string{"challenge", "code", "recovery_code"}},
+	"service_auth":    {handle: (*Client).handleServiceAuthentication, public: true, sensitive: []string{"api_key"}},
+	"2fa_enroll":      {handle: (*Client).handleTwoFactorEnroll, permission: auth.PermAccountManage},
+	"2fa_confirm":     {handle: (*Client).handleTwoFactorConfirm, permission: auth.PermAccountManage, sensitive: []string{"code"}},
+	"2fa_disable":     {handle: (*Client).handleTwoFactorDisable, permission: auth.PermAccountManage, sensitive: []string{"code"}},
+	"admin_reset_2fa": {handle: (*Client).handleAdminResetTwoFactor, permission: auth.PermRolesManage},
+	"admin_set_role":  {handle: (*Client).handleAdminSetRole, permission: auth.PermRolesManage},
+	"sanction_issue":  {handle: (*Client).handleSanctionIssue, permission: auth.PermSanctionsIssue},
+	"sanction_revoke": {handle: (*Client).handleSanctionRevoke, permission: auth.PermSanctionsIssue},
+	"audit_query":     {handle: (*Client).handleAuditQuery, permission: auth.PermAuditRead},
+
+	"friend_request": {handle: (*Client).handleFriendRequest, permission: auth.PermGamePlay},
+	"friend_accept":  {handle: (*Client).handleFriendAccept, permission: auth.PermGamePlay},
+	"friend_remove":  {handle: (*Client).handleFriendRemove, permission: auth.PermGamePlay},
+	"friend_list":    {handle: (*Client).handleFriendList, permission: auth.PermGamePlay},
+	"presence_set":   {handle: (*Client).handlePresenceSet, permission: auth.PermGamePlay},
+	"block_add":      {handle: (*Client).handleBlockAdd, permission: auth.PermGamePlay},
+	"block_remove":   {handle: (*Client).handleBlockRemove, permission: auth.PermGamePlay},
+	"block_list":     {handle: (*Client).handleBlockList, permission: auth.PermGamePlay},
+
+	"chat_whisper": {handle: (*Client).handleChatWhisper, permission: auth.PermGamePlay},
+	"chat_send":    {handle: (*Client).handleChatSend, permission: auth.PermGamePlay},
+	"chat_join":    {handle: (*Client).handleChatJoin, permission: auth.PermGamePlay},
+	"chat_leave":   {handle: (*Client).handleChatLeave, permission: auth.PermGamePlay},
+
+	"report_player": {handle: (*Client).handleReportPlayer, permission: auth.PermGamePlay},
+
+	"service_account_create": {handle: (*Client).handleServiceAccountCreate, permission: auth.PermServiceAccountsManage},
+	"service_account_list":   {handle: (*Client).handleServiceAccountList, permission: auth.PermServiceAccountsManage},
+	"api_key_create":         {handle: (*Client).handleAPIKeyCreate, permission: auth.PermServiceAccountsManage},
+	"api_key_rotate":         {handle: (*Client).handleAPIKeyRotate, permission: auth.PermServiceAccountsManage},
+	"api_key_revoke":         {handle: (*Client).handleAPIKeyRevoke, permission: auth.PermServiceAccountsManage},
+}
+
+func handlePacket(client *Client, message_string string) {
 	// Try to parse the message as JSON
 	var message Message
 	if err := json.Unmarshal([]byte(message_string), &message); err != nil {
-		// If the message is not JSON, just log it as a string
-		log.WithFields(logrus.Fields{
-			"client_id": client.id,
-			"message":   message_string,
-		}).Info("Received String as Message")
+		// Plain text could be anything, so only its size is logged
+		client.logger().WithFields(logrus.Fields{
+			"message": redactMessage([]byte(message_string)),
+		}).Debug("Received String as Message")
+		return
 	}
 
-	switch message.Type {
-	case "login":
-		client.handleAuthentication(message)
-	case "register":
-		client.handleRegistration(message)
-	case "token_auth":
-		// Handle token authentication request
-		// Token-based authentication
-		var tokenAuth struct {
-			Token string `json:"token"`
-		}
-		// Extract client's real IP address from connection
-		clientIP := client.getClientIP()
+	handler, ok := messageHandlers[message.Type]
+	if !ok {
+		metrics.MessagesReceived.WithLabelValues(metrics.UnknownType).Inc()
+		client.sendError("unknown_message_type", "Unknown message type: "+message.Type)
+		return
+	}
+	metrics.MessagesReceived.WithLabelValues(message.Type).Inc()
 
-		// Validate token against database
-		username, valid, err := client.validateToken(tokenAuth.Token, clientIP)
-		if err != nil || !valid {
-			client.sendError("token_error", "Invalid or expired token")
+	// Check the client is allowed to send this message
+	if !handler.public {
+		if !client.authenticated {
+			client.sendError("unauthenticated", "You must be logged in to do that")
+			return
+		}
+		// Permissions may be reloaded by another goroutine when an admin changes the role
+		if handler.permission != "" && !client.state().permissions.Has(handler.permission) {
+			client.logger().WithFields(logrus.Fields{
+				"username":   client.username,
+				"type":       message.Type,
+				"permission": handler.permission,
+			}).Warn("Permission denied")
+			client.sendError("permission_denied", "You do not have permission to do that")
 			return
 		}
-
-		// Authentication successful
-		client.completeAuthentication(username, tokenAuth.Token)
-
 	}
 
+	timer := prometheus.NewTimer(metrics.HandlerDuration.WithLabelValues(message.Type))
+	defer timer.ObserveDuration()
+	handler.handle(client, message)
 }
 
 func (client *Client) getClientIP() string {
@@ -73,6 +124,9 @@ func (client *Client) getClientIP() string {
 	return ip
 }
 func (client *Client) handleAuthentication(msg Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
 	switch msg.Type {
 	case "login":
 		// Username/password authentication
@@ -82,20 +136,27 @@ func (client *Client) handleAuthentication(msg Message) {
 		}
 
 		if err := json.Unmarshal(msg.Payload, &credentials); err != nil {
-			log.Printf("Error parsing login credentials: %v", err)
-			client.sendError("","Invalid login format")
+			client.logger().WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("Error parsing login credentials")
+			client.sendAuthError("Invalid login format")
 			return
 		}
 
-		// Validate credentials against database
-		authenticated, token, err := client.validateCredentials(credentials.Username, credentials.Password)
-		if err != nil || !authenticated {
-			client.sendAuthError("Invalid username or password")
+		result, err := client.accounts.Login(ctx, credentials.Username, credentials.Password, client.getClientIP())
+		if err != nil {
+			client.sendServiceError("auth_error", err, "Login failed due to a server error")
+			return
+		}
+
+		// Accounts with two-factor enabled must pass a challenge before a token is issued
+		if result.Challenge != nil {
+			client.startTwoFactorChallenge(result.Challenge)
 			return
 		}
 
 		// Authentication successful
-		client.completeAuthentication(credentials.Username, token)
+		client.completeAuthentication(result.Session)
 
 	case "token_auth":
 		// Token-based authentication
@@ -104,23 +165,21 @@ func (client *Client) handleAuthentication(msg Message) {
 		}
 
 		if err := json.Unmarshal(msg.Payload, &tokenAuth); err != nil {
-			log.Printf("Error parsing token auth: %v", err)
+			client.logger().WithFields(logrus.Fields{
+				"error": err,
+			}).Warn("Error parsing token auth")
 			client.sendAuthError("Invalid token format")
 			return
 		}
 
-		// Extract client's real IP address from connection
-		clientIP := client.getClientIP()
-
-		// Validate token against database
-		username, valid, err := client.validateToken(tokenAuth.Token, clientIP)
-		if err != nil || !valid {
-			client.sendAuthError("Invalid or expired token")
+		session, err := client.accounts.Authenticate(ctx, tokenAuth.Token, client.getClientIP())
+		if err != nil {
+			client.sendServiceError("auth_error", err, "Login failed due to a server error")
 			return
 		}
 
 		// Authentication successful
-		client.completeAuthentication(username, tokenAuth.Token)
+		client.completeAuthentication(session)
 	}
 }
 
@@ -132,214 +191,173 @@ func (client *Client) handleRegistration(msg Message) {
 	}
 
 	if err := json.Unmarshal(msg.Payload, &registration); err != nil {
-		log.Printf("Error parsing registration data: %v", err)
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Warn("Error parsing registration data")
 		client.sendError("registration_error", "Invalid registration format")
 		return
 	}
 
-	// Validate input
-	if len(registration.Username) < 3 {
-		client.sendError("registration_error", "Username must be at least 3 characters")
-		return
-	}
-
-	if len(registration.Password) < 6 {
-		client.sendError("registration_error", "Password must be at least 6 characters")
-		return
-	}
-
-	if registration.Email != "" && !util.IsValidEmail(registration.Email) {
-		client.sendError("registration_error", "Invalid email format")
-		return
-	}
-
-	// Check if username already exists
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var exists bool
-	err := client.dbPool.QueryRow(ctx,
-		"SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)",
-		registration.Username).Scan(&exists)
-
+	session, err := client.accounts.Register(ctx, registration.Username, registration.Password,
+		registration.Email, client.getClientIP())
 	if err != nil {
-		log.Printf("Database error during registration: %v", err)
-		client.sendError("registration_error", "Registration failed due to a server error")
-		return
-	}
-
-	if exists {
-		client.sendError("registration_error", "Username already exists")
+		client.sendServiceError("registration_error", err, "Registration failed due to a server error")
 		return
 	}
 
-	// Check if email already exists (if provided)
-	if registration.Email != "" {
-		err = client.dbPool.QueryRow(ctx,
-			"SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)",
-			registration.Email).Scan(&exists)
+	// Registration and auto-login successful
+	client.setSession(session)
 
-		if err != nil {
-			log.Printf("Database error during registration: %v", err)
-			client.sendError("registration_error", "Registration failed due to a server error")
-			return
-		}
+	// Send success response with auto-login token
+	client.sendRegistrationSuccess(true, registration.Username, session.Token)
 
-		if exists {
-			client.sendError("registration_error", "Email already registered")
-			return
-		}
-	}
+	client.logger().WithFields(logrus.Fields{
+		"username": registration.Username,
+	}).Info("New user registered and authenticated")
+}
 
-	// Hash the password using bcrypt
-	password, err := bcrypt.GenerateFromPassword([]byte(registration.Password), 12)
-	if err != nil {
-		log.Printf("Error hashing password: %v", err)
-		client.sendError("registration_error", "Registration failed due to a server error")
-		return
+// sendServiceError reports an account service error to the client. Known
+// errors are shown to the user, anything else is logged and replaced by the fallback message.
+func (client *Client) sendServiceError(category string, err error, fallback string) {
+	var (
+		validationErr *account.ValidationError
+		bannedErr     *account.BannedError
+	)
+	switch {
+	case errors.As(err, &validationErr):
+		client.sendError(category, validationErr.Message)
+	case errors.As(err, &bannedErr):
+		client.sendBanned(bannedErr.Sanction)
+	case errors.Is(err, account.ErrInvalidCredentials):
+		client.sendError(category, "Invalid username or password")
+	case errors.Is(err, account.ErrInvalidToken):
+		client.sendError(category, "Invalid or expired token")
+	case errors.Is(err, account.ErrUsernameTaken):
+		client.sendCodedError(category, "username_taken", "Username already exists")
+	case errors.Is(err, account.ErrEmailTaken):
+		client.sendCodedError(category, "email_taken", "Email already registered")
+	case errors.Is(err, account.ErrUserNotFound):
+		client.sendError(category, "Unknown user")
+	case errors.Is(err, account.ErrInvalidChallenge),
+		errors.Is(err, account.ErrInvalidCode),
+		errors.Is(err, account.ErrTooManyAttempts),
+		errors.Is(err, account.ErrTwoFactorEnabled):
+		message := err.Error()
+		client.sendError(category, strings.ToUpper(message[:1])+message[1:])
+	default:
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error(fallback)
+		client.sendError(category, fallback)
 	}
-	passwordHash := string(password)
-
-	// Insert user into database
-	_, err = client.dbPool.Exec(ctx,
-		"INSERT INTO users (username, password_hash, email) VALUES ($1, $2, $3)",
-		registration.Username, passwordHash, registration.Email)
+}
 
-	if err != nil {
-		log.Printf("Error inserting new user: %v", err)
-		client.sendError("registration_error", "Registration failed due to a server error")
-		return
-	}
+func (client *Client) sendError(category string, message string) {
+	client.sendResponse("error", map[string]interface{}{
+		"subtype": category,
+		"message": message,
+	})
+}
 
-	// Generate token for automatic login
-	token := uuid.New().String()
+// sendCodedError sends an error with a machine readable code next to the message
+func (client *Client) sendCodedError(category, code, message string) {
+	client.sendResponse("error", map[string]interface{}{
+		"subtype": category,
+		"code":    code,
+		"message": message,
+	})
+}
 
-	// Get the user ID for the token
-	var userID int
-	err = client.dbPool.QueryRow(ctx,
-		"SELECT id FROM users WHERE username = $1",
-		registration.Username).Scan(&userID)
+func (client *Client) sendAuthError(message string) {
+	client.sendError("auth_error", message)
+}
 
-	if err != nil {
-		log.Printf("Error retrieving new user ID: %v", err)
-		// Registration was successful, but auto-login failed
-		client.sendRegistrationSuccess(false, "", "")
-		return
+// sendResponse sends a typed message with the given payload to the client
+func (client *Client) sendResponse(msgType string, payload map[string]interface{}) {
+	response := map[string]interface{}{
+		"type":    msgType,
+		"payload": payload,
 	}
-
-	// Get client's real IP
-	clientIP := client.getClientIP()
-
-	// Store token with IP
-	_, err = client.dbPool.Exec(ctx,
-		"INSERT INTO auth_tokens (user_id, token, ip_address, created_at, expires_at) VALUES ($1, $2, $3, NOW(), NOW() + INTERVAL '7 days')",
-		userID, token, clientIP)
-
-	if err != nil {
-		log.Printf("Error creating token for new user: %v", err)
-		// Registration was successful, but auto-login failed
-		client.sendRegistrationSuccess(false, "", "")
+	responseJSON, _ := json.Marshal(response)
+	if !client.trySend(responseJSON) {
+		client.dropFull()
 		return
 	}
+	metrics.MessagesSent.WithLabelValues(msgType).Inc()
+}
 
-	// Registration and auto-login successful
-	client.username = registration.Username
+// setSession marks the client as logged in as the session's user
+func (client *Client) setSession(session *account.Session) {
+	previousUserID := client.userID
+	client.stateMutex.Lock()
 	client.authenticated = true
-	client.authToken = token
+	client.userID = session.UserID
+	client.serviceAccountID = 0
+	client.username = session.Username
+	client.stateMutex.Unlock()
+	client.authToken = session.Token
+	client.pendingChallenge = ""
+	client.loadPermissions()
+
+	if previousUserID != 0 && previousUserID != session.UserID {
+		presence.left(client.dbPool, previousUserID)
+	}
+	presence.joined(client.dbPool, session.UserID)
+}
 
-	// Send success response with auto-login token
-	client.sendRegistrationSuccess(true, registration.Username, token)
+func (client *Client) completeAuthentication(session *account.Session) {
+	client.setSession(session)
+	username, token := session.Username, session.Token
 
-	log.Printf("New user registered and authenticated: %s", registration.Username)
+	// Send successful authentication response
+	client.sendResponse("auth_success", map[string]interface{}{
+		"username": username,
+		"token":    token,
+		"role":     client.state().role,
+	})
+
+	client.logger().WithFields(logrus.Fields{
+		"username": username,
+	}).Info("Client authenticated")
+
+	client.deliverOfflineWhispers()
+	client.deliverReportFeedback()
 }
 
-func (client *Client) validateToken(token, clientIP string) (string, bool, error) {
+// loadPermissions fetches the role and permissions of the authenticated user.
+// On failure the client keeps an empty permission set so checks fail closed.
+// It is also run from other goroutines when the user's role changes.
+func (client *Client) loadPermissions() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var (
-		username string
-		storedIP sql.NullString
-		tokenID  int
-	)
-
-	// Query the database to validate the token
-	err := client.dbPool.QueryRow(ctx,
-		`SELECT t.id, u.username, t.ip_address
-		FROM auth_tokens t
-		JOIN users u ON t.user_id = u.id
-		WHERE t.token = $1 
-		AND t.expires_at > NOW()`,
-		token).Scan(&tokenID, &username, &storedIP)
-
+	userID := client.state().userID
+	role, permissions, err := auth.LoadUserPermissions(ctx, client.dbPool, userID)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return "", false, nil // Token not found or expired
-		}
-		return "", false, err // Database error
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error loading permissions")
+		role, permissions = "", auth.NewPermissionSet()
 	}
-
-	// Check IP restrictions if a previous IP is stored
-	if storedIP.Valid && storedIP.String != "" {
-		// If this is a different IP than previously used with this token,
-		// we can either reject it or implement additional security checks
-		if storedIP.String != clientIP {
-			log.Printf("Warning: Token used from new IP. Original: %s, Current: %s",
-				storedIP.String, clientIP)
-
-			// Depending on security requirements, you might want to:
-			// 1. Reject the attempt (uncomment the next line)
-			// return "", false, nil
-
-			// 2. Allow it but track the new IP
-			// 3. Require additional verification
-			// 4. Rate limit new IP logins
-		}
-	}
-
-	// Update the token's last_used_at timestamp and IP
-	_, err = client.dbPool.Exec(ctx,
-		`UPDATE auth_tokens 
-		SET last_used_at = NOW(), 
-		    ip_address = $1
-		WHERE id = $2`,
-		clientIP, tokenID)
-
-	if err != nil {
-		log.Printf("Error updating token usage: %v", err)
-		// Non-critical error, we can continue
-	}
-
-	return username, true, nil
-}
-func (client *Client) sendError(category string, message string) {
-	response := map[string]interface{}{
-		"type": "error",
-		"payload": map[string]interface{}{
-			"subtype": category,
-			"message": message,
-		},
+	client.stateMutex.Lock()
+	defer client.stateMutex.Unlock()
+	// The connection may have logged in as someone else in the meantime
+	if client.userID == userID {
+		client.role = role
+		client.permissions = permissions
 	}
-	responseJSON, _ := json.Marshal(response)
-	client.send <- responseJSON
 }
-func (client *Client) completeAuthentication(username string, token string) {
-	client.authenticated = true
-	client.username = username
-	client.authToken = token
 
-	// Send successful authentication response
-	response := map[string]interface{}{
-		"type": "auth_success",
-		"payload": map[string]interface{}{
-			"username": username,
-			"token":    token,
-		},
+// reloadPermissions applies a role change to every live connection of the user
+func (manager *ClientManager) reloadPermissions(userID int) {
+	for _, client := range manager.snapshot() {
+		if state := client.state(); state.authenticated && state.userID == userID {
+			client.loadPermissions()
+		}
 	}
-	responseJSON, _ := json.Marshal(response)
-	client.send <- responseJSON
-
-	log.Printf("Client authenticated: %s as %s", client.id, username)
 }
 
 func (client *Client) sendRegistrationSuccess(autoLogin bool, username, token string) {
@@ -355,11 +373,5 @@ func (client *Client) sendRegistrationSuccess(autoLogin bool, username, token st
 		payload["token"] = token
 	}
 
-	response := map[string]interface{}{
-		"type":    "register_success",
-		"payload": payload,
-	}
-
-	responseJSON, _ := json.Marshal(response)
-	client.send <- responseJSON
+	client.sendResponse("register_success", payload)
 }
@@ -0,0 +1,236 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"openchamp/server/internal/social"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sirupsen/logrus"
+)
+
+// Status is what friends see a player doing
+type Status string
+
+const (
+	StatusOffline        Status = "offline"
+	StatusOnline         Status = "online"
+	StatusInQueue        Status = "in_queue"
+	StatusChampionSelect Status = "in_champion_select"
+	StatusInGame         Status = "in_game"
+)
+
+// statusRank orders statuses so a player on several connections shows the most engaged one
+var statusRank = map[Status]int{
+	StatusOffline:        0,
+	StatusOnline:         1,
+	StatusInQueue:        2,
+	StatusChampionSelect: 3,
+	StatusInGame:         4,
+}
+
+// presenceGracePeriod is how long a player may be gone before friends see
+// them go offline, so a reconnect does not flap their presence
+const presenceGracePeriod = 15 * time.Second
+
+// maxCustomStatusLength bounds the custom status text in characters
+const maxCustomStatusLength = 128
+
+// Presence is the status of a player as pushed to their friends
+type Presence struct {
+	UserID       int    `json:"user_id"`
+	Username     string `json:"username"`
+	Status       Status `json:"status"`
+	CustomStatus string `json:"custom_status,omitempty"`
+}
+
+func (p Presence) payload() map[string]interface{} {
+	payload := map[string]interface{}{
+		"user_id":  p.UserID,
+		"username": p.Username,
+		"status":   p.Status,
+	}
+	if p.CustomStatus != "" {
+		payload["custom_status"] = p.CustomStatus
+	}
+	return payload
+}
+
+// presenceTracker remembers what friends were last told about each player
+type presenceTracker struct {
+	mutex     sync.Mutex
+	announced map[int]Presence    // Last presence pushed for each player that is not offline
+	custom    map[int]string      // Custom status text, kept until the player goes offline
+	leaving   map[int]*time.Timer // Players whose last connection closed, within the grace period
+}
+
+var presence = presenceTracker{
+	announced: make(map[int]Presence),
+	custom:    make(map[int]string),
+	leaving:   make(map[int]*time.Timer),
+}
+
+// SetStatus changes what a player's connections are doing, for example when
+// matchmaking puts them in a queue, and tells their friends
+func SetStatus(dbPool *pgxpool.Pool, userID int, status Status) {
+	for _, client := range manager.snapshot() {
+		client.stateMutex.Lock()
+		if client.authenticated && client.userID == userID {
+			client.status = status
+		}
+		client.stateMutex.Unlock()
+	}
+	presence.update(dbPool, userID)
+}
+
+// joined cancels a pending offline push and announces the player if their presence changed
+func (p *presenceTracker) joined(dbPool *pgxpool.Pool, userID int) {
+	p.mutex.Lock()
+	if timer, ok := p.leaving[userID]; ok {
+		timer.Stop()
+		delete(p.leaving, userID)
+	}
+	p.mutex.Unlock()
+	p.update(dbPool, userID)
+}
+
+// left waits out the grace period before friends see the player go offline
+func (p *presenceTracker) left(dbPool *pgxpool.Pool, userID int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if _, ok := p.leaving[userID]; ok {
+		return
+	}
+	p.leaving[userID] = time.AfterFunc(presenceGracePeriod, func() {
+		p.mutex.Lock()
+		delete(p.leaving, userID)
+		p.mutex.Unlock()
+		p.update(dbPool, userID)
+	})
+}
+
+// setCustom changes the custom status text of a player and tells their friends
+func (p *presenceTracker) setCustom(dbPool *pgxpool.Pool, userID int, text string) {
+	p.mutex.Lock()
+	if text == "" {
+		delete(p.custom, userID)
+	} else {
+		p.custom[userID] = text
+	}
+	p.mutex.Unlock()
+	p.update(dbPool, userID)
+}
+
+// lookup returns the presence friends currently see for a player
+func (p *presenceTracker) lookup(userID int, username string) Presence {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if announced, ok := p.announced[userID]; ok {
+		return announced
+	}
+	return Presence{UserID: userID, Username: username, Status: StatusOffline}
+}
+
+// update derives the player's presence from their live connections and
+// pushes it to their friends if it differs from what they were last told.
+// While the player is within the grace period their last presence stands.
+func (p *presenceTracker) update(dbPool *pgxpool.Pool, userID int) {
+	current := currentPresence(userID)
+
+	p.mutex.Lock()
+	if _, ok := p.leaving[userID]; ok && current.Status == StatusOffline {
+		p.mutex.Unlock()
+		return
+	}
+	last, seen := p.announced[userID]
+	if current.Status == StatusOffline {
+		current.Username = last.Username
+		delete(p.announced, userID)
+		delete(p.custom, userID)
+	} else {
+		current.CustomStatus = p.custom[userID]
+		p.announced[userID] = current
+	}
+	p.mutex.Unlock()
+
+	if current.Status == StatusOffline {
+		leaveChatChannels(dbPool, userID, current.Username)
+	}
+	if (seen && last == current) || (!seen && current.Status == StatusOffline) {
+		return
+	}
+	p.notifyFriends(dbPool, current)
+}
+
+// notifyFriends pushes a presence to every connected friend of the player
+func (p *presenceTracker) notifyFriends(dbPool *pgxpool.Pool, current Presence) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	friendIDs, err := social.FriendIDs(ctx, dbPool, current.UserID)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"user_id": current.UserID,
+			"error":   err,
+		}).Error("Error loading friends for a presence update")
+		return
+	}
+	sendToUsers(friendIDs, "presence", current.payload())
+}
+
+// currentPresence combines the live connections of a player, showing the most engaged status
+func currentPresence(userID int) Presence {
+	current := Presence{UserID: userID, Status: StatusOffline}
+	for _, client := range manager.snapshot() {
+		state := client.state()
+		if !state.authenticated || state.userID != userID {
+			continue
+		}
+		current.Username = state.username
+		status := state.status
+		if status == "" {
+			status = StatusOnline
+		}
+		if statusRank[status] > statusRank[current.Status] {
+			current.Status = status
+		}
+	}
+	return current
+}
+
+// sendToUsers sends a message to every connection of the given users. A
+// connection that is not keeping up is dropped instead of waited for.
+func sendToUsers(userIDs []int, msgType string, payload map[string]interface{}) {
+	if len(userIDs) == 0 {
+		return
+	}
+	recipients := make(map[int]bool, len(userIDs))
+	for _, userID := range userIDs {
+		recipients[userID] = true
+	}
+
+	for _, client := range manager.snapshot() {
+		if state := client.state(); state.authenticated && recipients[state.userID] {
+			client.sendResponse(msgType, payload)
+		}
+	}
+}
+
+func (client *Client) handlePresenceSet(msg Message) {
+	var request struct {
+		CustomStatus string `json:"custom_status"`
+	}
+	if err := json.Unmarshal(msg.Payload, &request); err != nil {
+		client.sendError("presence_error", "Invalid presence format")
+		return
+	}
+	if len([]rune(request.CustomStatus)) > maxCustomStatusLength {
+		client.sendError("presence_error", "The custom status is too long")
+		return
+	}
+
+	presence.setCustom(client.dbPool, client.userID, request.CustomStatus)
+	client.sendResponse("presence_set", presence.lookup(client.userID, client.username).payload())
+}
@@ -0,0 +1,86 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// redacted replaces the value of every sensitive field in logged messages
+const redacted = "[REDACTED]"
+
+// alwaysSensitive fields are redacted from every message type, so a new
+// handler that forgets to list its sensitive fields does not leak them
+var alwaysSensitive = []string{"password", "token", "api_key", "code", "recovery_code", "challenge", "email"}
+
+// redactMessage returns a raw client message that is safe to log. The
+// sensitive fields of its message type, and the fields in alwaysSensitive,
+// are replaced wherever they appear, at the top level, in the payload and in
+// any object nested inside them. Messages that are not a JSON object are
+// reduced to their size.
+func redactMessage(raw []byte) string {
+	var message map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &message); err != nil {
+		return fmt.Sprintf("<%d bytes, not a JSON object>", len(raw))
+	}
+
+	var messageType string
+	json.Unmarshal(message["type"], &messageType)
+	fields := append(append([]string(nil), alwaysSensitive...), messageHandlers[messageType].sensitive...)
+
+	if payload, ok := message["payload"]; ok {
+		// Handlers only accept object payloads, anything else is dropped rather than inspected
+		var payloadFields map[string]json.RawMessage
+		if err := json.Unmarshal(payload, &payloadFields); err != nil || payloadFields == nil {
+			message["payload"] = json.RawMessage(`"` + redacted + `"`)
+		}
+	}
+	redactFields(message, fields)
+
+	safe, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Sprintf("<%d bytes>", len(raw))
+	}
+	return string(safe)
+}
+
+// redactFields replaces the listed fields of a decoded object and of every
+// object nested in it. Keys are matched ignoring case, like encoding/json
+// does when the handlers decode them.
+func redactFields(object map[string]json.RawMessage, fields []string) {
+	for key, value := range object {
+		if isSensitive(key, fields) {
+			object[key] = json.RawMessage(`"` + redacted + `"`)
+		} else {
+			object[key] = redactValue(value, fields)
+		}
+	}
+}
+
+// redactValue redacts the objects inside a JSON value, other values are returned unchanged
+func redactValue(value json.RawMessage, fields []string) json.RawMessage {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(value, &object); err == nil && object != nil {
+		redactFields(object, fields)
+		redactedValue, _ := json.Marshal(object)
+		return redactedValue
+	}
+	var array []json.RawMessage
+	if err := json.Unmarshal(value, &array); err == nil && array != nil {
+		for i := range array {
+			array[i] = redactValue(array[i], fields)
+		}
+		redactedValue, _ := json.Marshal(array)
+		return redactedValue
+	}
+	return value
+}
+
+func isSensitive(key string, fields []string) bool {
+	for _, field := range fields {
+		if strings.EqualFold(key, field) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,210 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"openchamp/server/internal/account"
+	"openchamp/server/internal/store"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var startHub sync.Once
+
+func TestRedactMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		secrets []string
+		keep    []string
+	}{
+		{
+			name:    "login payload",
+			message: `{"type":"login","payload":{"username":"player","password":"hunter2"}}`,
+			secrets: []string{"hunter2"},
+			keep:    []string{"player"},
+		},
+		{
+			name:    "field matched ignoring case",
+			message: `{"type":"login","payload":{"username":"player","PassWord":"hunter2"}}`,
+			secrets: []string{"hunter2"},
+		},
+		{
+			name:    "top level",
+			message: `{"type":"token_auth","token":"secret-token","payload":{}}`,
+			secrets: []string{"secret-token"},
+		},
+		{
+			name:    "nested object",
+			message: `{"type":"login","payload":{"username":"player","extra":{"auth":{"password":"hunter2","code":"918273"}}}}`,
+			secrets: []string{"hunter2", "918273"},
+			keep:    []string{"player"},
+		},
+		{
+			name:    "nested array",
+			message: `{"type":"chat_send","payload":{"attachments":[{"token":"secret-token"},{"email":"player@example.com"}]}}`,
+			secrets: []string{"secret-token", "player@example.com"},
+		},
+		{
+			name:    "payload that is not an object",
+			message: `{"type":"login","payload":"password=hunter2"}`,
+			secrets: []string{"hunter2"},
+		},
+		{
+			name:    "not JSON",
+			message: `password=hunter2`,
+			secrets: []string{"hunter2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			safe := redactMessage([]byte(tt.message))
+			for _, secret := range tt.secrets {
+				if strings.Contains(safe, secret) {
+					t.Errorf("redactMessage(%s) = %s, contains %q", tt.message, safe, secret)
+				}
+			}
+			for _, kept := range tt.keep {
+				if !strings.Contains(safe, kept) {
+					t.Errorf("redactMessage(%s) = %s, lost %q", tt.message, safe, kept)
+				}
+			}
+		})
+	}
+}
+
+// TestCredentialsNeverLogged sends credentials over a real connection with
+// debug logging on and checks that no log entry contains them. The database
+// is unreachable, so the error paths of the handlers are logged as well.
+func TestCredentialsNeverLogged(t *testing.T) {
+	const (
+		password      = "correct-horse-battery"
+		wrongPassword = "wrong-horse-battery"
+		nestedSecret  = "nested-secret-value"
+		storedToken   = "stored-token-3f9c2a"
+		totpCode      = "918273"
+		newPassword   = "registered-password-77"
+		email         = "new.player@example.com"
+	)
+
+	memory := store.NewMemory()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := memory.CreateUser(context.Background(), "player", string(hash), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := memory.CreateToken(context.Background(), user.ID, storedToken, "127.0.0.1", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing listens on port 1, every query fails straight away
+	dbPool, err := pgxpool.New(context.Background(), "postgres://openchamp@127.0.0.1:1/openchamp?connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbPool.Close()
+	accounts := account.NewService(dbPool, memory, memory, memory, memory)
+
+	hook := test.NewGlobal()
+	defer log.ReplaceHooks(make(logrus.LevelHooks))
+	level, output := log.GetLevel(), log.Out
+	log.SetLevel(logrus.DebugLevel)
+	log.SetOutput(io.Discard)
+	defer func() {
+		log.SetLevel(level)
+		log.SetOutput(output)
+	}()
+
+	startHub.Do(func() {
+		go manager.run()
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleWebSocketConnection(w, r, dbPool, accounts)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	messages := []string{
+		`password=` + password,
+		`{"type":"login","payload":{"username":"player","password":"` + wrongPassword + `"}}`,
+		`{"type":"login","payload":{"username":"player","password":"` + password + `"}}`,
+		`{"type":"login","payload":{"username":"player","options":{"password":"` + nestedSecret + `"}}}`,
+		`{"type":"login","payload":"` + password + `"}`,
+		`{"type":"token_auth","payload":{"token":"` + storedToken + `"}}`,
+		`{"type":"2fa_verify","payload":{"challenge":"unknown","code":"` + totpCode + `"}}`,
+		`{"type":"register","payload":{"username":"newplayer","password":"` + newPassword + `","email":"` + email + `"}}`,
+		`{"type":"register","payload":{"username":"x","password":"` + newPassword + `"}}`,
+		`{"type":"end_of_test","payload":{}}`,
+	}
+	for _, message := range messages {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Messages are handled in order, the unknown type at the end answers last
+	secrets := []string{password, wrongPassword, nestedSecret, storedToken, totpCode, newPassword, email}
+	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("reading responses: %v", err)
+		}
+		var response struct {
+			Type    string                 `json:"type"`
+			Payload map[string]interface{} `json:"payload"`
+		}
+		if json.Unmarshal(raw, &response) != nil {
+			continue
+		}
+		if token, ok := response.Payload["token"].(string); ok {
+			secrets = append(secrets, token)
+		}
+		if message, _ := response.Payload["message"].(string); strings.Contains(message, "end_of_test") {
+			break
+		}
+	}
+
+	entries := hook.AllEntries()
+	if len(entries) == 0 {
+		t.Fatal("nothing was logged")
+	}
+	debugged := false
+	for _, entry := range entries {
+		line, err := entry.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Message == "Received message" {
+			debugged = true
+		}
+		for _, secret := range secrets {
+			if strings.Contains(line, secret) {
+				t.Errorf("log entry contains %q: %s", secret, line)
+			}
+		}
+	}
+	if !debugged {
+		t.Error("raw messages were not logged at debug level")
+	}
+}
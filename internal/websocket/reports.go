@@ -0,0 +1,156 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"openchamp/server/internal/chat"
+	"openchamp/server/internal/moderation"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sirupsen/logrus"
+)
+
+// chatHistory remembers recent chat so reports can capture what the reporter saw
+var chatHistory = chat.NewHistory()
+
+// maxMatchIDLength bounds the match id a report refers to
+const maxMatchIDLength = 64
+
+func (client *Client) handleReportPlayer(msg Message) {
+	var request struct {
+		Username string `json:"username"`
+		Category string `json:"category"`
+		Comment  string `json:"comment"`
+		MatchID  string `json:"match_id"`
+	}
+	if err := json.Unmarshal(msg.Payload, &request); err != nil || request.Username == "" {
+		client.sendError("report_error", "Invalid report format")
+		return
+	}
+	category := moderation.ReportCategory(request.Category)
+	comment := strings.TrimSpace(request.Comment)
+	switch {
+	case client.userID == 0:
+		client.sendError("report_error", "Only players can file reports")
+		return
+	case !category.IsValid():
+		client.sendError("report_error", "Unknown report category: "+request.Category)
+		return
+	case len([]rune(comment)) > moderation.MaxReportComment:
+		client.sendError("report_error", "The comment is too long")
+		return
+	case len(request.MatchID) > maxMatchIDLength:
+		client.sendError("report_error", "Invalid match id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reported, err := client.accounts.UserByUsername(ctx, request.Username)
+	if err != nil {
+		client.sendServiceError("report_error", err, "Filing the report failed due to a server error")
+		return
+	}
+
+	reporterID := client.userID
+	report := &moderation.Report{
+		ReporterID: &reporterID,
+		ReportedID: reported.ID,
+		Category:   category,
+		Comment:    comment,
+		MatchID:    request.MatchID,
+		Evidence:   reportEvidence(reported.ID, client.userID),
+	}
+	err = moderation.CreateReport(ctx, client.dbPool, report)
+	switch {
+	case errors.Is(err, moderation.ErrReportSelf),
+		errors.Is(err, moderation.ErrReportDuplicate),
+		errors.Is(err, moderation.ErrTooManyReports):
+		message := err.Error()
+		client.sendError("report_error", strings.ToUpper(message[:1])+message[1:])
+		return
+	case err != nil:
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error filing a report")
+		client.sendError("report_error", "Filing the report failed due to a server error")
+		return
+	}
+
+	client.logger().WithFields(logrus.Fields{
+		"report_id":   report.ID,
+		"reported_id": reported.ID,
+		"category":    category,
+	}).Info("Player reported")
+	client.sendResponse("report_submitted", map[string]interface{}{
+		"report_id": report.ID,
+	})
+}
+
+// reportEvidence captures what the server knows about the reported player
+// right now: the chat the reporter received from them and their presence.
+// Matches are not tracked by this server, so no participant record is attached.
+func reportEvidence(reportedID, reporterID int) map[string]interface{} {
+	lines := []map[string]interface{}{}
+	for _, message := range chatHistory.SeenBy(reportedID, reporterID) {
+		lines = append(lines, message.Payload())
+	}
+	return map[string]interface{}{
+		"captured_at": time.Now().UTC().Format(time.RFC3339),
+		"chat":        lines,
+		"presence":    currentPresence(reportedID).Status,
+	}
+}
+
+// NotifyReportActioned tells the reporter that action was taken on their
+// report. A reporter who is offline is told at their next login.
+func NotifyReportActioned(dbPool *pgxpool.Pool, reporterID, reportID int) {
+	if currentPresence(reporterID).Status == StatusOffline {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	feedback, err := moderation.TakeReportFeedback(ctx, dbPool, reporterID, reportID)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"user_id": reporterID,
+			"error":   err,
+		}).Error("Error sending report feedback")
+		return
+	}
+	for _, item := range feedback {
+		sendToUsers([]int{reporterID}, "report_feedback", reportFeedbackPayload(item))
+	}
+}
+
+// deliverReportFeedback tells a player who just logged in about reports that were actioned while they were away
+func (client *Client) deliverReportFeedback() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	feedback, err := moderation.TakeReportFeedback(ctx, client.dbPool, client.userID, 0)
+	if err != nil {
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error loading report feedback")
+		return
+	}
+	for _, item := range feedback {
+		client.sendResponse("report_feedback", reportFeedbackPayload(item))
+	}
+}
+
+func reportFeedbackPayload(feedback moderation.ReportFeedback) map[string]interface{} {
+	return map[string]interface{}{
+		"report_id":   feedback.ReportID,
+		"category":    feedback.Category,
+		"reported_at": feedback.CreatedAt.UTC().Format(time.RFC3339),
+		"message":     "Thank you for your report. Action was taken against the player you reported.",
+	}
+}
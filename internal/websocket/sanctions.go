@@ -0,0 +1,215 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"openchamp/server/internal/moderation"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sirupsen/logrus"
+)
+
+// kickGracePeriod gives the write pump time to deliver the final message before the connection closes
+const kickGracePeriod = 500 * time.Millisecond
+
+// IssueSanction stores a new sanction. A zero duration makes it permanent.
+// The issuer must outrank the user, otherwise moderation.ErrOutranked is
+// returned. Active sessions of a banned user are disconnected immediately.
+func IssueSanction(dbPool *pgxpool.Pool, userID int, sanctionType moderation.SanctionType, reason string, issuedBy *int, duration time.Duration) (*moderation.Sanction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := moderation.CheckRank(ctx, dbPool, issuedBy, userID); err != nil {
+		return nil, err
+	}
+	sanction, err := moderation.IssueSanction(ctx, dbPool, userID, sanctionType, reason, issuedBy, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	if sanctionType == moderation.SanctionBan {
+		manager.kickUser(userID, sanction)
+	}
+	return sanction, nil
+}
+
+// RevokeSanction lifts a sanction early, returning false if it does not exist
+// or was already revoked. Like issuing, the revoker must outrank the user the
+// sanction was placed on, otherwise moderation.ErrOutranked is returned.
+func RevokeSanction(dbPool *pgxpool.Pool, sanctionID int, revokedBy *int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := moderation.CheckRevokeRank(ctx, dbPool, revokedBy, sanctionID); err != nil {
+		return false, err
+	}
+	return moderation.RevokeSanction(ctx, dbPool, sanctionID, revokedBy)
+}
+
+// sendBanned tells the client why and until when their account is banned
+func (client *Client) sendBanned(ban *moderation.Sanction) {
+	payload := ban.Payload()
+	payload["subtype"] = "account_banned"
+	payload["message"] = "Your account has been banned: " + ban.Reason
+	client.sendResponse("error", payload)
+}
+
+// kickUser disconnects every client logged in as the user after telling them about the ban
+func (manager *ClientManager) kickUser(userID int, ban *moderation.Sanction) {
+	manager.disconnectUser(userID, "banned", func(client *Client) {
+		client.sendBanned(ban)
+	})
+}
+
+// disconnectUser sends each client logged in as the user a final message and closes the connection
+func (manager *ClientManager) disconnectUser(userID int, reason string, notify func(*Client)) int {
+	return manager.disconnectClients(func(client *Client) bool {
+		state := client.state()
+		return state.authenticated && state.userID == userID
+	}, reason, notify)
+}
+
+// disconnectClients sends each matching client a final message, closes the
+// connection and returns how many clients matched. Clients are notified
+// outside the manager lock so a client that is not reading can not hold it.
+func (manager *ClientManager) disconnectClients(match func(*Client) bool, reason string, notify func(*Client)) int {
+	disconnected := 0
+	for _, client := range manager.snapshot() {
+		if !match(client) {
+			continue
+		}
+		client.setDisconnectReason(reason)
+		notify(client)
+		conn := client.conn
+		time.AfterFunc(kickGracePeriod, func() {
+			conn.Close()
+		})
+
+		client.logger().WithFields(logrus.Fields{
+			"reason": reason,
+		}).Info("Client kicked")
+		disconnected++
+	}
+	return disconnected
+}
+
+// DisconnectUser ends every live session of the user, for example after their account is deleted
+func DisconnectUser(userID int, reason string) int {
+	return manager.disconnectUser(userID, reason, sendDisconnected(reason))
+}
+
+// DisconnectClient ends a single connection by its client id, reporting whether it was connected
+func DisconnectClient(clientID string, reason string) bool {
+	return manager.disconnectClients(func(client *Client) bool {
+		return client.id == clientID
+	}, reason, sendDisconnected(reason)) > 0
+}
+
+// sendDisconnected tells a client why it is being disconnected
+func sendDisconnected(reason string) func(*Client) {
+	return func(client *Client) {
+		client.sendResponse("disconnected", map[string]interface{}{
+			"reason": reason,
+		})
+	}
+}
+
+func (client *Client) handleSanctionIssue(msg Message) {
+	var request struct {
+		Username        string `json:"username"`
+		Type            string `json:"type"`
+		Reason          string `json:"reason"`
+		DurationMinutes int    `json:"duration_minutes"` // 0 for permanent
+	}
+	if err := json.Unmarshal(msg.Payload, &request); err != nil || request.Username == "" {
+		client.sendError("sanction_error", "Invalid sanction format")
+		return
+	}
+	sanctionType := moderation.SanctionType(request.Type)
+	if !sanctionType.IsValid() {
+		client.sendError("sanction_error", "Unknown sanction type: "+request.Type)
+		return
+	}
+	if request.Reason == "" {
+		client.sendError("sanction_error", "A reason is required")
+		return
+	}
+	if request.DurationMinutes < 0 {
+		client.sendError("sanction_error", "Duration cannot be negative")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var userID int
+	err := client.dbPool.QueryRow(ctx,
+		"SELECT id FROM users WHERE LOWER(username) = LOWER($1)",
+		request.Username).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			client.sendError("sanction_error", "Unknown user: "+request.Username)
+			return
+		}
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Database error issuing sanction")
+		client.sendError("sanction_error", "Issuing sanction failed due to a server error")
+		return
+	}
+
+	issuer := client.userID
+	sanction, err := IssueSanction(client.dbPool, userID, sanctionType, request.Reason, &issuer,
+		time.Duration(request.DurationMinutes)*time.Minute)
+	if errors.Is(err, moderation.ErrOutranked) {
+		client.sendError("sanction_error", "You cannot sanction a user whose role is equal to or above yours")
+		return
+	}
+	if err != nil {
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error issuing sanction")
+		client.sendError("sanction_error", "Issuing sanction failed due to a server error")
+		return
+	}
+
+	payload := sanction.Payload()
+	payload["username"] = request.Username
+	client.sendResponse("sanction_issued", payload)
+}
+
+func (client *Client) handleSanctionRevoke(msg Message) {
+	var request struct {
+		SanctionID int `json:"sanction_id"`
+	}
+	if err := json.Unmarshal(msg.Payload, &request); err != nil || request.SanctionID == 0 {
+		client.sendError("sanction_error", "Invalid revoke format")
+		return
+	}
+
+	revoker := client.userID
+	revoked, err := RevokeSanction(client.dbPool, request.SanctionID, &revoker)
+	if errors.Is(err, moderation.ErrOutranked) {
+		client.sendError("sanction_error", "You cannot revoke a sanction on a user whose role is equal to or above yours")
+		return
+	}
+	if err != nil {
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error revoking sanction")
+		client.sendError("sanction_error", "Revoking sanction failed due to a server error")
+		return
+	}
+	if !revoked {
+		client.sendError("sanction_error", "Sanction not found or already revoked")
+		return
+	}
+
+	client.sendResponse("sanction_revoked", map[string]interface{}{
+		"success":     true,
+		"sanction_id": request.SanctionID,
+	})
+}
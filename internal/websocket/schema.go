@@ -0,0 +1,51 @@
+package websocket
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// messageSchema is the JSON Schema document describing every message on /ws
+//
+//go:embed schema.json
+var messageSchema []byte
+
+// MessageSchema returns the JSON Schema document for the WebSocket protocol
+func MessageSchema() []byte {
+	return messageSchema
+}
+
+// validateMessageSchema checks that every message type with a handler is
+// described in the schema, and that the schema describes no unknown client messages
+func validateMessageSchema() error {
+	var schema struct {
+		Defs map[string]json.RawMessage `json:"$defs"`
+	}
+	if err := json.Unmarshal(messageSchema, &schema); err != nil {
+		return fmt.Errorf("invalid message schema: %w", err)
+	}
+
+	var problems []string
+	for msgType := range messageHandlers {
+		if _, ok := schema.Defs["client."+msgType]; !ok {
+			problems = append(problems, "no schema for message type "+msgType)
+		}
+	}
+	for name := range schema.Defs {
+		msgType, ok := strings.CutPrefix(name, "client.")
+		if !ok {
+			continue
+		}
+		if _, ok := messageHandlers[msgType]; !ok {
+			problems = append(problems, "schema describes unhandled message type "+msgType)
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("message schema is out of date: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
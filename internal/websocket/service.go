@@ -0,0 +1,255 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"openchamp/server/internal/audit"
+	"openchamp/server/internal/auth"
+	"openchamp/server/internal/metrics"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// handleServiceAuthentication is the machine handshake used by game servers and bots
+func (client *Client) handleServiceAuthentication(msg Message) {
+	var request struct {
+		APIKey string `json:"api_key"`
+	}
+	if err := json.Unmarshal(msg.Payload, &request); err != nil || request.APIKey == "" {
+		client.sendAuthError("Invalid service auth format")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	principal, err := auth.AuthenticateAPIKey(ctx, client.dbPool, request.APIKey)
+	if err != nil {
+		if !errors.Is(err, auth.ErrInvalidAPIKey) {
+			client.logger().WithFields(logrus.Fields{
+				"error": err,
+			}).Error("Database error during service auth")
+		}
+		metrics.AuthFailures.WithLabelValues("invalid_api_key").Inc()
+		audit.Record(client.dbPool, audit.Event{
+			Type: audit.EventLoginFailed,
+			IP:   client.getClientIP(),
+			Details: map[string]interface{}{
+				"reason": "invalid_api_key",
+			},
+		})
+		client.sendAuthError("Invalid or revoked API key")
+		return
+	}
+
+	metrics.AuthSuccesses.WithLabelValues("api_key").Inc()
+	if client.userID != 0 {
+		presence.left(client.dbPool, client.userID)
+	}
+	client.stateMutex.Lock()
+	client.authenticated = true
+	client.userID = 0
+	client.serviceAccountID = principal.ServiceAccountID
+	client.username = principal.Name
+	client.role = ""
+	client.permissions = principal.Permissions
+	client.stateMutex.Unlock()
+
+	client.sendResponse("auth_success", map[string]interface{}{
+		"username":       principal.Name,
+		"serviceAccount": true,
+		"scopes":         principal.Permissions.List(),
+	})
+
+	audit.Record(client.dbPool, audit.Event{
+		Type: audit.EventServiceLogin,
+		IP:   client.getClientIP(),
+		Details: map[string]interface{}{
+			"service_account_id": principal.ServiceAccountID,
+			"api_key_id":         principal.KeyID,
+		},
+	})
+	client.logger().WithFields(logrus.Fields{
+		"service_account": principal.Name,
+	}).Info("Service account authenticated")
+}
+
+func (client *Client) handleServiceAccountCreate(msg Message) {
+	var request struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(msg.Payload, &request); err != nil || len(request.Name) < 3 {
+		client.sendError("service_account_error", "Service account name must be at least 3 characters")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	account, err := auth.CreateServiceAccount(ctx, client.dbPool, request.Name, request.Description, &client.userID)
+	if err != nil {
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+			"name":  request.Name,
+		}).Error("Error creating service account")
+		client.sendError("service_account_error", "Could not create service account "+request.Name)
+		return
+	}
+
+	client.sendResponse("service_account_created", map[string]interface{}{
+		"serviceAccount": account,
+	})
+}
+
+func (client *Client) handleServiceAccountList(msg Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	accounts, keys, err := auth.ListServiceAccounts(ctx, client.dbPool)
+	if err != nil {
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error listing service accounts")
+		client.sendError("service_account_error", "Listing service accounts failed due to a server error")
+		return
+	}
+
+	result := make([]map[string]interface{}, 0, len(accounts))
+	for _, account := range accounts {
+		accountKeys := keys[account.ID]
+		if accountKeys == nil {
+			accountKeys = []auth.APIKey{}
+		}
+		result = append(result, map[string]interface{}{
+			"serviceAccount": account,
+			"keys":           accountKeys,
+		})
+	}
+	client.sendResponse("service_account_list", map[string]interface{}{
+		"serviceAccounts": result,
+	})
+}
+
+func (client *Client) handleAPIKeyCreate(msg Message) {
+	var request struct {
+		ServiceAccountID int      `json:"service_account_id"`
+		Scopes           []string `json:"scopes"`
+		ExpiresInDays    int      `json:"expires_in_days"` // 0 for no expiry
+	}
+	if err := json.Unmarshal(msg.Payload, &request); err != nil || request.ServiceAccountID == 0 || request.ExpiresInDays < 0 {
+		client.sendError("api_key_error", "Invalid API key format")
+		return
+	}
+
+	scopes := make([]auth.Permission, 0, len(request.Scopes))
+	for _, scope := range request.Scopes {
+		if !auth.Permission(scope).IsServiceScope() {
+			client.sendError("api_key_error", "Scope can not be granted to an API key: "+scope)
+			return
+		}
+		scopes = append(scopes, auth.Permission(scope))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	raw, key, err := auth.CreateAPIKey(ctx, client.dbPool, request.ServiceAccountID, scopes,
+		time.Duration(request.ExpiresInDays)*24*time.Hour)
+	if err != nil {
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error creating API key")
+		client.sendError("api_key_error", "Creating API key failed due to a server error")
+		return
+	}
+
+	client.recordAPIKeyEvent(audit.EventAPIKeyCreate, key)
+	client.sendResponse("api_key_created", map[string]interface{}{
+		"apiKey": raw,
+		"key":    key,
+	})
+}
+
+func (client *Client) handleAPIKeyRotate(msg Message) {
+	var request struct {
+		KeyID int `json:"key_id"`
+	}
+	if err := json.Unmarshal(msg.Payload, &request); err != nil || request.KeyID == 0 {
+		client.sendError("api_key_error", "Invalid API key format")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	raw, key, err := auth.RotateAPIKey(ctx, client.dbPool, request.KeyID)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidAPIKey) {
+			client.sendError("api_key_error", "API key not found or already revoked")
+			return
+		}
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error rotating API key")
+		client.sendError("api_key_error", "Rotating API key failed due to a server error")
+		return
+	}
+
+	client.recordAPIKeyEvent(audit.EventAPIKeyRotate, key)
+	client.sendResponse("api_key_rotated", map[string]interface{}{
+		"apiKey":     raw,
+		"key":        key,
+		"replacedId": request.KeyID,
+	})
+}
+
+func (client *Client) handleAPIKeyRevoke(msg Message) {
+	var request struct {
+		KeyID int `json:"key_id"`
+	}
+	if err := json.Unmarshal(msg.Payload, &request); err != nil || request.KeyID == 0 {
+		client.sendError("api_key_error", "Invalid API key format")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	revoked, err := auth.RevokeAPIKey(ctx, client.dbPool, request.KeyID)
+	if err != nil {
+		client.logger().WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Error revoking API key")
+		client.sendError("api_key_error", "Revoking API key failed due to a server error")
+		return
+	}
+	if !revoked {
+		client.sendError("api_key_error", "API key not found or already revoked")
+		return
+	}
+
+	client.recordAPIKeyEvent(audit.EventAPIKeyRevoke, &auth.APIKey{ID: request.KeyID})
+	client.sendResponse("api_key_revoked", map[string]interface{}{
+		"success": true,
+		"key_id":  request.KeyID,
+	})
+}
+
+func (client *Client) recordAPIKeyEvent(eventType audit.EventType, key *auth.APIKey) {
+	details := map[string]interface{}{
+		"api_key_id": key.ID,
+	}
+	if key.ServiceAccountID != 0 {
+		details["service_account_id"] = key.ServiceAccountID
+		details["scopes"] = key.Scopes
+	}
+	audit.Record(client.dbPool, audit.Event{
+		Type:    eventType,
+		ActorID: &client.userID,
+		IP:      client.getClientIP(),
+		Details: details,
+	})
+}
@@ -0,0 +1,75 @@
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// draining is set once shutdown starts, new connections are refused from then on
+	draining atomic.Bool
+
+	server      *http.Server
+	serverMutex sync.Mutex
+)
+
+// Draining reports whether the server is shutting down and refusing new connections
+func Draining() bool {
+	return draining.Load()
+}
+
+// Shutdown stops accepting connections and tells every client the server is
+// going away and when to reconnect. It then waits for the clients to leave,
+// closing whoever is left when ctx ends.
+func Shutdown(ctx context.Context, reconnectAfter time.Duration) error {
+	draining.Store(true)
+	log.WithFields(logrus.Fields{
+		"clients": GetConnectedClientsCount(),
+	}).Info("WebSocket server shutting down")
+
+	manager.disconnectClients(func(*Client) bool { return true }, "server_shutdown", func(client *Client) {
+		client.sendResponse("server_shutting_down", map[string]interface{}{
+			"message":               "The server is restarting, please reconnect shortly",
+			"reconnectAfterSeconds": int(reconnectAfter.Seconds()),
+		})
+	})
+
+	// Upgraded connections are hijacked, so this only stops the listener and plain HTTP requests
+	serverMutex.Lock()
+	srv := server
+	serverMutex.Unlock()
+	var err error
+	if srv != nil {
+		err = srv.Shutdown(ctx)
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for GetConnectedClientsCount() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			manager.closeAll()
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// closeAll closes every remaining connection without notice
+func (manager *ClientManager) closeAll() {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+
+	for client := range manager.clients {
+		client.conn.Close()
+	}
+	log.WithFields(logrus.Fields{
+		"clients": len(manager.clients),
+	}).Warn("Closed remaining clients at the shutdown deadline")
+}
@@ -0,0 +1,112 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"openchamp/server/internal/account"
+	"time"
+)
+
+// startTwoFactorChallenge parks the login on the client and asks for a second factor
+func (client *Client) startTwoFactorChallenge(challenge *account.Challenge) {
+	client.pendingChallenge = challenge.ID
+
+	client.sendResponse("2fa_required", map[string]interface{}{
+		"challenge": challenge.ID,
+		"username":  challenge.Username,
+		"methods":   challenge.Methods,
+		"expiresAt": challenge.ExpiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func (client *Client) handleTwoFactorVerify(msg Message) {
+	var verify struct {
+		Challenge    string `json:"challenge"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.Unmarshal(msg.Payload, &verify); err != nil {
+		client.sendError("2fa_error", "Invalid two-factor format")
+		return
+	}
+
+	// Clients that don't echo the challenge id continue the login started on this connection
+	challengeID := verify.Challenge
+	if challengeID == "" {
+		challengeID = client.pendingChallenge
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	session, err := client.accounts.VerifyChallenge(ctx, challengeID, verify.Code, verify.RecoveryCode, client.getClientIP())
+	if err != nil {
+		client.sendServiceError("2fa_error", err, "Verification failed due to a server error")
+		return
+	}
+
+	client.completeAuthentication(session)
+}
+
+// handleTwoFactorEnroll generates a new secret and recovery codes for the authenticated user.
+// 2FA is not active until the user confirms a code from their authenticator app.
+func (client *Client) handleTwoFactorEnroll(msg Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	enrolment, err := client.accounts.EnrollTwoFactor(ctx, client.userID, client.username)
+	if err != nil {
+		client.sendServiceError("2fa_error", err, "Enrolment failed due to a server error")
+		return
+	}
+
+	client.sendResponse("2fa_enroll", map[string]interface{}{
+		"secret":          enrolment.Secret,
+		"provisioningUri": enrolment.ProvisioningURI,
+		"recoveryCodes":   enrolment.RecoveryCodes,
+	})
+}
+
+func (client *Client) handleTwoFactorConfirm(msg Message) {
+	var confirm struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(msg.Payload, &confirm); err != nil {
+		client.sendError("2fa_error", "Invalid two-factor format")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.accounts.ConfirmTwoFactor(ctx, client.userID, confirm.Code, client.getClientIP()); err != nil {
+		client.sendServiceError("2fa_error", err, "Confirmation failed due to a server error")
+		return
+	}
+
+	client.sendResponse("2fa_enabled", map[string]interface{}{
+		"success": true,
+	})
+}
+
+func (client *Client) handleTwoFactorDisable(msg Message) {
+	var disable struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(msg.Payload, &disable); err != nil {
+		client.sendError("2fa_error", "Invalid two-factor format")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.accounts.DisableTwoFactor(ctx, client.userID, disable.Code, client.getClientIP()); err != nil {
+		client.sendServiceError("2fa_error", err, "Disabling two-factor failed due to a server error")
+		return
+	}
+
+	client.sendResponse("2fa_disabled", map[string]interface{}{
+		"success": true,
+	})
+}
@@ -1,11 +1,16 @@
 package websocket
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
-	"path/filepath"
+	"openchamp/server/internal/account"
+	"openchamp/server/internal/auth"
+	"openchamp/server/internal/metrics"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -13,21 +18,41 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// Logger for the WebSocket server
-var log = logrus.New()
+// log is the shared logger, configured by the logging package
+var log = logrus.StandardLogger()
 
 // Client represents a connected websocket client
 type Client struct {
-	id       string
-	conn     *websocket.Conn
-	send     chan []byte
-	manager  *ClientManager
-	dbPool   *pgxpool.Pool
-	username string
-
-	// Authentication fields
-	authenticated bool
-	authToken     string
+	id          string
+	conn        *websocket.Conn
+	send        chan []byte
+	manager     *ClientManager
+	dbPool      *pgxpool.Pool
+	accounts    *account.Service
+	connectedAt time.Time
+
+	// Authentication fields, the ones in clientState are read by other
+	// goroutines and only change while holding stateMutex
+	clientState
+	stateMutex       sync.RWMutex
+	authToken        string
+	pendingChallenge string // Two-factor challenge started by a login on this connection
+
+	sendMutex  sync.Mutex // Guards queueing on send against closing it
+	sendClosed bool
+
+	disconnectReason atomic.Value // First reason the connection was closed for, reported in metrics
+}
+
+// clientState is who a client is logged in as and what they are doing
+type clientState struct {
+	authenticated    bool
+	userID           int
+	username         string
+	role             auth.Role
+	permissions      auth.PermissionSet // Replaced as a whole when the role changes, never modified
+	serviceAccountID int                // Set instead of userID for game servers and bots
+	status           Status             // What the player is doing on this connection, empty means online
 }
 
 type ClientManager struct {
@@ -36,6 +61,7 @@ type ClientManager struct {
 	register   chan *Client
 	unregister chan *Client
 	mutex      sync.RWMutex
+	running    atomic.Bool
 }
 
 // Create a new global client manager
@@ -53,59 +79,34 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-// initializeLogger sets up the logging system
-func initializeLogger() error {
-	// Create logs directory if it doesn't exist
-	logsDir := "logs"
-	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create logs directory: %v", err)
-	}
-
-	// Create log file with timestamp in filename
-	timestamp := time.Now().Format("2006-01-02")
-	logFilePath := filepath.Join(logsDir, fmt.Sprintf("websocket-%s.log", timestamp))
-	logFile, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err != nil {
-		return fmt.Errorf("failed to open log file: %v", err)
-	}
-
-	// Configure logrus
-	log.SetOutput(logFile)
-	log.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp: true,
-	})
-
-	// Set log level
-	log.SetLevel(logrus.InfoLevel)
-
-	log.Info("WebSocket logging system initialized")
-	fmt.Printf("WebSocket logs will be written to %s\n", logFilePath)
-	return nil
-}
-
 // StartWebSocketServer initializes the WebSocket server
-func StartWebSocketServer(port int, dbPool *pgxpool.Pool) {
+func StartWebSocketServer(port int, dbPool *pgxpool.Pool, accounts *account.Service) {
 	// Default Port
 	if port == 0 {
 		port = 8081
 	}
-	// Logging System
-	if err := initializeLogger(); err != nil {
-		fmt.Printf("Failed to initialize WebSocket logger: %v\n", err)
-		os.Exit(1)
+	// Every handled message type must be documented
+	if err := validateMessageSchema(); err != nil {
+		log.WithFields(logrus.Fields{
+			"error": err,
+		}).Fatal("Invalid WebSocket message schema")
 	}
 	// Start the client manager in a separate goroutine for performance
 	go manager.run()
 
-	// Upgrader
-	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		handleWebSocketConnection(w, r, dbPool)
+	// Upgrader, on its own mux so the web server routes are not served on this port
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		handleWebSocketConnection(w, r, dbPool, accounts)
 	})
 
 	// Start the WebSocket server
-	log.Info(fmt.Sprintf("Starting WebSocket server on :%d...", port))
-	fmt.Printf("Starting WebSocket server on :%d...\n", port)
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil); err != nil {
+	log.Infof("Starting WebSocket server on :%d...", port)
+	srv := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: mux}
+	serverMutex.Lock()
+	server = srv
+	serverMutex.Unlock()
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.WithFields(logrus.Fields{
 			"error": err,
 		}).Fatal("Error starting WebSocket server")
@@ -114,6 +115,9 @@ func StartWebSocketServer(port int, dbPool *pgxpool.Pool) {
 
 // Run the client manager to handle client registration, unregistration, and broadcasts
 func (manager *ClientManager) run() {
+	manager.running.Store(true)
+	defer manager.running.Store(false)
+
 	for {
 		select {
 		case client := <-manager.register:
@@ -121,50 +125,76 @@ func (manager *ClientManager) run() {
 			manager.mutex.Lock()
 			manager.clients[client] = true
 			manager.mutex.Unlock()
+			metrics.ActiveConnections.Inc()
 
-			log.WithFields(logrus.Fields{
-				"client_id": client.id,
-			}).Info("Client connected")
+			client.logger().Info("Client connected")
 
 			// Send a welcome message to the new client
-			client.send <- []byte(`Welcome to the Server!`)
+			if client.trySend([]byte(`Welcome to the Server!`)) {
+				metrics.MessagesSent.WithLabelValues("welcome").Inc()
+			}
 
 		case client := <-manager.unregister:
 			// Unregister client
-			if _, ok := manager.clients[client]; ok {
-				manager.mutex.Lock()
-				delete(manager.clients, client)
-				manager.mutex.Unlock()
-				close(client.send)
-
-				log.WithFields(logrus.Fields{
-					"client_id": client.id,
+			if manager.remove(client) {
+				client.logger().WithFields(logrus.Fields{
+					"reason": client.closeReason(),
 				}).Info("Client disconnected")
 			}
 
 		case message := <-manager.broadcast:
-			// Broadcast message to all clients
-			manager.mutex.RLock()
-			for client := range manager.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(manager.clients, client)
-
-					log.WithFields(logrus.Fields{
-						"client_id": client.id,
-						"reason":    "send buffer full",
-					}).Warn("Client forcibly disconnected")
+			// Broadcast message to all clients, slow clients are dropped
+			// rather than holding up everyone else
+			for _, client := range manager.snapshot() {
+				if client.trySend(message) {
+					metrics.MessagesSent.WithLabelValues("broadcast").Inc()
+				} else {
+					client.dropFull()
 				}
 			}
-			manager.mutex.RUnlock()
 		}
 	}
 }
 
+// snapshot returns the registered clients so they can be messaged without holding the lock
+func (manager *ClientManager) snapshot() []*Client {
+	manager.mutex.RLock()
+	defer manager.mutex.RUnlock()
+
+	clients := make([]*Client, 0, len(manager.clients))
+	for client := range manager.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// remove forgets a client and closes its send channel, reporting whether it was registered
+func (manager *ClientManager) remove(client *Client) bool {
+	manager.mutex.Lock()
+	_, ok := manager.clients[client]
+	delete(manager.clients, client)
+	manager.mutex.Unlock()
+	if !ok {
+		return false
+	}
+
+	client.closeSend()
+	if state := client.state(); state.authenticated && state.userID != 0 {
+		presence.left(client.dbPool, state.userID)
+	}
+	metrics.ActiveConnections.Dec()
+	metrics.Disconnects.WithLabelValues(client.closeReason()).Inc()
+	return true
+}
+
 // handleWebSocketConnection upgrades the HTTP request to a WebSocket connection
-func handleWebSocketConnection(w http.ResponseWriter, r *http.Request, dbpool *pgxpool.Pool) {
+func handleWebSocketConnection(w http.ResponseWriter, r *http.Request, dbpool *pgxpool.Pool, accounts *account.Service) {
+	// Clients reconnecting during shutdown should find another instance
+	if draining.Load() {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
 	// Upgrade the incoming HTTP request to a WebSocket connection
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -174,14 +204,17 @@ func handleWebSocketConnection(w http.ResponseWriter, r *http.Request, dbpool *p
 		}).Error("Upgrade error")
 		return
 	}
+	metrics.Connects.Inc()
 
 	// Create a new client
 	client := &Client{
-		id:      r.RemoteAddr,
-		conn:    conn,
-		send:    make(chan []byte, 256),
-		manager: &manager,
-		dbPool:  dbpool,
+		id:          r.RemoteAddr,
+		connectedAt: time.Now(),
+		conn:        conn,
+		send:        make(chan []byte, 256),
+		manager:     &manager,
+		dbPool:      dbpool,
+		accounts:    accounts,
 	}
 
 	// Register the client with the manager
@@ -203,23 +236,101 @@ func (c *Client) readPump() {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.WithFields(logrus.Fields{
-					"client_id": c.id,
-					"error":     err,
+				c.setDisconnectReason("read_error")
+				c.logger().WithFields(logrus.Fields{
+					"error": err,
 				}).Error("Error reading message")
 			}
 			break
 		}
 
-		// Process the message
-		log.WithFields(logrus.Fields{
-			"client_id": c.id,
-			"message":   string(message),
-		}).Info("Received message")
+		// Raw messages are only logged for debugging, with credentials and personal data removed
+		if log.IsLevelEnabled(logrus.DebugLevel) {
+			c.logger().WithFields(logrus.Fields{
+				"message": redactMessage(message),
+			}).Debug("Received message")
+		}
 
 		// Handle the packet (you can implement the handlePacket function)
-		handlePacket(c, string(message), log)
+		handlePacket(c, string(message))
+	}
+}
+
+// logger returns a log entry carrying the client id and, once logged in, who the client is
+func (c *Client) logger() *logrus.Entry {
+	state := c.state()
+	fields := logrus.Fields{
+		"client_id": c.id,
 	}
+	if state.authenticated && state.userID != 0 {
+		fields["user_id"] = state.userID
+	}
+	if state.authenticated && state.serviceAccountID != 0 {
+		fields["service_account_id"] = state.serviceAccountID
+	}
+	return log.WithFields(fields)
+}
+
+// state returns who the client is logged in as, safe to call from any goroutine
+func (c *Client) state() clientState {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+	return c.clientState
+}
+
+// trySend queues a message without blocking, reporting false when the
+// client's buffer is full or the client is already closed
+func (c *Client) trySend(message []byte) bool {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+	if c.sendClosed {
+		return false
+	}
+	select {
+	case c.send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeSend closes the send channel once, which makes writePump close the connection
+func (c *Client) closeSend() bool {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+	if c.sendClosed {
+		return false
+	}
+	c.sendClosed = true
+	close(c.send)
+	return true
+}
+
+// dropFull disconnects a client that stopped reading its messages. Closing
+// the connection ends readPump, which unregisters the client as usual.
+func (c *Client) dropFull() {
+	c.setDisconnectReason("send_buffer_full")
+	if !c.closeSend() {
+		return
+	}
+	c.conn.Close()
+
+	c.logger().WithFields(logrus.Fields{
+		"reason": "send buffer full",
+	}).Warn("Client forcibly disconnected")
+}
+
+// setDisconnectReason records why the connection is closing, later reasons are ignored
+func (c *Client) setDisconnectReason(reason string) {
+	c.disconnectReason.CompareAndSwap(nil, reason)
+}
+
+// closeReason returns why the connection closed, a client that went away on its own has no recorded reason
+func (c *Client) closeReason() string {
+	if reason, ok := c.disconnectReason.Load().(string); ok {
+		return reason
+	}
+	return "client_closed"
 }
 
 // writePump sends messages to the client
@@ -236,9 +347,8 @@ func (c *Client) writePump() {
 
 		err := c.conn.WriteMessage(websocket.TextMessage, message)
 		if err != nil {
-			log.WithFields(logrus.Fields{
-				"client_id": c.id,
-				"error":     err,
+			c.logger().WithFields(logrus.Fields{
+				"error": err,
 			}).Error("Error writing message")
 			return
 		}
@@ -250,6 +360,81 @@ func BroadcastMessage(message []byte) {
 	manager.broadcast <- message
 }
 
+// Announce sends a text announcement from the operators to every connected client
+func Announce(message string) {
+	announcement, _ := json.Marshal(map[string]interface{}{
+		"type": "announcement",
+		"payload": map[string]interface{}{
+			"message": message,
+		},
+	})
+	BroadcastMessage(announcement)
+}
+
+// ConnectedUser is an authenticated player on a live connection
+type ConnectedUser struct {
+	UserID     int
+	Username   string
+	Role       auth.Role
+	RemoteAddr string
+}
+
+// ConnectedUsers lists the authenticated users on live connections, sorted by username
+func ConnectedUsers() []ConnectedUser {
+	var users []ConnectedUser
+	for _, client := range manager.snapshot() {
+		state := client.state()
+		if !state.authenticated || state.userID == 0 {
+			continue
+		}
+		users = append(users, ConnectedUser{
+			UserID:     state.userID,
+			Username:   state.username,
+			Role:       state.role,
+			RemoteAddr: client.id,
+		})
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users
+}
+
+// ClientInfo describes a live connection, authenticated or not
+type ClientInfo struct {
+	ID               string    `json:"id"`
+	IP               string    `json:"ip"`
+	ConnectedAt      time.Time `json:"connectedAt"`
+	UserID           int       `json:"userId,omitempty"`
+	Username         string    `json:"username,omitempty"`
+	Role             auth.Role `json:"role,omitempty"`
+	ServiceAccountID int       `json:"serviceAccountId,omitempty"`
+}
+
+// ConnectedClients lists every live connection, oldest first
+func ConnectedClients() []ClientInfo {
+	snapshot := manager.snapshot()
+	clients := make([]ClientInfo, 0, len(snapshot))
+	for _, client := range snapshot {
+		info := ClientInfo{
+			ID:          client.id,
+			IP:          client.getClientIP(),
+			ConnectedAt: client.connectedAt,
+		}
+		if state := client.state(); state.authenticated {
+			info.UserID = state.userID
+			info.Username = state.username
+			info.Role = state.role
+			info.ServiceAccountID = state.serviceAccountID
+		}
+		clients = append(clients, info)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ConnectedAt.Before(clients[j].ConnectedAt)
+	})
+	return clients
+}
+
 // GetConnectedClientsCount returns the number of currently connected clients
 func GetConnectedClientsCount() int {
 	manager.mutex.RLock()
@@ -257,21 +442,7 @@ func GetConnectedClientsCount() int {
 	return len(manager.clients)
 }
 
-// SetLogLevel allows changing the log level at runtime
-func SetLogLevel(level string) {
-	switch level {
-	case "debug":
-		log.SetLevel(logrus.DebugLevel)
-	case "info":
-		log.SetLevel(logrus.InfoLevel)
-	case "warn":
-		log.SetLevel(logrus.WarnLevel)
-	case "error":
-		log.SetLevel(logrus.ErrorLevel)
-	default:
-		log.SetLevel(logrus.InfoLevel)
-	}
-	log.WithFields(logrus.Fields{
-		"level": level,
-	}).Info("Log level changed")
+// HubRunning reports whether the client manager is processing registrations and broadcasts
+func HubRunning() bool {
+	return manager.running.Load()
 }
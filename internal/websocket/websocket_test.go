@@ -0,0 +1,54 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+// addTestClient registers a logged in client with the global manager the way
+// setSession fills in its state, removing it again when the test ends
+func addTestClient(t *testing.T, userID int, username string) *Client {
+	t.Helper()
+	client := &Client{
+		id:          "test-client",
+		send:        make(chan []byte, 8),
+		manager:     &manager,
+		connectedAt: time.Now(),
+	}
+	client.stateMutex.Lock()
+	client.authenticated = true
+	client.userID = userID
+	client.username = username
+	client.stateMutex.Unlock()
+
+	manager.mutex.Lock()
+	manager.clients[client] = true
+	manager.mutex.Unlock()
+	t.Cleanup(func() {
+		manager.mutex.Lock()
+		delete(manager.clients, client)
+		manager.mutex.Unlock()
+	})
+	return client
+}
+
+func TestConnectedUsersReportUsername(t *testing.T) {
+	addTestClient(t, 42, "player")
+
+	// Other tests may leave connections behind, only the test client matters
+	found := false
+	for _, user := range ConnectedUsers() {
+		if user.UserID == 42 {
+			found = true
+			if user.Username != "player" {
+				t.Errorf("ConnectedUsers() lists user 42 as %q, want player", user.Username)
+			}
+		}
+	}
+	if !found {
+		t.Error("ConnectedUsers() does not list user 42")
+	}
+	if presence := currentPresence(42); presence.Username != "player" || presence.Status != StatusOnline {
+		t.Errorf("currentPresence() = %+v, want player online", presence)
+	}
+}
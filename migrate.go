@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"openchamp/server/internal/config"
+	"openchamp/server/internal/database"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const migrateUsage = `Usage: openchamp migrate <command>
+
+Commands:
+  up               Apply every pending migration
+  down [-steps N]  Roll back the last N migrations (default 1)
+  status           List migrations and when they were applied`
+
+// runMigrate handles the migrate subcommand and returns the process exit code
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	dbPool, ok := openDatabase(config.Load())
+	if !ok {
+		return 1
+	}
+	defer dbPool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp(ctx, dbPool)
+		if err != nil {
+			log.Error(err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := flags.Int("steps", 1, "number of migrations to roll back")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+		if *steps < 1 {
+			fmt.Fprintln(os.Stderr, "-steps must be at least 1")
+			return 2
+		}
+		rolledBack, err := database.MigrateDown(ctx, dbPool, *steps)
+		if err != nil {
+			log.Error(err)
+			return 1
+		}
+		if len(rolledBack) == 0 {
+			fmt.Println("No migrations to roll back")
+		}
+
+	case "status":
+		statuses, err := database.MigrationStatuses(ctx, dbPool)
+		if err != nil {
+			log.Error(err)
+			return 1
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d  %-40s %s\n", status.Version, status.Name, applied)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"openchamp/server/internal/api"
+	"openchamp/server/internal/config"
+	"openchamp/server/internal/logging"
+	"openchamp/server/internal/websocket"
+	"os"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	log "github.com/sirupsen/logrus"
+)
+
+// shutdown drains the WebSocket clients, then the web server, and closes the
+// database, all within cfg.ShutdownTimeout. A second signal exits immediately.
+func shutdown(cfg config.Config, signals <-chan os.Signal, dbPool *pgxpool.Pool) {
+	go func() {
+		sig := <-signals
+		log.WithField("signal", sig).Warn("Received the signal again, exiting immediately")
+		os.Exit(1)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	log.WithField("timeout", cfg.ShutdownTimeout).Info("Shutting down")
+	if err := websocket.Shutdown(ctx, cfg.ReconnectDelay); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Warn("WebSocket server did not drain cleanly")
+	}
+	if err := api.Shutdown(ctx); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Warn("Web server did not drain cleanly")
+	}
+
+	dbPool.Close()
+	log.Info("Shutdown complete")
+	logging.Close()
+}
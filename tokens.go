@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const tokensUsage = `Usage: openchamp tokens <command>
+
+Commands:
+  revoke -user NAME  Revoke every login token of a user`
+
+// runTokens handles the tokens subcommand and returns the process exit code
+func runTokens(args []string) int {
+	if len(args) == 0 || args[0] != "revoke" {
+		fmt.Fprintln(os.Stderr, tokensUsage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("tokens revoke", flag.ContinueOnError)
+	username := flags.String("user", "", "user whose tokens are revoked")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *username == "" || flags.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, tokensUsage)
+		return 2
+	}
+
+	dbPool, accounts, ok := openAccounts()
+	if !ok {
+		return 1
+	}
+	defer dbPool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	revoked, err := accounts.RevokeTokens(ctx, *username, nil, cliSource)
+	if err != nil {
+		return reportError(err)
+	}
+	fmt.Printf("Revoked %d token(s) of %s\n", revoked, *username)
+	return 0
+}
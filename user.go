@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"openchamp/server/internal/config"
+	"openchamp/server/internal/moderation"
+	"os"
+	"time"
+)
+
+const userUsage = `Usage: openchamp user <command>
+
+Commands:
+  create [-email EMAIL] <username>              Create an account, the password is read from stdin
+  ban -reason TEXT [-minutes N] <username>      Ban a player, without -minutes the ban is permanent
+  unban <username>                              Lift every active ban of a player
+  reset-password <username>                     Set a new password read from stdin and log the user out everywhere
+
+Bans are issued through the admin API of the running instance at -url, so
+players who are online are disconnected. The API key needs the
+sanctions.issue scope and is read from OPENCHAMP_API_KEY when -key is not
+given. Without a key, or when no instance answers, the ban is written to the
+database directly and online sessions stay connected until they reconnect.
+The other commands work on the database directly.`
+
+// runUser handles the user subcommand and returns the process exit code
+func runUser(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, userUsage)
+		return 2
+	}
+
+	cfg := config.Load()
+	flags := flag.NewFlagSet("user "+args[0], flag.ContinueOnError)
+	email := flags.String("email", "", "email address of the new account")
+	reason := flags.String("reason", "", "reason shown to the banned player")
+	minutes := flags.Int("minutes", 0, "ban duration in minutes, 0 is permanent")
+	baseURL := flags.String("url", cfg.PublicURL, "address of the running web server, for bans")
+	key := flags.String("key", os.Getenv("OPENCHAMP_API_KEY"), "API key with the sanctions.issue scope, for bans")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, userUsage)
+		return 2
+	}
+	username := flags.Arg(0)
+
+	if args[0] == "ban" {
+		if *reason == "" || *minutes < 0 {
+			fmt.Fprintln(os.Stderr, userUsage)
+			return 2
+		}
+		if *key == "" {
+			fmt.Fprintln(os.Stderr, "Warning: no API key given, the ban is written to the database and online sessions stay connected")
+		} else if code, done := banOnline(*baseURL, *key, username, *reason, *minutes); done {
+			return code
+		}
+	}
+
+	dbPool, accounts, ok := openAccounts()
+	if !ok {
+		return 1
+	}
+	defer dbPool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	switch args[0] {
+	case "create":
+		password, err := readPassword("Password: ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		user, err := accounts.CreateAccount(ctx, username, password, *email, nil, cliSource)
+		if err != nil {
+			return reportError(err)
+		}
+		fmt.Printf("Created %s with id %d\n", user.Username, user.ID)
+
+	case "reset-password":
+		password, err := readPassword("New password: ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		if err := accounts.ResetPassword(ctx, username, password, nil, cliSource); err != nil {
+			return reportError(err)
+		}
+		fmt.Println("Password changed, every session of " + username + " was logged out")
+
+	case "ban":
+		user, err := accounts.UserByUsername(ctx, username)
+		if err != nil {
+			return reportError(err)
+		}
+		sanction, err := moderation.IssueSanction(ctx, dbPool, user.ID, moderation.SanctionBan,
+			*reason, nil, time.Duration(*minutes)*time.Minute)
+		if err != nil {
+			return reportError(err)
+		}
+		if sanction.ExpiresAt == nil {
+			fmt.Println("Banned " + user.Username + " permanently")
+		} else {
+			fmt.Println("Banned " + user.Username + " until " + sanction.ExpiresAt.Format(time.RFC1123))
+		}
+
+	case "unban":
+		user, err := accounts.UserByUsername(ctx, username)
+		if err != nil {
+			return reportError(err)
+		}
+		lifted := 0
+		for {
+			sanction, err := moderation.ActiveSanction(ctx, dbPool, user.ID, moderation.SanctionBan)
+			if err != nil {
+				return reportError(err)
+			}
+			if sanction == nil {
+				break
+			}
+			if _, err := moderation.RevokeSanction(ctx, dbPool, sanction.ID, nil); err != nil {
+				return reportError(err)
+			}
+			lifted++
+		}
+		if lifted == 0 {
+			fmt.Println(user.Username + " is not banned")
+		} else {
+			fmt.Printf("Lifted %d ban(s) of %s\n", lifted, user.Username)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, userUsage)
+		return 2
+	}
+	return 0
+}
+
+// banOnline bans a player through the admin API of the running instance,
+// which disconnects them if they are online. It reports false when no
+// instance answered, so the caller can fall back to the database.
+func banOnline(baseURL, key, username, reason string, minutes int) (int, bool) {
+	var sanction struct {
+		Username  string `json:"username"`
+		Permanent bool   `json:"permanent"`
+		ExpiresAt string `json:"expiresAt"`
+	}
+	err := callAdminAPI(baseURL, key, "/admin/sanctions", map[string]interface{}{
+		"username":         username,
+		"type":             moderation.SanctionBan,
+		"reason":           reason,
+		"duration_minutes": minutes,
+	}, &sanction)
+	if errors.Is(err, errUnreachable) {
+		fmt.Fprintln(os.Stderr, "Warning: "+err.Error())
+		fmt.Fprintln(os.Stderr, "Warning: the ban is written to the database instead, online sessions stay connected")
+		return 0, false
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1, true
+	}
+
+	if sanction.Permanent {
+		fmt.Println("Banned " + sanction.Username + " permanently")
+	} else {
+		fmt.Println("Banned " + sanction.Username + " until " + sanction.ExpiresAt)
+	}
+	return 0, true
+}